@@ -0,0 +1,101 @@
+package cybersource_soap_dm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hugochinchilla79/cybersource_soap_dm/models"
+)
+
+// AuditRecord is the audit trail entry for one AnalyzeRisk call.
+type AuditRecord struct {
+	Timestamp             time.Time     `json:"timestamp"`
+	MerchantID            string        `json:"merchant_id"`
+	MerchantReferenceCode string        `json:"merchant_reference_code"`
+	RequestID             string        `json:"request_id,omitempty"`
+	RequestXML            string        `json:"request_xml"` // signed envelope, redacted
+	ResponseXML           string        `json:"response_xml"`
+	Decision              string        `json:"decision,omitempty"`
+	ReasonCode            int           `json:"reason_code,omitempty"`
+	HTTPStatus            int           `json:"http_status,omitempty"`
+	Latency               time.Duration `json:"latency_ns"`
+	CertSerial            string        `json:"cert_serial"`
+	Fallback              bool          `json:"fallback,omitempty"`
+	Error                 string        `json:"error,omitempty"`
+}
+
+// AuditSink stores audit records. Implementations must be safe for concurrent use.
+type AuditSink interface {
+	Record(ctx context.Context, rec AuditRecord) error
+}
+
+// AuditError is returned when a call completed but its audit record could
+// not be stored. The response returned with it is complete and usable.
+type AuditError struct {
+	// Err is the sink error.
+	Err error
+
+	// CallErr is the error of the call itself, if any.
+	CallErr error
+}
+
+func (e *AuditError) Error() string {
+	if e.CallErr != nil {
+		return fmt.Sprintf("cybersource_soap_dm: audit: %v (call error: %v)", e.Err, e.CallErr)
+	}
+	return fmt.Sprintf("cybersource_soap_dm: audit: %v", e.Err)
+}
+
+func (e *AuditError) Unwrap() []error {
+	if e.CallErr != nil {
+		return []error{e.Err, e.CallErr}
+	}
+	return []error{e.Err}
+}
+
+// audit builds and stores the audit record for a call sent for merchantID.
+// It returns err unchanged when no sink is configured or the record was stored.
+func (c *Client) audit(ctx context.Context, start time.Time, merchantID string, req models.RiskAnalysisRequest, signed []byte,
+	resp models.RiskAnalysisAPIResponse, err error) error {
+	if c.cfg.AuditSink == nil {
+		return err
+	}
+
+	rec := AuditRecord{
+		Timestamp:             start.UTC(),
+		MerchantID:            merchantID,
+		MerchantReferenceCode: req.MerchantReferenceCode,
+		RequestID:             resp.Data.RequestID,
+		ResponseXML:           string(resp.Body),
+		Decision:              resp.Data.Decision,
+		ReasonCode:            resp.Data.ReasonCode,
+		HTTPStatus:            resp.HTTPStatus,
+		Latency:               time.Since(start),
+		Fallback:              resp.Data.Fallback,
+	}
+	if leaf := c.tlsCert.Leaf; leaf != nil {
+		rec.CertSerial = fmt.Sprintf("%X", leaf.SerialNumber)
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	if signed != nil {
+		redacted, rerr := redactEnvelope(signed, c.cfg.MDDSchema)
+		if rerr != nil {
+			// Never store an envelope that could not be redacted.
+			return &AuditError{Err: fmt.Errorf("redact request: %w", rerr), CallErr: err}
+		}
+		rec.RequestXML = string(redacted)
+	}
+
+	// Store the record even when the caller's context is cancelled.
+	if serr := c.cfg.AuditSink.Record(context.WithoutCancel(ctx), rec); serr != nil {
+		return &AuditError{Err: serr, CallErr: err}
+	}
+	return err
+}
+
+// errAuditClosed is returned by sinks used after Close.
+var errAuditClosed = errors.New("audit sink closed")
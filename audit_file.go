@@ -0,0 +1,145 @@
+package cybersource_soap_dm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// FileAuditSink appends audit records as JSON lines to a file, rotating it
+// when it grows past MaxBytes. Rotated files are renamed path.1, path.2, …
+// with path.1 the most recent.
+type FileAuditSink struct {
+	path       string
+	maxBytes   int64
+	maxBackups int
+
+	mu     sync.Mutex
+	f      *os.File
+	size   int64
+	closed bool
+}
+
+// NewFileAuditSink opens (or creates) the audit file at path.
+// maxBytes <= 0 disables rotation; maxBackups is the number of rotated
+// files to keep, older ones are deleted.
+func NewFileAuditSink(path string, maxBytes int64, maxBackups int) (*FileAuditSink, error) {
+	s := &FileAuditSink{path: path, maxBytes: maxBytes, maxBackups: maxBackups}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Record implements AuditSink. When rotation fails the record is still
+// appended to the current file and the rotation error is returned;
+// rotation is tried again on the next record.
+func (s *FileAuditSink) Record(_ context.Context, rec AuditRecord) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("encode audit record: %w", err)
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return errAuditClosed
+	}
+	if s.f == nil {
+		// A previous rotation could not reopen the file.
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+	var rotateErr error
+	if s.maxBytes > 0 && s.size > 0 && s.size+int64(len(line)) > s.maxBytes {
+		if rotateErr = s.rotate(); s.f == nil {
+			return rotateErr
+		}
+	}
+	n, err := s.f.Write(line)
+	s.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("write audit record: %w", err)
+	}
+	return rotateErr
+}
+
+// Close closes the audit file.
+func (s *FileAuditSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	if s.f == nil {
+		return nil
+	}
+	return s.f.Close()
+}
+
+func (s *FileAuditSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("open audit file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("stat audit file: %w", err)
+	}
+	s.f = f
+	s.size = info.Size()
+	return nil
+}
+
+// rotate moves the current file aside and opens a new one. The file is
+// reopened even when closing or renaming fails, so records keep being
+// written to path; s.f is nil only when reopening failed too.
+func (s *FileAuditSink) rotate() error {
+	var err error
+	if closeErr := s.f.Close(); closeErr != nil {
+		err = fmt.Errorf("close audit file: %w", closeErr)
+	}
+	s.f = nil
+	if err == nil {
+		err = s.shiftBackups()
+	}
+	if openErr := s.open(); openErr != nil {
+		return errors.Join(err, openErr)
+	}
+	return err
+}
+
+// shiftBackups renames path to path.1, shifting older backups up by one
+// and dropping the oldest, or removes path when no backups are kept.
+func (s *FileAuditSink) shiftBackups() error {
+	if s.maxBackups <= 0 {
+		if err := os.Remove(s.path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("rotate audit file: %w", err)
+		}
+		return nil
+	}
+	oldest := fmt.Sprintf("%s.%d", s.path, s.maxBackups)
+	if err := os.Remove(oldest); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("rotate audit file: %w", err)
+	}
+	for i := s.maxBackups - 1; i >= 1; i-- {
+		from := fmt.Sprintf("%s.%d", s.path, i)
+		to := fmt.Sprintf("%s.%d", s.path, i+1)
+		if err := os.Rename(from, to); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("rotate audit file: %w", err)
+		}
+	}
+	if err := os.Rename(s.path, s.path+".1"); err != nil {
+		return fmt.Errorf("rotate audit file: %w", err)
+	}
+	return nil
+}
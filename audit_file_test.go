@@ -0,0 +1,156 @@
+package cybersource_soap_dm
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// readAuditFile returns the merchant reference codes recorded in a JSONL
+// audit file.
+func readAuditFile(t *testing.T, path string) []string {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var refs []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		refs = append(refs, rec.MerchantReferenceCode)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return refs
+}
+
+func TestFileAuditSinkRotation(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	record := func(sink *FileAuditSink, ref string) {
+		t.Helper()
+		if err := sink.Record(ctx, AuditRecord{MerchantID: "testmerchant", MerchantReferenceCode: ref}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	line, err := json.Marshal(AuditRecord{MerchantID: "testmerchant", MerchantReferenceCode: "order-0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Room for two records per file.
+	sink, err := NewFileAuditSink(path, int64(2*(len(line)+1)), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 7; i++ {
+		record(sink, fmt.Sprintf("order-%d", i))
+	}
+
+	want := map[string][]string{
+		path:        {"order-6"},
+		path + ".1": {"order-4", "order-5"},
+		path + ".2": {"order-2", "order-3"},
+	}
+	for file, refs := range want {
+		if got := readAuditFile(t, file); fmt.Sprint(got) != fmt.Sprint(refs) {
+			t.Errorf("%s = %v, want %v", filepath.Base(file), got, refs)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("backup beyond maxBackups exists: %v", err)
+	}
+
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Record(ctx, AuditRecord{}); !errors.Is(err, errAuditClosed) {
+		t.Errorf("Record after Close: err = %v, want errAuditClosed", err)
+	}
+
+	// Reopening appends to the current file and counts its size.
+	sink, err = NewFileAuditSink(path, int64(2*(len(line)+1)), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	record(sink, "order-7")
+	record(sink, "order-8")
+	if got := readAuditFile(t, path); fmt.Sprint(got) != "[order-8]" {
+		t.Errorf("after reopening, current file = %v, want [order-8]", got)
+	}
+	if got := readAuditFile(t, path+".1"); fmt.Sprint(got) != "[order-6 order-7]" {
+		t.Errorf("after reopening, %s.1 = %v, want [order-6 order-7]", filepath.Base(path), got)
+	}
+}
+
+func TestFileAuditSinkWithoutBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink, err := NewFileAuditSink(path, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	for _, ref := range []string{"order-1", "order-2"} {
+		if err := sink.Record(context.Background(), AuditRecord{MerchantReferenceCode: ref}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := readAuditFile(t, path); fmt.Sprint(got) != "[order-2]" {
+		t.Errorf("current file = %v, want [order-2]", got)
+	}
+	if _, err := os.Stat(path + ".1"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("backup written with maxBackups 0: %v", err)
+	}
+}
+
+func TestFileAuditSinkKeepsWritingWhenRotationFails(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	// A non-empty directory where the oldest backup goes cannot be removed.
+	if err := os.MkdirAll(filepath.Join(path+".1", "blocker"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	sink, err := NewFileAuditSink(path, 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	if err := sink.Record(ctx, AuditRecord{MerchantReferenceCode: "order-1"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, ref := range []string{"order-2", "order-3"} {
+		if err := sink.Record(ctx, AuditRecord{MerchantReferenceCode: ref}); err == nil {
+			t.Fatalf("%s: want the rotation error", ref)
+		}
+	}
+	if got := readAuditFile(t, path); fmt.Sprint(got) != "[order-1 order-2 order-3]" {
+		t.Errorf("current file = %v, want every record kept", got)
+	}
+
+	// Rotation resumes once the obstacle is gone.
+	if err := os.RemoveAll(path + ".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Record(ctx, AuditRecord{MerchantReferenceCode: "order-4"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := readAuditFile(t, path); fmt.Sprint(got) != "[order-4]" {
+		t.Errorf("current file after recovery = %v, want [order-4]", got)
+	}
+	if got := readAuditFile(t, path+".1"); fmt.Sprint(got) != "[order-1 order-2 order-3]" {
+		t.Errorf("backup after recovery = %v", got)
+	}
+}
@@ -0,0 +1,119 @@
+package cybersource_soap_dm
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// DefaultAuditTable is the table name used by SQLAuditSink when none is given.
+const DefaultAuditTable = "cybersource_dm_audit"
+
+var sqlIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// SQLAuditSink stores audit records in a database/sql table. It works with
+// any driver; the placeholder style must match it ("?" for SQLite and
+// MySQL, "$N" for PostgreSQL).
+type SQLAuditSink struct {
+	db     *sql.DB
+	table  string
+	insert string
+	closed atomic.Bool
+}
+
+// NewSQLAuditSink creates a sink writing to table (DefaultAuditTable when
+// empty). dollarPlaceholders selects "$1, $2, …" placeholders instead of "?".
+// The caller owns db and closes it once the sink is no longer used.
+func NewSQLAuditSink(db *sql.DB, table string, dollarPlaceholders bool) (*SQLAuditSink, error) {
+	if table == "" {
+		table = DefaultAuditTable
+	}
+	if !sqlIdentifier.MatchString(table) {
+		return nil, fmt.Errorf("invalid audit table name %q", table)
+	}
+
+	cols := []string{
+		"recorded_at", "merchant_id", "merchant_reference_code", "request_id",
+		"request_xml", "response_xml", "decision", "reason_code", "http_status",
+		"latency_ms", "cert_serial", "fallback", "error",
+	}
+	placeholders := make([]string, len(cols))
+	for i := range cols {
+		if dollarPlaceholders {
+			placeholders[i] = fmt.Sprintf("$%d", i+1)
+		} else {
+			placeholders[i] = "?"
+		}
+	}
+
+	return &SQLAuditSink{
+		db:    db,
+		table: table,
+		insert: fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+			table, strings.Join(cols, ", "), strings.Join(placeholders, ", ")),
+	}, nil
+}
+
+// CreateTable creates the audit table if it does not exist, using column
+// types portable across SQLite, PostgreSQL and MySQL.
+func (s *SQLAuditSink) CreateTable(ctx context.Context) error {
+	ddl := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+	recorded_at TIMESTAMP NOT NULL,
+	merchant_id VARCHAR(64) NOT NULL,
+	merchant_reference_code VARCHAR(128) NOT NULL,
+	request_id VARCHAR(64),
+	request_xml TEXT,
+	response_xml TEXT,
+	decision VARCHAR(16),
+	reason_code INTEGER,
+	http_status INTEGER,
+	latency_ms INTEGER NOT NULL,
+	cert_serial VARCHAR(64),
+	fallback BOOLEAN NOT NULL,
+	error TEXT
+)`, s.table)
+	if _, err := s.db.ExecContext(ctx, ddl); err != nil {
+		return fmt.Errorf("create audit table: %w", err)
+	}
+	return nil
+}
+
+// Record implements AuditSink.
+func (s *SQLAuditSink) Record(ctx context.Context, rec AuditRecord) error {
+	if s.closed.Load() {
+		return errAuditClosed
+	}
+	_, err := s.db.ExecContext(ctx, s.insert,
+		rec.Timestamp,
+		rec.MerchantID,
+		rec.MerchantReferenceCode,
+		nullString(rec.RequestID),
+		rec.RequestXML,
+		rec.ResponseXML,
+		nullString(rec.Decision),
+		rec.ReasonCode,
+		rec.HTTPStatus,
+		rec.Latency.Milliseconds(),
+		rec.CertSerial,
+		rec.Fallback,
+		nullString(rec.Error),
+	)
+	if err != nil {
+		return fmt.Errorf("insert audit record: %w", err)
+	}
+	return nil
+}
+
+// Close stops the sink; later records fail. It does not close the
+// database, which the caller owns.
+func (s *SQLAuditSink) Close() error {
+	s.closed.Store(true)
+	return nil
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,98 @@
+package cybersource_soap_dm
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+func TestSQLAuditSink(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "audit.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := NewSQLAuditSink(db, "audit; DROP TABLE x", false); err == nil {
+		t.Fatal("NewSQLAuditSink accepted an invalid table name")
+	}
+	sink, err := NewSQLAuditSink(db, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ { // CREATE TABLE IF NOT EXISTS is idempotent
+		if err := sink.CreateTable(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec := AuditRecord{
+		Timestamp:             time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC),
+		MerchantID:            "testmerchant",
+		MerchantReferenceCode: "order-1",
+		RequestID:             "7000000000000000000001",
+		RequestXML:            "<request/>",
+		ResponseXML:           "<reply/>",
+		Decision:              "REVIEW",
+		ReasonCode:            480,
+		HTTPStatus:            200,
+		Latency:               1500 * time.Millisecond,
+		CertSerial:            "1092",
+		Fallback:              true,
+	}
+	if err := sink.Record(ctx, rec); err != nil {
+		t.Fatal(err)
+	}
+	failed := AuditRecord{Timestamp: rec.Timestamp, MerchantID: "testmerchant", MerchantReferenceCode: "order-2", Error: "timeout"}
+	if err := sink.Record(ctx, failed); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		got                          AuditRecord
+		requestID, decision, errText sql.NullString
+		latencyMS                    int64
+	)
+	err = db.QueryRowContext(ctx, `SELECT recorded_at, merchant_id, merchant_reference_code, request_id,
+		request_xml, response_xml, decision, reason_code, http_status, latency_ms, cert_serial, fallback, error
+		FROM `+DefaultAuditTable+` WHERE merchant_reference_code = ?`, "order-1").Scan(
+		&got.Timestamp, &got.MerchantID, &got.MerchantReferenceCode, &requestID,
+		&got.RequestXML, &got.ResponseXML, &decision, &got.ReasonCode, &got.HTTPStatus,
+		&latencyMS, &got.CertSerial, &got.Fallback, &errText)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got.RequestID, got.Decision, got.Error = requestID.String, decision.String, errText.String
+	got.Latency = time.Duration(latencyMS) * time.Millisecond
+	got.Timestamp = got.Timestamp.UTC()
+	if got != rec {
+		t.Errorf("stored record:\n got %+v\nwant %+v", got, rec)
+	}
+
+	var nulls int
+	err = db.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+DefaultAuditTable+`
+		WHERE merchant_reference_code = ? AND request_id IS NULL AND decision IS NULL AND error = ?`,
+		"order-2", "timeout").Scan(&nulls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nulls != 1 {
+		t.Error("empty request_id and decision were not stored as NULL")
+	}
+
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Record(ctx, rec); !errors.Is(err, errAuditClosed) {
+		t.Errorf("Record after Close: err = %v, want errAuditClosed", err)
+	}
+	if err := db.PingContext(ctx); err != nil {
+		t.Errorf("Close closed the caller's database: %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+package cybersource_soap_dm
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+// memorySink is an AuditSink that keeps records in memory.
+type memorySink struct {
+	mu      sync.Mutex
+	records []AuditRecord
+}
+
+func (s *memorySink) Record(_ context.Context, rec AuditRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, rec)
+	return nil
+}
+
+func TestAuditRecordsChildMerchant(t *testing.T) {
+	sink := &memorySink{}
+	c := newTestClient(t, Config{
+		MerchantID:       "portfolio",
+		ChildMerchantIDs: []string{"child_a"},
+		AuditSink:        sink,
+		DryRun:           true,
+	})
+
+	for _, req := range []struct{ ref, merchantID string }{{"order-1", ""}, {"order-2", "child_a"}} {
+		r := testRequest(req.ref)
+		r.MerchantID = req.merchantID
+		if _, err := c.AnalyzeRisk(context.Background(), r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{"portfolio", "child_a"}
+	if len(sink.records) != len(want) {
+		t.Fatalf("got %d records, want %d", len(sink.records), len(want))
+	}
+	for i, rec := range sink.records {
+		if rec.MerchantID != want[i] {
+			t.Errorf("record %d MerchantID = %q, want %q", i, rec.MerchantID, want[i])
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package cybersource_soap_dm
+
+import (
+	"context"
+	"sync"
+
+	"github.com/hugochinchilla79/cybersource_soap_dm/models"
+)
+
+// DefaultBatchConcurrency is the number of requests AnalyzeRiskBatch runs in
+// parallel when BatchOptions.Concurrency is not set.
+const DefaultBatchConcurrency = 4
+
+// BatchOptions configures AnalyzeRiskBatch.
+type BatchOptions struct {
+	// Concurrency is the maximum number of requests in flight.
+	// Zero means DefaultBatchConcurrency.
+	Concurrency int
+
+	// RatePerSecond caps how many requests this batch starts per second.
+	// It applies to this call only and on top of Config.RateLimit, which
+	// is shared by every call on the client; use Config.RateLimit to cap
+	// the merchant's overall rate. Zero means no batch-level limit.
+	RatePerSecond float64
+
+	// Burst is the number of requests that may start at once before
+	// RatePerSecond applies. Zero means 1.
+	Burst int
+
+	// Progress, when set, is called after each request completes with the
+	// number of completed requests and the batch size. Calls are serialized.
+	Progress func(done, total int)
+}
+
+// BatchResult is the outcome of one request in a batch.
+type BatchResult struct {
+	// Index is the position of the request in the input slice.
+	Index int
+
+	// Response is the API response. It may be partially populated on error,
+	// as with AnalyzeRisk.
+	Response models.RiskAnalysisAPIResponse
+
+	// Err is the error returned by AnalyzeRisk, or the context error for
+	// requests not started before the batch was cancelled.
+	Err error
+}
+
+// AnalyzeRiskBatch screens many requests with bounded concurrency.
+// The returned slice has one result per request, in input order.
+// Individual failures are reported in BatchResult.Err; cancelling ctx stops
+// new requests from starting and marks them with ctx.Err().
+func (c *Client) AnalyzeRiskBatch(ctx context.Context, reqs []models.RiskAnalysisRequest, opts BatchOptions) []BatchResult {
+	results := make([]BatchResult, len(reqs))
+	if len(reqs) == 0 {
+		return results
+	}
+
+	workers := opts.Concurrency
+	if workers <= 0 {
+		workers = DefaultBatchConcurrency
+	}
+	if workers > len(reqs) {
+		workers = len(reqs)
+	}
+
+	var limiter *tokenBucket
+	if opts.RatePerSecond > 0 {
+		limiter = newTokenBucket(opts.RatePerSecond, opts.Burst)
+	}
+
+	var (
+		progressMu sync.Mutex
+		done       int
+	)
+	finish := func(i int, resp models.RiskAnalysisAPIResponse, err error) {
+		results[i] = BatchResult{Index: i, Response: resp, Err: err}
+		if opts.Progress != nil {
+			progressMu.Lock()
+			done++
+			opts.Progress(done, len(reqs))
+			progressMu.Unlock()
+		}
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if err := ctx.Err(); err != nil {
+					finish(i, models.RiskAnalysisAPIResponse{}, err)
+					continue
+				}
+				if limiter != nil {
+					if err := limiter.Wait(ctx); err != nil {
+						finish(i, models.RiskAnalysisAPIResponse{}, err)
+						continue
+					}
+				}
+				resp, err := c.AnalyzeRisk(ctx, reqs[i])
+				finish(i, resp, err)
+			}
+		}()
+	}
+
+	for i := range reqs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
@@ -0,0 +1,172 @@
+package cybersource_soap_dm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hugochinchilla79/cybersource_soap_dm/models"
+)
+
+// batchServer replies ACCEPT with the request's merchant reference code
+// after delay, tracking the largest number of requests in flight.
+type batchServer struct {
+	delay       func(ref string) time.Duration
+	inFlight    atomic.Int32
+	maxInFlight atomic.Int32
+	calls       atomic.Int32
+}
+
+func (s *batchServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	var ref string
+	if m := referenceCodePattern.FindSubmatch(body); m != nil {
+		ref = string(m[1])
+	}
+	s.calls.Add(1)
+	n := s.inFlight.Add(1)
+	defer s.inFlight.Add(-1)
+	for {
+		max := s.maxInFlight.Load()
+		if n <= max || s.maxInFlight.CompareAndSwap(max, n) {
+			break
+		}
+	}
+	if s.delay != nil {
+		time.Sleep(s.delay(ref))
+	}
+	io.WriteString(w, strings.Replace(acceptReply, "cassette-1", ref, 1))
+}
+
+func newBatchClient(t *testing.T, s *batchServer) *Client {
+	t.Helper()
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	return newTestClient(t, Config{BaseURL: srv.URL, AllowInsecureHTTP: true})
+}
+
+func batchRequests(n int) []models.RiskAnalysisRequest {
+	reqs := make([]models.RiskAnalysisRequest, n)
+	for i := range reqs {
+		reqs[i] = testRequest(fmt.Sprintf("batch-%d", i))
+	}
+	return reqs
+}
+
+func TestAnalyzeRiskBatchOrder(t *testing.T) {
+	const n = 12
+	// Later requests answer sooner, so completion order is reversed.
+	s := &batchServer{delay: func(ref string) time.Duration {
+		var i int
+		fmt.Sscanf(ref, "batch-%d", &i)
+		return time.Duration(n-i) * time.Millisecond
+	}}
+	c := newBatchClient(t, s)
+
+	results := c.AnalyzeRiskBatch(context.Background(), batchRequests(n), BatchOptions{Concurrency: n})
+	if len(results) != n {
+		t.Fatalf("got %d results, want %d", len(results), n)
+	}
+	for i, r := range results {
+		want := fmt.Sprintf("batch-%d", i)
+		if r.Err != nil || r.Index != i || r.Response.Data.MerchantReferenceCode != want {
+			t.Errorf("results[%d] = index %d, ref %q, err %v; want index %d, ref %q", i, r.Index, r.Response.Data.MerchantReferenceCode, r.Err, i, want)
+		}
+	}
+}
+
+func TestAnalyzeRiskBatchConcurrency(t *testing.T) {
+	s := &batchServer{delay: func(string) time.Duration { return 20 * time.Millisecond }}
+	c := newBatchClient(t, s)
+
+	var (
+		mu       sync.Mutex
+		progress []int
+	)
+	results := c.AnalyzeRiskBatch(context.Background(), batchRequests(9), BatchOptions{
+		Concurrency: 3,
+		Progress: func(done, total int) {
+			mu.Lock()
+			defer mu.Unlock()
+			if total != 9 {
+				t.Errorf("Progress total = %d, want 9", total)
+			}
+			progress = append(progress, done)
+		},
+	})
+	for _, r := range results {
+		if r.Err != nil {
+			t.Fatal(r.Err)
+		}
+	}
+	if got := s.maxInFlight.Load(); got != 3 {
+		t.Errorf("max requests in flight = %d, want 3", got)
+	}
+	for i, done := range progress {
+		if done != i+1 {
+			t.Fatalf("Progress done sequence = %v, want 1..9", progress)
+		}
+	}
+	if len(progress) != 9 {
+		t.Errorf("Progress called %d times, want 9", len(progress))
+	}
+}
+
+func TestAnalyzeRiskBatchCancel(t *testing.T) {
+	s := &batchServer{}
+	c := newBatchClient(t, s)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	results := c.AnalyzeRiskBatch(ctx, batchRequests(8), BatchOptions{
+		Concurrency: 1,
+		Progress: func(done, total int) {
+			if done == 3 {
+				cancel()
+			}
+		},
+	})
+	for i, r := range results {
+		if i < 3 {
+			if r.Err != nil {
+				t.Errorf("results[%d].Err = %v, want a response from before the cancellation", i, r.Err)
+			}
+			continue
+		}
+		if !errors.Is(r.Err, context.Canceled) || r.Index != i {
+			t.Errorf("results[%d] = index %d, err %v; want context.Canceled", i, r.Index, r.Err)
+		}
+	}
+	if got := s.calls.Load(); got != 3 {
+		t.Errorf("server saw %d requests, want 3", got)
+	}
+}
+
+func TestAnalyzeRiskBatchRate(t *testing.T) {
+	s := &batchServer{}
+	c := newBatchClient(t, s)
+
+	start := time.Now()
+	results := c.AnalyzeRiskBatch(context.Background(), batchRequests(5), BatchOptions{
+		Concurrency:   5,
+		RatePerSecond: 50,
+		Burst:         1,
+	})
+	for _, r := range results {
+		if r.Err != nil {
+			t.Fatal(r.Err)
+		}
+	}
+	// One request starts at once, the other four wait 20ms each.
+	if elapsed := time.Since(start); elapsed < 70*time.Millisecond {
+		t.Errorf("5 requests at 50/s with burst 1 took %v, want about 80ms", elapsed)
+	}
+}
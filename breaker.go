@@ -0,0 +1,162 @@
+package cybersource_soap_dm
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/hugochinchilla79/cybersource_soap_dm/models"
+)
+
+// ErrCircuitOpen is returned while the circuit breaker is open and no
+// fallback decision is configured.
+var ErrCircuitOpen = errors.New("cybersource_soap_dm: circuit breaker open")
+
+// Default circuit breaker settings.
+const (
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = 30 * time.Second
+)
+
+// CircuitBreakerConfig configures the circuit breaker around AnalyzeRisk.
+//
+// The breaker opens after FailureThreshold consecutive failures, where a
+// failure is a transport error or an HTTP 5xx reply that is not a SOAP
+// fault. While open, requests are not sent. After Cooldown one trial
+// request is let through (half-open): success closes the breaker, failure
+// reopens it.
+type CircuitBreakerConfig struct {
+	// FailureThreshold is the number of consecutive failures that opens the
+	// breaker. Zero means DefaultBreakerThreshold.
+	FailureThreshold int
+
+	// Cooldown is how long the breaker stays open before a trial request.
+	// Zero means DefaultBreakerCooldown.
+	Cooldown time.Duration
+
+	// FallbackDecision is returned while the breaker is open, e.g.
+	// models.DecisionReview. When empty, AnalyzeRisk returns ErrCircuitOpen.
+	FallbackDecision string
+
+	// FallbackReasonCode is the synthetic reason code set on fallback responses.
+	FallbackReasonCode int
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// circuitBreaker tracks consecutive failures. A nil *circuitBreaker is
+// disabled and allows every request.
+type circuitBreaker struct {
+	cfg CircuitBreakerConfig
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+func newCircuitBreaker(cfg CircuitBreakerConfig) *circuitBreaker {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = DefaultBreakerThreshold
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = DefaultBreakerCooldown
+	}
+	return &circuitBreaker{cfg: cfg}
+}
+
+// allow reports whether a request may be sent. Every allowed request must
+// be followed by exactly one call to record or release.
+func (b *circuitBreaker) allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cfg.Cooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		b.trial = true
+		return true
+	case breakerHalfOpen:
+		// Only the single trial request goes through.
+		if b.trial {
+			return false
+		}
+		b.trial = true
+		return true
+	}
+	return true
+}
+
+// record reports the outcome of an allowed request.
+func (b *circuitBreaker) record(success bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if success {
+		b.state = breakerClosed
+		b.failures = 0
+		b.trial = false
+		return
+	}
+
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.cfg.FailureThreshold {
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+		b.trial = false
+	}
+}
+
+// release gives back an allowed request without an outcome, e.g. when the
+// caller cancelled it. A half-open breaker lets the next request be the trial.
+func (b *circuitBreaker) release() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerHalfOpen {
+		b.trial = false
+	}
+}
+
+// isServerFailure reports whether a reply error counts against the breaker:
+// HTTP 5xx replies that are not SOAP faults. SOAP faults and 4xx replies
+// mean CyberSource is up and answering.
+func isServerFailure(err error) bool {
+	var httpErr *HTTPError
+	return errors.As(err, &httpErr) && httpErr.StatusCode >= 500
+}
+
+// breakerFallback returns the configured fallback decision while the
+// breaker is open, or ErrCircuitOpen when none is configured.
+func (c *Client) breakerFallback(merchantReferenceCode string) (models.RiskAnalysisAPIResponse, error) {
+	if c.breaker.cfg.FallbackDecision == "" {
+		return models.RiskAnalysisAPIResponse{}, ErrCircuitOpen
+	}
+	return models.RiskAnalysisAPIResponse{
+		Data: models.RiskAnalysisResponse{
+			Decision:              c.breaker.cfg.FallbackDecision,
+			ReasonCode:            c.breaker.cfg.FallbackReasonCode,
+			MerchantReferenceCode: merchantReferenceCode,
+			Fallback:              true,
+		},
+	}, nil
+}
@@ -0,0 +1,215 @@
+package cybersource_soap_dm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hugochinchilla79/cybersource_soap_dm/models"
+)
+
+func TestCircuitBreakerOpensAfterThreshold(t *testing.T) {
+	b := newCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 3, Cooldown: time.Hour})
+	for i := 0; i < 2; i++ {
+		if !b.allow() {
+			t.Fatalf("request %d refused before the threshold", i+1)
+		}
+		b.record(false)
+	}
+	// A success resets the count of consecutive failures.
+	b.allow()
+	b.record(true)
+	for i := 0; i < 3; i++ {
+		if !b.allow() {
+			t.Fatalf("request %d after a success refused", i+1)
+		}
+		b.record(false)
+	}
+	if b.allow() {
+		t.Fatal("breaker allowed a request after 3 consecutive failures")
+	}
+}
+
+func TestCircuitBreakerHalfOpen(t *testing.T) {
+	const cooldown = 10 * time.Millisecond
+	open := func(t *testing.T) *circuitBreaker {
+		t.Helper()
+		b := newCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1, Cooldown: cooldown})
+		b.allow()
+		b.record(false)
+		if b.allow() {
+			t.Fatal("breaker allowed a request while open")
+		}
+		time.Sleep(2 * cooldown)
+		return b
+	}
+
+	t.Run("trial success closes", func(t *testing.T) {
+		b := open(t)
+		if !b.allow() {
+			t.Fatal("no trial request after the cooldown")
+		}
+		if b.allow() {
+			t.Fatal("a second request went through while the trial was in flight")
+		}
+		b.record(true)
+		for i := 0; i < 3; i++ {
+			if !b.allow() {
+				t.Fatalf("request %d refused after a successful trial", i+1)
+			}
+			b.record(true)
+		}
+	})
+
+	t.Run("trial failure reopens", func(t *testing.T) {
+		b := open(t)
+		b.allow()
+		b.record(false)
+		if b.allow() {
+			t.Fatal("breaker allowed a request right after a failed trial")
+		}
+		time.Sleep(2 * cooldown)
+		if !b.allow() {
+			t.Fatal("no new trial after the second cooldown")
+		}
+	})
+
+	t.Run("released trial is retried", func(t *testing.T) {
+		b := open(t)
+		b.allow()
+		b.release()
+		if !b.allow() {
+			t.Fatal("no trial after the first one was released")
+		}
+		if b.allow() {
+			t.Fatal("two trials in flight")
+		}
+	})
+}
+
+func TestNilCircuitBreakerAllows(t *testing.T) {
+	var b *circuitBreaker
+	for i := 0; i < 10; i++ {
+		if !b.allow() {
+			t.Fatal("nil breaker refused a request")
+		}
+		b.record(false)
+	}
+	b.release()
+}
+
+// failingServer answers with HTTP 503 until healthy is set, then with
+// acceptReply.
+func failingServer(t *testing.T, healthy *atomic.Bool, calls *atomic.Int32) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if !healthy.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, acceptReply)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestAnalyzeRiskBreakerFallback(t *testing.T) {
+	var healthy atomic.Bool
+	var calls atomic.Int32
+	srv := failingServer(t, &healthy, &calls)
+
+	c := newTestClient(t, Config{
+		BaseURL:           srv.URL,
+		AllowInsecureHTTP: true,
+		CircuitBreaker: &CircuitBreakerConfig{
+			FailureThreshold:   2,
+			Cooldown:           time.Hour,
+			FallbackDecision:   models.DecisionReview,
+			FallbackReasonCode: 150,
+		},
+	})
+	for i := 0; i < 2; i++ {
+		var httpErr *HTTPError
+		if _, err := c.AnalyzeRisk(context.Background(), testRequest("breaker")); !errors.As(err, &httpErr) {
+			t.Fatalf("call %d error = %v, want *HTTPError", i+1, err)
+		}
+	}
+
+	healthy.Store(true)
+	resp, err := c.AnalyzeRisk(context.Background(), testRequest("breaker-open"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := models.RiskAnalysisResponse{
+		Decision:              models.DecisionReview,
+		ReasonCode:            150,
+		MerchantReferenceCode: "breaker-open",
+		Fallback:              true,
+	}
+	if resp.Data != want {
+		t.Errorf("fallback response = %+v, want %+v", resp.Data, want)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("server saw %d requests, want 2 (none while open)", got)
+	}
+}
+
+func TestAnalyzeRiskBreakerOpenWithoutFallback(t *testing.T) {
+	var healthy atomic.Bool
+	var calls atomic.Int32
+	srv := failingServer(t, &healthy, &calls)
+
+	c := newTestClient(t, Config{
+		BaseURL:           srv.URL,
+		AllowInsecureHTTP: true,
+		CircuitBreaker:    &CircuitBreakerConfig{FailureThreshold: 1, Cooldown: time.Hour},
+	})
+	c.AnalyzeRisk(context.Background(), testRequest("breaker"))
+	if _, err := c.AnalyzeRisk(context.Background(), testRequest("breaker")); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("error = %v, want ErrCircuitOpen", err)
+	}
+}
+
+func TestAnalyzeRiskBreakerIgnoresCancelledCalls(t *testing.T) {
+	arrived := make(chan struct{}, 1)
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			// Reading the body lets the server notice the client going away.
+			io.Copy(io.Discard, r.Body)
+			arrived <- struct{}{}
+			<-r.Context().Done()
+			return
+		}
+		io.WriteString(w, acceptReply)
+	}))
+	defer srv.Close()
+
+	c := newTestClient(t, Config{
+		BaseURL:           srv.URL,
+		AllowInsecureHTTP: true,
+		CircuitBreaker:    &CircuitBreakerConfig{FailureThreshold: 1, Cooldown: time.Hour},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-arrived
+		cancel()
+	}()
+	if _, err := c.AnalyzeRisk(ctx, testRequest("cancelled")); !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled call error = %v, want context.Canceled", err)
+	}
+
+	resp, err := c.AnalyzeRisk(context.Background(), testRequest("after-cancel"))
+	if err != nil {
+		t.Fatalf("call after a cancelled one: %v (cancellation counted as a failure)", err)
+	}
+	if resp.Data.Fallback || resp.Data.Decision != models.DecisionAccept {
+		t.Errorf("response = %+v, want ACCEPT from CyberSource", resp.Data)
+	}
+}
@@ -0,0 +1,365 @@
+package cybersource_soap_dm
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/beevik/etree"
+)
+
+// ErrCassetteMismatch is returned by a replaying Cassette when a request
+// does not match a recorded one.
+var ErrCassetteMismatch = errors.New("cybersource_soap_dm: request does not match cassette")
+
+// CassetteMode selects whether a Cassette records or replays.
+type CassetteMode int
+
+const (
+	// CassetteReplay serves recorded responses and never sends requests.
+	CassetteReplay CassetteMode = iota
+
+	// CassetteRecord sends every request and records the exchange,
+	// replacing the cassette file.
+	CassetteRecord
+
+	// CassetteAuto replays when the cassette file exists and records
+	// otherwise, so a test records once and replays from then on.
+	CassetteAuto
+)
+
+// CassetteMatch selects how a replaying Cassette pairs requests with
+// recorded exchanges. Both compare the SOAP Body with the signature,
+// timestamps, wsu:Id and clientLibrary, clientLibraryVersion and
+// clientEnvironment removed, and with account numbers masked as recorded.
+type CassetteMatch int
+
+const (
+	// CassetteMatchStrict requires the requests in recorded order, each
+	// exactly once.
+	CassetteMatchStrict CassetteMatch = iota
+
+	// CassetteMatchLenient also ignores merchantReferenceCode, accepts
+	// requests in any order and replays a recording again once every
+	// match has been used.
+	CassetteMatchLenient
+)
+
+// CassetteOptions configures OpenCassette.
+type CassetteOptions struct {
+	Mode  CassetteMode
+	Match CassetteMatch
+}
+
+// Cassette is an http.RoundTripper that records SOAP exchanges to a file,
+// or replays them, for deterministic integration tests. Recorded requests
+// have account numbers masked, transaction keys replaced and signature,
+// digest and BinarySecurityToken values removed; responses are stored as
+// received. Plug it into a client with Config.WrapTransport:
+//
+//	cassette, err := OpenCassette("testdata/accept.json", CassetteOptions{Mode: CassetteAuto})
+//	cfg.WrapTransport = cassette.Wrap
+//
+// A Cassette is safe for concurrent use.
+type Cassette struct {
+	path  string
+	match CassetteMatch
+
+	mu           sync.Mutex
+	recording    bool
+	transport    http.RoundTripper
+	interactions []cassetteInteraction
+	keys         []string // normalized recorded requests
+	used         []bool
+	next         int
+}
+
+type cassetteFile struct {
+	Interactions []cassetteInteraction `json:"interactions"`
+}
+
+type cassetteInteraction struct {
+	Request  cassetteRequest  `json:"request"`
+	Response cassetteResponse `json:"response"`
+}
+
+type cassetteRequest struct {
+	URL  string `json:"url"`
+	Body string `json:"body"`
+}
+
+type cassetteResponse struct {
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type,omitempty"`
+	Body        string `json:"body"`
+}
+
+// OpenCassette opens the cassette file at path. Replaying requires the
+// file to exist; recording creates it on the first exchange.
+func OpenCassette(path string, opts CassetteOptions) (*Cassette, error) {
+	c := &Cassette{path: path, match: opts.Match}
+	switch opts.Mode {
+	case CassetteRecord:
+		c.recording = true
+		return c, nil
+	case CassetteAuto:
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			c.recording = true
+			return c, nil
+		}
+	case CassetteReplay:
+	default:
+		return nil, fmt.Errorf("cybersource_soap_dm: unknown cassette mode %d", opts.Mode)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cybersource_soap_dm: open cassette: %w", err)
+	}
+	var file cassetteFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("cybersource_soap_dm: parse cassette %s: %w", path, err)
+	}
+	for i, in := range file.Interactions {
+		key, err := c.requestKey([]byte(in.Request.Body))
+		if err != nil {
+			return nil, fmt.Errorf("cybersource_soap_dm: cassette %s: interaction %d: %w", path, i+1, err)
+		}
+		c.keys = append(c.keys, key)
+	}
+	c.interactions = file.Interactions
+	c.used = make([]bool, len(file.Interactions))
+	return c, nil
+}
+
+// Wrap sets the transport used for recording and returns the cassette,
+// for use as Config.WrapTransport.
+func (c *Cassette) Wrap(transport http.RoundTripper) http.RoundTripper {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.transport = transport
+	return c
+}
+
+// Recording reports whether the cassette records rather than replays.
+func (c *Cassette) Recording() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.recording
+}
+
+// Unused returns the number of recorded exchanges that have not been
+// replayed. Tests can check it is zero to catch requests that were
+// recorded but are no longer sent.
+func (c *Cassette) Unused() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, used := range c.used {
+		if !used {
+			n++
+		}
+	}
+	return n
+}
+
+// RoundTrip records or replays one exchange.
+func (c *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	c.mu.Lock()
+	recording, transport := c.recording, c.transport
+	c.mu.Unlock()
+	if recording {
+		return c.record(req, body, transport)
+	}
+	return c.replay(req, body)
+}
+
+func (c *Cassette) record(req *http.Request, body []byte, transport http.RoundTripper) (*http.Response, error) {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	out := req.Clone(req.Context())
+	out.Body = io.NopCloser(bytes.NewReader(body))
+	out.ContentLength = int64(len(body))
+	resp, err := transport.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	redacted, err := redactCassetteRequest(body)
+	if err != nil {
+		return nil, fmt.Errorf("cybersource_soap_dm: record cassette: %w", err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.interactions = append(c.interactions, cassetteInteraction{
+		Request: cassetteRequest{URL: req.URL.String(), Body: string(redacted)},
+		Response: cassetteResponse{
+			Status:      resp.StatusCode,
+			ContentType: resp.Header.Get("Content-Type"),
+			Body:        string(respBody),
+		},
+	})
+	if err := c.save(); err != nil {
+		return nil, fmt.Errorf("cybersource_soap_dm: record cassette: %w", err)
+	}
+	return resp, nil
+}
+
+// save writes every interaction recorded so far, so an interrupted test
+// keeps what it recorded. The caller holds c.mu.
+func (c *Cassette) save() error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(cassetteFile{Interactions: c.interactions}); err != nil {
+		return err
+	}
+	return os.WriteFile(c.path, buf.Bytes(), 0o644)
+}
+
+func (c *Cassette) replay(req *http.Request, body []byte) (*http.Response, error) {
+	key, err := c.requestKey(body)
+	if err != nil {
+		return nil, fmt.Errorf("cybersource_soap_dm: replay cassette: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	i, err := c.find(key)
+	if err != nil {
+		return nil, err
+	}
+	c.used[i] = true
+	rec := c.interactions[i].Response
+	resp := &http.Response{
+		Status:        fmt.Sprintf("%d %s", rec.Status, http.StatusText(rec.Status)),
+		StatusCode:    rec.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        make(http.Header),
+		Body:          io.NopCloser(strings.NewReader(rec.Body)),
+		ContentLength: int64(len(rec.Body)),
+		Request:       req,
+	}
+	if rec.ContentType != "" {
+		resp.Header.Set("Content-Type", rec.ContentType)
+	}
+	return resp, nil
+}
+
+// find returns the interaction to replay for a request key. The caller
+// holds c.mu.
+func (c *Cassette) find(key string) (int, error) {
+	if c.match == CassetteMatchStrict {
+		if c.next >= len(c.interactions) {
+			return 0, fmt.Errorf("%w: all %d recorded requests were already replayed", ErrCassetteMismatch, len(c.interactions))
+		}
+		i := c.next
+		if c.keys[i] != key {
+			return 0, fmt.Errorf("%w: request %d differs from the recording:\n%s", ErrCassetteMismatch, i+1, lineDiff(c.keys[i], key))
+		}
+		c.next++
+		return i, nil
+	}
+
+	reuse := -1
+	for i, k := range c.keys {
+		if k != key {
+			continue
+		}
+		if !c.used[i] {
+			return i, nil
+		}
+		reuse = i
+	}
+	if reuse < 0 {
+		return 0, fmt.Errorf("%w: no recorded request matches:\n%s", ErrCassetteMismatch, key)
+	}
+	return reuse, nil
+}
+
+// requestKey returns the normalized SOAP Body of a request, as compared
+// when replaying.
+func (c *Cassette) requestKey(envelope []byte) (string, error) {
+	redacted, err := redactEnvelope(envelope, nil)
+	if err != nil {
+		return "", err
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(redacted); err != nil {
+		return "", err
+	}
+	body := findChild(doc.Root(), "Body")
+	if body == nil {
+		return "", fmt.Errorf("soap Body not found")
+	}
+	body = body.Copy()
+	if id := body.SelectAttr("wsu:Id"); id != nil {
+		body.RemoveAttr(id.FullKey())
+	}
+	if msg := findChild(body, "requestMessage"); msg != nil {
+		ignored := []string{"clientLibrary", "clientLibraryVersion", "clientEnvironment"}
+		if c.match == CassetteMatchLenient {
+			ignored = append(ignored, "merchantReferenceCode")
+		}
+		for _, name := range ignored {
+			if el := findChild(msg, name); el != nil {
+				msg.RemoveChild(el)
+			}
+		}
+	}
+
+	out := etree.NewDocument()
+	out.SetRoot(body)
+	out.Indent(2)
+	return out.WriteToString()
+}
+
+// redactCassetteRequest redacts a request envelope for storage: account
+// numbers and transaction keys as redactEnvelope does, plus the signature,
+// digest and certificate values.
+func redactCassetteRequest(envelope []byte) ([]byte, error) {
+	redacted, err := redactEnvelope(envelope, nil)
+	if err != nil {
+		return nil, err
+	}
+	doc := etree.NewDocument()
+	doc.ReadSettings.PreserveCData = true
+	if err := doc.ReadFromBytes(redacted); err != nil {
+		return nil, err
+	}
+	if security := findPath(doc.Root(), "Header", "Security"); security != nil {
+		for _, el := range security.FindElements(".//*") {
+			switch el.Tag {
+			case "BinarySecurityToken", "SignatureValue", "DigestValue":
+				el.SetText(redactedValue)
+			}
+		}
+	}
+	return doc.WriteToBytes()
+}
@@ -0,0 +1,130 @@
+package cybersource_soap_dm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/beevik/etree"
+	"github.com/hugochinchilla79/cybersource_soap_dm/models"
+)
+
+const acceptReply = `<?xml version="1.0" encoding="utf-8"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+<soap:Body><c:replyMessage xmlns:c="urn:schemas-cybersource-com:transaction-data-1.111">
+<c:merchantReferenceCode>cassette-1</c:merchantReferenceCode>
+<c:requestID>7000000000000000000001</c:requestID>
+<c:decision>ACCEPT</c:decision>
+<c:reasonCode>100</c:reasonCode>
+</c:replyMessage></soap:Body></soap:Envelope>`
+
+func TestCassetteRecordReplay(t *testing.T) {
+	var calls atomic.Int32
+	var sent atomic.Value // the last request body the server received
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		sent.Store(body)
+		w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+		io.WriteString(w, acceptReply)
+	}))
+	defer srv.Close()
+	path := filepath.Join(t.TempDir(), "accept.json")
+
+	analyze := func(mode CassetteMode, req models.RiskAnalysisRequest) (*Cassette, models.RiskAnalysisAPIResponse, error) {
+		t.Helper()
+		cassette, err := OpenCassette(path, CassetteOptions{Mode: mode})
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := newTestClient(t, Config{
+			BaseURL:           srv.URL,
+			AllowInsecureHTTP: true,
+			WrapTransport:     cassette.Wrap,
+		})
+		resp, err := c.AnalyzeRisk(context.Background(), req)
+		return cassette, resp, err
+	}
+
+	cassette, resp, err := analyze(CassetteAuto, testRequest("cassette-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cassette.Recording() {
+		t.Fatal("CassetteAuto without a file did not record")
+	}
+	if resp.Data.Decision != models.DecisionAccept {
+		t.Fatalf("recorded decision = %q, want ACCEPT", resp.Data.Decision)
+	}
+
+	recorded, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(sent.Load().([]byte)); err != nil {
+		t.Fatal(err)
+	}
+	secrets := map[string]string{"PAN": "4111111111111111"}
+	for _, el := range doc.FindElements("//*") {
+		switch el.Tag {
+		case "SignatureValue", "BinarySecurityToken", "DigestValue":
+			secrets[el.Tag] = strings.TrimSpace(el.Text())
+		}
+	}
+	if len(secrets) != 4 {
+		t.Fatalf("sent request is missing signature elements: %v", secrets)
+	}
+	for name, secret := range secrets {
+		if strings.Contains(string(recorded), secret) {
+			t.Errorf("cassette contains the %s value", name)
+		}
+	}
+	if !strings.Contains(string(recorded), "411111******1111") {
+		t.Error("cassette does not contain the masked card number")
+	}
+
+	cassette, resp, err = analyze(CassetteAuto, testRequest("cassette-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cassette.Recording() {
+		t.Fatal("CassetteAuto with a file did not replay")
+	}
+	if resp.Data.Decision != models.DecisionAccept || resp.Data.RequestID != "7000000000000000000001" {
+		t.Errorf("replayed reply = %+v, want the recorded ACCEPT", resp.Data)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("server saw %d requests, want 1", n)
+	}
+	if n := cassette.Unused(); n != 0 {
+		t.Errorf("Unused() = %d, want 0", n)
+	}
+
+	changed := testRequest("cassette-1")
+	changed.PurchaseTotals.GrandTotalAmount = models.MustParseAmount("99.00")
+	if _, _, err := analyze(CassetteReplay, changed); !errors.Is(err, ErrCassetteMismatch) {
+		t.Errorf("replaying a different request: err = %v, want ErrCassetteMismatch", err)
+	}
+}
+
+func TestOpenCassetteRequestWithoutBody(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad.json")
+	data := `{"interactions": [{"request": {"url": "https://example.com",
+		"body": "<soap:Envelope xmlns:soap=\"http://schemas.xmlsoap.org/soap/envelope/\"><soap:Header/></soap:Envelope>"},
+		"response": {"status": 200, "body": ""}}]}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := OpenCassette(path, CassetteOptions{Mode: CassetteReplay})
+	if err == nil || !strings.Contains(err.Error(), "Body not found") {
+		t.Fatalf("err = %v, want a missing Body error", err)
+	}
+}
@@ -1,14 +1,15 @@
 package cybersource_soap_dm
 
 import (
-	"bytes"
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/xml"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"runtime"
+	"slices"
 	"strings"
 	"time"
 
@@ -19,99 +20,368 @@ import (
 type Client struct {
 	cfg        Config
 	httpClient *http.Client
-	soapURL    string
+	endpoints  *endpointPool
 	tlsCert    tls.Certificate
+	limiter    *tokenBucket
+	inFlight   chan struct{}
+	breaker    *circuitBreaker
+	telemetry  Telemetry
 }
 
 // NewClient creates a new Decision Manager SOAP client.
 // It validates the configuration, loads the P12 certificate, and prepares
 // a TLS-configured HTTP client.
 func NewClient(cfg Config) (*Client, error) {
+	return newClient(cfg, nil)
+}
+
+// credential is a loaded certificate and the HTTP transport using it.
+type credential struct {
+	tlsCert   tls.Certificate
+	transport *http.Transport
+}
+
+// newClient creates a client. Clients created with the same non-nil
+// credentials map share the loaded certificate and HTTP transport when
+// their credentials are the same.
+func newClient(cfg Config, credentials map[string]*credential) (*Client, error) {
 	if err := cfg.Validate(); err != nil {
 		return nil, err
 	}
 
-	tlsCert, err := loadP12Certificate(cfg.P12Path, cfg.P12Password)
-	if err != nil {
-		return nil, fmt.Errorf("cybersource_soap_dm: failed to load P12 certificate: %w", err)
+	key := ""
+	if cfg.authMode() == AuthCertificate {
+		key = expandHome(cfg.P12Path) + "\x00" + cfg.P12Password
+	}
+	cred := credentials[key]
+	if cred == nil {
+		var err error
+		if cred, err = loadCredential(cfg); err != nil {
+			return nil, err
+		}
+		if credentials != nil {
+			credentials[key] = cred
+		}
+	}
+	tlsCert := cred.tlsCert
+	if tlsCert.Leaf != nil {
+		if err := cfg.Signing.Validate(tlsCert.Leaf.PublicKey); err != nil {
+			return nil, fmt.Errorf("cybersource_soap_dm: signing options: %w", err)
+		}
 	}
 
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	var transport http.RoundTripper = cred.transport
+	if cfg.WrapTransport != nil {
+		transport = cfg.WrapTransport(transport)
+	}
 	httpClient := &http.Client{
-		Timeout: 30 * time.Second,
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				Certificates: []tls.Certificate{tlsCert},
-			},
-		},
+		Timeout:   timeout,
+		Transport: transport,
 	}
 
-	return &Client{
+	c := &Client{
 		cfg:        cfg,
 		httpClient: httpClient,
-		soapURL:    cfg.DefaultBaseURL(),
+		endpoints:  newEndpointPool(cfg.EndpointURLs(), cfg.EndpointCooldown),
 		tlsCert:    tlsCert,
+	}
+	if cfg.RateLimit > 0 {
+		c.limiter = newTokenBucket(cfg.RateLimit, cfg.RateBurst)
+	}
+	if cfg.MaxInFlight > 0 {
+		c.inFlight = make(chan struct{}, cfg.MaxInFlight)
+	}
+	c.telemetry = cfg.Telemetry
+	if c.telemetry == nil {
+		c.telemetry = NoopTelemetry{}
+	}
+	if cfg.CircuitBreaker != nil {
+		c.breaker = newCircuitBreaker(*cfg.CircuitBreaker)
+	}
+	return c, nil
+}
+
+// loadCredential loads the P12 certificate and creates a TLS transport
+// presenting it. Transaction key mode authenticates in the SOAP header
+// only and needs no client certificate.
+func loadCredential(cfg Config) (*credential, error) {
+	var tlsCert tls.Certificate
+	var clientCerts []tls.Certificate
+	if cfg.authMode() == AuthCertificate {
+		var err error
+		tlsCert, err = loadP12Certificate(cfg.P12Path, cfg.P12Password)
+		if err != nil {
+			return nil, fmt.Errorf("cybersource_soap_dm: failed to load P12 certificate: %w", err)
+		}
+		clientCerts = []tls.Certificate{tlsCert}
+	}
+	return &credential{
+		tlsCert: tlsCert,
+		transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				Certificates: clientCerts,
+			},
+		},
 	}, nil
 }
 
+// Certificate returns the leaf certificate loaded from the P12 file, which
+// is used for TLS and for signing requests. It is nil with AuthTransactionKey.
+func (c *Client) Certificate() *x509.Certificate {
+	return c.tlsCert.Leaf
+}
+
 // AnalyzeRisk performs a risk analysis request against CyberSource Decision Manager.
 func (c *Client) AnalyzeRisk(ctx context.Context, req models.RiskAnalysisRequest) (models.RiskAnalysisAPIResponse, error) {
-	// Build SOAP envelope
-	envelope := c.buildSOAPRequest(req)
+	ctx, span := c.telemetry.StartSpan(ctx, SpanAnalyzeRisk)
+	start := time.Now()
 
-	xmlData, err := xml.MarshalIndent(envelope, "", "  ")
-	if err != nil {
-		return models.RiskAnalysisAPIResponse{}, fmt.Errorf("cybersource_soap_dm: marshal SOAP request: %w", err)
+	resp, signed, err := c.analyzeRisk(ctx, req)
+
+	stats := newCallStats(resp, err, time.Since(start))
+	stats.annotate(span)
+	span.End()
+	c.telemetry.RecordCall(ctx, stats)
+	c.logCall(ctx, req, stats)
+
+	// Audit the merchant the request was sent for: a meta key child, not
+	// the portfolio merchant. A request for an unknown merchant fails
+	// validation and is recorded under the ID it asked for.
+	merchantID, merr := c.merchantIDFor(req)
+	if merr != nil {
+		merchantID = req.MerchantID
 	}
+	return resp, c.audit(ctx, start, merchantID, req, signed, resp, err)
+}
 
-	xmlPayload := []byte(xml.Header + string(xmlData))
+// analyzeRisk runs one call and also returns the signed envelope, which is
+// nil when the call failed before signing.
+func (c *Client) analyzeRisk(ctx context.Context, req models.RiskAnalysisRequest) (models.RiskAnalysisAPIResponse, []byte, error) {
+	buildCtx, span := c.telemetry.StartSpan(ctx, SpanBuild)
+	payload, err := c.buildPayload(buildCtx, req)
+	endSpan(span, err)
+	if err != nil {
+		return models.RiskAnalysisAPIResponse{}, nil, err
+	}
 
 	// Sign the envelope (inject wsse:Security header with BinarySecurityToken + ds:Signature)
-	signedPayload, err := signSOAPEnvelope(xmlPayload, c.tlsCert)
+	_, span = c.telemetry.StartSpan(ctx, SpanSign)
+	signedPayload, err := c.sign(payload)
+	endSpan(span, err)
+	if err != nil {
+		return models.RiskAnalysisAPIResponse{}, nil, err
+	}
+
+	if c.cfg.DryRun {
+		redacted, err := redactEnvelope(signedPayload, c.cfg.MDDSchema)
+		if err != nil {
+			return models.RiskAnalysisAPIResponse{}, signedPayload, fmt.Errorf("cybersource_soap_dm: redact dry-run request: %w", err)
+		}
+		return models.RiskAnalysisAPIResponse{RequestXML: redacted, DryRun: true}, signedPayload, nil
+	}
+
+	resp, err := c.deliver(ctx, signedPayload, req.MerchantReferenceCode)
+	return resp, signedPayload, err
+}
+
+// BuildSignedRequest validates, builds and signs a request without sending
+// it, and returns the signed SOAP envelope exactly as AnalyzeRisk would
+// send it. The envelope contains the full PAN, and with AuthTransactionKey
+// the transaction key; redact before logging it.
+// BeforeBuild and AfterBuild hooks run with context.Background().
+func (c *Client) BuildSignedRequest(req models.RiskAnalysisRequest) ([]byte, error) {
+	payload, err := c.buildPayload(context.Background(), req)
 	if err != nil {
-		return models.RiskAnalysisAPIResponse{}, fmt.Errorf("cybersource_soap_dm: sign SOAP request: %w", err)
+		return nil, err
 	}
+	return c.sign(payload)
+}
 
-	// Send HTTP request
-	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.soapURL, bytes.NewReader(signedPayload))
+// SendRaw sends an already signed SOAP envelope, e.g. one captured with
+// BuildSignedRequest, and parses the reply. The envelope is sent as-is;
+// rate limits, circuit breaker, failover and the BeforeSend, AfterReceive
+// and AfterParse hooks apply as for AnalyzeRisk.
+func (c *Client) SendRaw(ctx context.Context, signedXML []byte) (models.RiskAnalysisAPIResponse, error) {
+	return c.deliver(ctx, signedXML, "")
+}
+
+// deliver sends a signed envelope and parses the reply.
+// merchantReferenceCode is echoed on circuit breaker fallback responses.
+func (c *Client) deliver(ctx context.Context, signedPayload []byte, merchantReferenceCode string) (models.RiskAnalysisAPIResponse, error) {
+	if err := c.runBeforeSend(ctx, signedPayload); err != nil {
+		return models.RiskAnalysisAPIResponse{}, err
+	}
+
+	if !c.breaker.allow() {
+		return c.breakerFallback(merchantReferenceCode)
+	}
+
+	release, err := c.acquire(ctx)
+	if err != nil {
+		c.breaker.release()
+		return models.RiskAnalysisAPIResponse{}, err
+	}
+	defer release()
+
+	httpCtx, span := c.telemetry.StartSpan(ctx, SpanHTTP)
+	reply, err := c.send(httpCtx, signedPayload)
+	if reply.Status != 0 {
+		span.SetAttribute(AttrHTTPStatus, reply.Status)
+	}
+	endSpan(span, err)
 	if err != nil {
-		return models.RiskAnalysisAPIResponse{}, fmt.Errorf("cybersource_soap_dm: create HTTP request: %w", err)
+		if ctx.Err() != nil {
+			// Cancelled by the caller; says nothing about CyberSource health.
+			c.breaker.release()
+		} else {
+			c.breaker.record(false)
+		}
+		return models.RiskAnalysisAPIResponse{Endpoint: reply.Endpoint}, err
+	}
+
+	if err := c.runAfterReceive(ctx, reply.Status, reply.Body); err != nil {
+		// The reply was never judged, so it says nothing about CyberSource health.
+		c.breaker.release()
+		return models.RiskAnalysisAPIResponse{Endpoint: reply.Endpoint}, err
 	}
-	httpReq.Header.Set("Content-Type", "text/xml; charset=utf-8")
-	httpReq.Header.Set("SOAPAction", "runTransaction")
 
-	resp, err := c.httpClient.Do(httpReq)
+	_, span = c.telemetry.StartSpan(ctx, SpanParse)
+	apiResp, err := parseSOAPResponse(reply.Status, reply.Body)
+	endSpan(span, err)
+	apiResp.Endpoint = reply.Endpoint
+	c.breaker.record(!isServerFailure(err))
 	if err != nil {
-		return models.RiskAnalysisAPIResponse{}, fmt.Errorf("cybersource_soap_dm: send SOAP request: %w", err)
+		return apiResp, err
 	}
-	defer resp.Body.Close()
+	if err := c.runAfterParse(ctx, &apiResp); err != nil {
+		return apiResp, err
+	}
+	return apiResp, nil
+}
 
-	respBody, err := io.ReadAll(resp.Body)
+// unsignedPayload is a built request ready for signing. xml holds the
+// unsigned SOAP XML when AfterBuild hooks ran and may have rewritten it;
+// otherwise it is nil and the envelope is signed directly.
+type unsignedPayload struct {
+	envelope soapEnvelope
+	xml      []byte
+}
 
-	fmt.Printf("Body Response %s", respBody)
+// buildPayload runs the BeforeBuild and AfterBuild hooks around validating
+// and building the request. The envelope is only marshalled here when
+// AfterBuild hooks need to see it.
+func (c *Client) buildPayload(ctx context.Context, req models.RiskAnalysisRequest) (unsignedPayload, error) {
+	if err := c.runBeforeBuild(ctx, &req); err != nil {
+		return unsignedPayload{}, err
+	}
 
+	mdd, err := c.validateRequest(req)
 	if err != nil {
-		return models.RiskAnalysisAPIResponse{}, fmt.Errorf("cybersource_soap_dm: read response: %w", err)
+		return unsignedPayload{}, fmt.Errorf("cybersource_soap_dm: validate request: %w", err)
 	}
 
-	// Parse SOAP response
-	var soapResp soapResponseEnvelope
-	if err := xml.Unmarshal(respBody, &soapResp); err != nil {
-		return models.RiskAnalysisAPIResponse{
-			HTTPStatus: resp.StatusCode,
-			Body:       respBody,
-		}, fmt.Errorf("cybersource_soap_dm: parse SOAP response (HTTP %d): %w", resp.StatusCode, err)
+	// Build SOAP envelope
+	envelope, err := c.buildSOAPRequest(req, mdd)
+	if err != nil {
+		return unsignedPayload{}, fmt.Errorf("cybersource_soap_dm: build SOAP request: %w", err)
+	}
+	if !c.hasAfterBuildHooks() {
+		return unsignedPayload{envelope: envelope}, nil
 	}
 
-	// Check for SOAP fault
-	if soapResp.Body.Fault != nil {
-		return models.RiskAnalysisAPIResponse{
-				HTTPStatus: resp.StatusCode,
-				Body:       respBody,
-			}, &SOAPFault{
-				FaultCode:   soapResp.Body.Fault.FaultCode,
-				FaultString: strings.TrimSpace(soapResp.Body.Fault.FaultString),
-				RawBody:     respBody,
+	xmlData, err := marshalEnvelope(envelope)
+	if err != nil {
+		return unsignedPayload{}, err
+	}
+	xmlData, err = c.runAfterBuild(ctx, xmlData)
+	if err != nil {
+		return unsignedPayload{}, err
+	}
+	return unsignedPayload{envelope: envelope, xml: xmlData}, nil
+}
+
+// sign signs a built payload, or adds the UsernameToken with
+// AuthTransactionKey. With SigningOptions.Streaming, envelopes not
+// rewritten by hooks and signed with otherwise default options go through
+// the streaming signer; everything else through the DOM-based
+// signSOAPEnvelope, which produces the same bytes for the default options.
+func (c *Client) sign(p unsignedPayload) ([]byte, error) {
+	xmlData := p.xml
+	if c.cfg.authMode() == AuthTransactionKey {
+		if xmlData == nil {
+			var err error
+			if xmlData, err = marshalEnvelope(p.envelope); err != nil {
+				return nil, err
 			}
+		}
+		authenticated, err := addUsernameToken(xmlData, c.cfg.MerchantID, c.cfg.TransactionKey)
+		if err != nil {
+			return nil, fmt.Errorf("cybersource_soap_dm: add UsernameToken: %w", err)
+		}
+		return authenticated, nil
+	}
+	if xmlData == nil && c.cfg.Signing.Streaming && c.cfg.Signing.isDefault() {
+		signed, err := signRequestMessage(p.envelope.Body.RequestMessage, c.tlsCert)
+		if err == nil {
+			return signed, nil
+		}
+		if !errors.Is(err, errFastPathUnsupported) {
+			return nil, fmt.Errorf("cybersource_soap_dm: sign SOAP request: %w", err)
+		}
+	}
+	if xmlData == nil {
+		var err error
+		if xmlData, err = marshalEnvelope(p.envelope); err != nil {
+			return nil, err
+		}
+	}
+	signed, err := signSOAPEnvelope(xmlData, c.tlsCert, c.cfg.Signing)
+	if err != nil {
+		return nil, fmt.Errorf("cybersource_soap_dm: sign SOAP request: %w", err)
+	}
+	return signed, nil
+}
+
+func marshalEnvelope(envelope soapEnvelope) ([]byte, error) {
+	xmlData, err := xml.MarshalIndent(envelope, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("cybersource_soap_dm: marshal SOAP request: %w", err)
+	}
+	return []byte(xml.Header + string(xmlData)), nil
+}
+
+// parseSOAPResponse turns a CyberSource reply into the API response model.
+// SOAP faults are returned as *SOAPFault and other non-2xx replies as *HTTPError.
+func parseSOAPResponse(status int, respBody []byte) (models.RiskAnalysisAPIResponse, error) {
+	apiResp := models.RiskAnalysisAPIResponse{
+		HTTPStatus: status,
+		Body:       respBody,
+	}
+
+	var soapResp soapResponseEnvelope
+	parseErr := xml.Unmarshal(respBody, &soapResp)
+
+	// Check for SOAP fault
+	if parseErr == nil && soapResp.Body.Fault != nil {
+		return apiResp, &SOAPFault{
+			FaultCode:   soapResp.Body.Fault.FaultCode,
+			FaultString: strings.TrimSpace(soapResp.Body.Fault.FaultString),
+			RawBody:     respBody,
+		}
+	}
+	if status < 200 || status > 299 {
+		return apiResp, &HTTPError{
+			StatusCode: status,
+			Status:     http.StatusText(status),
+			Body:       respBody,
+		}
+	}
+	if parseErr != nil {
+		return apiResp, fmt.Errorf("cybersource_soap_dm: parse SOAP response (HTTP %d): %w", status, parseErr)
 	}
 
 	reply := soapResp.Body.ReplyMessage
@@ -143,17 +413,19 @@ func (c *Client) AnalyzeRisk(ctx context.Context, req models.RiskAnalysisRequest
 		}
 	}
 
-	return models.RiskAnalysisAPIResponse{
-		HTTPStatus: resp.StatusCode,
-		Body:       respBody,
-		Data:       result,
-	}, nil
+	apiResp.Data = result
+	return apiResp, nil
 }
 
-// buildSOAPRequest transforms the user-facing request model into SOAP XML structures.
-func (c *Client) buildSOAPRequest(req models.RiskAnalysisRequest) soapEnvelope {
+// buildSOAPRequest transforms the user-facing request model into SOAP XML
+// structures. mdd is the merchant-defined data validateRequest resolved.
+func (c *Client) buildSOAPRequest(req models.RiskAnalysisRequest, mdd map[int]string) (soapEnvelope, error) {
+	merchantID, err := c.merchantIDFor(req)
+	if err != nil {
+		return soapEnvelope{}, err
+	}
 	msg := requestMessage{
-		MerchantID:            c.cfg.MerchantID,
+		MerchantID:            merchantID,
 		MerchantReferenceCode: req.MerchantReferenceCode,
 		ClientLibrary:         "Go",
 		ClientLibraryVersion:  runtime.Version(),
@@ -162,6 +434,13 @@ func (c *Client) buildSOAPRequest(req models.RiskAnalysisRequest) soapEnvelope {
 		DeviceFingerprintID:   req.DeviceFingerprintID,
 	}
 
+	if profile := req.DecisionManagerProfile; profile != "" || c.cfg.DecisionManagerProfile != "" {
+		if profile == "" {
+			profile = c.cfg.DecisionManagerProfile
+		}
+		msg.DecisionManager = &soapDecisionManager{Profile: profile}
+	}
+
 	if req.BillTo != nil {
 		msg.BillTo = &soapBillTo{
 			FirstName:   req.BillTo.FirstName,
@@ -178,45 +457,71 @@ func (c *Client) buildSOAPRequest(req models.RiskAnalysisRequest) soapEnvelope {
 		}
 	}
 
-	// Resolve card type: use explicit value or auto-detect from card number
-	cardType := req.Card.CardType
-	if cardType == "" {
-		brand := DetectCardBrand(req.Card.Number)
-		cardType = CyberSourceCardTypeCode[brand]
-	}
-
-	bin := ""
-	if len(req.Card.Number) >= 6 {
-		bin = req.Card.Number[:6]
+	paymentMethod, err := paymentMethodOf(req)
+	if err != nil {
+		return soapEnvelope{}, err
 	}
-
-	msg.Card = &soapCard{
-		AccountNumber:   req.Card.Number,
-		ExpirationMonth: req.Card.ExpirationMonth,
-		ExpirationYear:  req.Card.ExpirationYear,
-		CardType:        cardType,
-		Bin:             bin,
+	switch pm := paymentMethod.(type) {
+	case models.Card:
+		msg.Card = buildSOAPCard(pm)
+	case models.Check:
+		msg.Check = &soapCheck{
+			AccountNumber:     pm.AccountNumber,
+			AccountType:       pm.AccountType,
+			BankTransitNumber: pm.BankTransitNumber,
+			CheckNumber:       pm.CheckNumber,
+			SecCode:           pm.SecCode,
+		}
+	case models.PayPal:
+		msg.PayPal = &soapPayPal{
+			PayerID:     pm.PayerID,
+			PayerEmail:  pm.PayerEmail,
+			PayerStatus: pm.PayerStatus,
+		}
+	case models.GiftCard:
+		msg.GiftCard = &soapGiftCard{
+			AccountNumber:   pm.Number,
+			ExpirationMonth: pm.ExpirationMonth,
+			ExpirationYear:  pm.ExpirationYear,
+		}
+	default:
+		return soapEnvelope{}, fmt.Errorf("cybersource_soap_dm: unsupported payment method %T", pm)
 	}
 
+	currency := req.PurchaseTotals.Currency
 	for i, item := range req.Items {
+		giftCategory := ""
+		if item.GiftCategory {
+			giftCategory = "true"
+		}
 		msg.Items = append(msg.Items, soapItem{
-			ID:          i,
-			UnitPrice:   item.UnitPrice,
-			Quantity:    item.Quantity,
-			ProductCode: item.ProductCode,
-			ProductName: item.ProductName,
-			ProductSKU:  item.ProductSKU,
+			ID:               i,
+			UnitPrice:        item.UnitPrice.Format(currency),
+			Quantity:         item.Quantity,
+			ProductCode:      item.ProductCode,
+			ProductName:      item.ProductName,
+			ProductSKU:       item.ProductSKU,
+			ProductRisk:      item.ProductRisk,
+			TaxAmount:        formatOptionalAmount(item.TaxAmount, currency),
+			GiftCategory:     giftCategory,
+			TimeCategory:     item.TimeCategory,
+			HostHedge:        item.HostHedge,
+			TimeHedge:        item.TimeHedge,
+			VelocityHedge:    item.VelocityHedge,
+			NonsensicalHedge: item.NonsensicalHedge,
+			TotalAmount:      formatOptionalAmount(item.TotalAmount, currency),
+			DiscountAmount:   formatOptionalAmount(item.DiscountAmount, currency),
 		})
 	}
 
 	msg.PurchaseTotals = &soapPurchase{
 		Currency:         req.PurchaseTotals.Currency,
-		GrandTotalAmount: req.PurchaseTotals.GrandTotalAmount,
+		GrandTotalAmount: req.PurchaseTotals.GrandTotalAmount.Format(currency),
 	}
 
-	if len(req.MerchantDefinedData) > 0 {
+	if len(mdd) > 0 {
 		msg.MerchantDefinedData = &soapMDD{
-			Fields: req.MerchantDefinedData,
+			Fields: mdd,
 		}
 	}
 
@@ -226,5 +531,83 @@ func (c *Client) buildSOAPRequest(req models.RiskAnalysisRequest) soapEnvelope {
 		Body: soapBody{
 			RequestMessage: msg,
 		},
+	}, nil
+}
+
+// merchantIDFor returns the merchant ID a request is sent for: the
+// request's MerchantID when it is the configured merchant or one of its
+// meta key children, otherwise Config.MerchantID.
+func (c *Client) merchantIDFor(req models.RiskAnalysisRequest) (string, error) {
+	if req.MerchantID == "" || req.MerchantID == c.cfg.MerchantID {
+		return c.cfg.MerchantID, nil
+	}
+	if slices.Contains(c.cfg.ChildMerchantIDs, req.MerchantID) {
+		return req.MerchantID, nil
+	}
+	return "", &models.ValidationError{Field: "merchantID", Message: fmt.Sprintf("%q is not configured for this client", req.MerchantID)}
+}
+
+// formatOptionalAmount formats an optional amount for the currency,
+// returning "" for the zero value so the element is omitted.
+func formatOptionalAmount(a models.Amount, currency string) string {
+	if a.IsZero() {
+		return ""
+	}
+	return a.Format(currency)
+}
+
+// paymentMethodOf returns the payment instrument to screen: the explicit
+// PaymentMethod when set, otherwise the Card. Pointers to the payment types
+// also satisfy models.PaymentMethod and are dereferenced; a nil pointer or
+// a type this package cannot encode is a *models.ValidationError.
+func paymentMethodOf(req models.RiskAnalysisRequest) (models.PaymentMethod, error) {
+	switch pm := req.PaymentMethod.(type) {
+	case nil:
+		return req.Card, nil
+	case models.Card, models.Check, models.PayPal, models.GiftCard:
+		return pm, nil
+	case *models.Card:
+		if pm != nil {
+			return *pm, nil
+		}
+	case *models.Check:
+		if pm != nil {
+			return *pm, nil
+		}
+	case *models.PayPal:
+		if pm != nil {
+			return *pm, nil
+		}
+	case *models.GiftCard:
+		if pm != nil {
+			return *pm, nil
+		}
+	}
+	return nil, &models.ValidationError{
+		Field:   "paymentMethod",
+		Message: fmt.Sprintf("unsupported payment method %T", req.PaymentMethod),
+	}
+}
+
+// buildSOAPCard maps a card to its SOAP structure, resolving the card type
+// and BIN from the card number when not given explicitly.
+func buildSOAPCard(card models.Card) *soapCard {
+	cardType := card.CardType
+	if cardType == "" {
+		brand := DetectCardBrand(card.Number)
+		cardType = CyberSourceCardTypeCode[brand]
+	}
+
+	bin := ""
+	if len(card.Number) >= 6 {
+		bin = card.Number[:6]
+	}
+
+	return &soapCard{
+		AccountNumber:   card.Number,
+		ExpirationMonth: card.ExpirationMonth,
+		ExpirationYear:  card.ExpirationYear,
+		CardType:        cardType,
+		Bin:             bin,
 	}
 }
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	cybs "github.com/hugochinchilla79/cybersource_soap_dm"
+	"github.com/hugochinchilla79/cybersource_soap_dm/models"
+)
+
+func decodeRequest(args []string, stdin io.Reader) (models.RiskAnalysisRequest, error) {
+	var req models.RiskAnalysisRequest
+	data, err := readInput(args, stdin)
+	if err != nil {
+		return req, err
+	}
+	if err := json.Unmarshal(data, &req); err != nil {
+		return req, fmt.Errorf("decode request: %w", err)
+	}
+	return req, nil
+}
+
+// analyzeOutput is the JSON printed by analyze.
+type analyzeOutput struct {
+	Decision              string     `json:"decision"`
+	ReasonCode            int        `json:"reason_code"`
+	Reason                string     `json:"reason,omitempty"`
+	RequestID             string     `json:"request_id,omitempty"`
+	RequestToken          string     `json:"request_token,omitempty"`
+	MerchantReferenceCode string     `json:"merchant_reference_code,omitempty"`
+	Fallback              bool       `json:"fallback,omitempty"`
+	AFS                   *afsOutput `json:"afs,omitempty"`
+	HTTPStatus            int        `json:"http_status,omitempty"`
+	Endpoint              string     `json:"endpoint,omitempty"`
+	DryRun                bool       `json:"dry_run,omitempty"`
+	RequestXML            string     `json:"request_xml,omitempty"`
+}
+
+type afsOutput struct {
+	ReasonCode          int          `json:"reason_code"`
+	Score               string       `json:"score,omitempty"`
+	HostSeverity        string       `json:"host_severity,omitempty"`
+	Factors             []codeOutput `json:"factors,omitempty"`
+	AddressInfoCodes    []codeOutput `json:"address_info_codes,omitempty"`
+	SuspiciousInfoCodes []codeOutput `json:"suspicious_info_codes,omitempty"`
+	IPCountry           string       `json:"ip_country,omitempty"`
+	IPState             string       `json:"ip_state,omitempty"`
+	IPCity              string       `json:"ip_city,omitempty"`
+	IPRoutingMethod     string       `json:"ip_routing_method,omitempty"`
+	ScoreModelUsed      string       `json:"score_model_used,omitempty"`
+	BinCountry          string       `json:"bin_country,omitempty"`
+	CardScheme          string       `json:"card_scheme,omitempty"`
+	CardIssuer          string       `json:"card_issuer,omitempty"`
+}
+
+type codeOutput struct {
+	Code        string `json:"code"`
+	Description string `json:"description,omitempty"`
+}
+
+func newAnalyzeOutput(resp models.RiskAnalysisAPIResponse) analyzeOutput {
+	d := resp.Data
+	out := analyzeOutput{
+		Decision:              d.Decision,
+		ReasonCode:            d.ReasonCode,
+		RequestID:             d.RequestID,
+		RequestToken:          d.RequestToken,
+		MerchantReferenceCode: d.MerchantReferenceCode,
+		Fallback:              d.Fallback,
+		HTTPStatus:            resp.HTTPStatus,
+		Endpoint:              resp.Endpoint,
+		DryRun:                resp.DryRun,
+		RequestXML:            string(resp.RequestXML),
+	}
+	if !resp.DryRun {
+		out.Reason, _ = models.DescribeReasonCode(d.ReasonCode)
+	}
+	if a := d.AFSReply; a != nil {
+		out.AFS = &afsOutput{
+			ReasonCode:          a.ReasonCode,
+			Score:               a.AFSResult,
+			HostSeverity:        a.HostSeverity,
+			Factors:             describeCodes(a.AFSFactorCode, models.DescribeFactorCode),
+			AddressInfoCodes:    describeCodes(a.AddressInfoCode, models.DescribeInfoCode),
+			SuspiciousInfoCodes: describeCodes(a.SuspiciousInfoCode, models.DescribeInfoCode),
+			IPCountry:           a.IPCountry,
+			IPState:             a.IPState,
+			IPCity:              a.IPCity,
+			IPRoutingMethod:     a.IPRoutingMethod,
+			ScoreModelUsed:      a.ScoreModelUsed,
+			BinCountry:          a.BinCountry,
+			CardScheme:          a.CardScheme,
+			CardIssuer:          a.CardIssuer,
+		}
+	}
+	return out
+}
+
+func describeCodes(list string, describe func(string) (string, bool)) []codeOutput {
+	var out []codeOutput
+	for _, code := range models.SplitCodes(list) {
+		desc, _ := describe(code)
+		out = append(out, codeOutput{Code: code, Description: desc})
+	}
+	return out
+}
+
+func runAnalyze(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := newFlagSet("analyze")
+	var cf configFlags
+	cf.register(fs)
+	dryRun := fs.Bool("dry-run", false, "build and sign the request without sending it")
+	timeout := fs.Duration("timeout", 0, "overall `deadline` for the call (default: none beyond the client timeout)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	req, err := decodeRequest(fs.Args(), stdin)
+	if err != nil {
+		return err
+	}
+	cfg, err := cf.load()
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		cfg.DryRun = true
+	}
+	client, err := cybs.NewClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+	resp, err := client.AnalyzeRisk(ctx, req)
+	if err != nil {
+		return err
+	}
+	return writeJSON(stdout, newAnalyzeOutput(resp))
+}
+
+func runSign(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := newFlagSet("sign")
+	var cf configFlags
+	cf.register(fs)
+	unredacted := fs.Bool("unredacted", false, "print account numbers and transaction keys in full; by default they are masked, so the printed envelope no longer verifies")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	req, err := decodeRequest(fs.Args(), stdin)
+	if err != nil {
+		return err
+	}
+	client, err := cf.newClient()
+	if err != nil {
+		return err
+	}
+	signed, err := client.BuildSignedRequest(req)
+	if err != nil {
+		return err
+	}
+	if !*unredacted {
+		if signed, err = client.RedactEnvelope(signed); err != nil {
+			return err
+		}
+	}
+	_, err = stdout.Write(append(signed, '\n'))
+	return err
+}
+
+func runVerify(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := newFlagSet("verify")
+	verbose := fs.Bool("v", false, "also print the canonical forms the digests and signature are computed over")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	signed, err := readInput(fs.Args(), stdin)
+	if err != nil {
+		return err
+	}
+	report, err := cybs.VerifySignedEnvelope(signed)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "signature algorithm: %s\n", report.SignatureAlgorithm)
+	if cert := report.Certificate; cert != nil {
+		fmt.Fprintf(stdout, "certificate:         %s (expires %s)\n", cert.Subject, cert.NotAfter.Format(time.RFC3339))
+	}
+	for _, ref := range report.References {
+		fmt.Fprintf(stdout, "reference %-9s  digest %s", ref.URI, result(ref.DigestMatch))
+		if !ref.DigestMatch {
+			fmt.Fprintf(stdout, " (embedded %s, computed %s)", ref.EmbeddedDigest, ref.ComputedDigest)
+		}
+		fmt.Fprintln(stdout)
+	}
+	fmt.Fprintf(stdout, "signature value:     %s", result(report.SignatureValid))
+	if report.SignatureError != "" {
+		fmt.Fprintf(stdout, " (%s)", report.SignatureError)
+	}
+	fmt.Fprintln(stdout)
+	if report.CanonicalizationError != "" {
+		fmt.Fprintf(stdout, "note: %s\n", report.CanonicalizationError)
+	}
+	if *verbose {
+		fmt.Fprintf(stdout, "\ncanonical body:\n%s\n", report.CanonicalBodyInContext)
+		fmt.Fprintf(stdout, "\ncanonical SignedInfo:\n%s\n", report.CanonicalSignedInfo)
+		if report.CanonicalDiff != "" {
+			fmt.Fprintf(stdout, "\ndetached vs in-context canonical body:\n%s\n", report.CanonicalDiff)
+		}
+	}
+
+	if !report.Valid() {
+		fmt.Fprintln(stdout, "INVALID")
+		return errInvalid
+	}
+	fmt.Fprintln(stdout, "VALID")
+	return nil
+}
+
+func result(ok bool) string {
+	if ok {
+		return "ok"
+	}
+	return "MISMATCH"
+}
+
+func runCertInfo(args []string, _ io.Reader, stdout io.Writer) error {
+	fs := newFlagSet("cert-info")
+	var cf configFlags
+	cf.register(fs)
+	p12Path := fs.String("p12", "", "P12 `file` to inspect instead of the configured one; its password is read from -password-file or "+p12PasswordEnv)
+	passwordFile := fs.String("password-file", "", "`file` holding the password of the -p12 file")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return usageError{"unexpected arguments"}
+	}
+	var password string
+	switch {
+	case *passwordFile != "" && *p12Path == "":
+		return usageError{"-password-file requires -p12"}
+	case *passwordFile != "":
+		data, err := os.ReadFile(*passwordFile)
+		if err != nil {
+			return err
+		}
+		password = strings.TrimRight(string(data), "\r\n")
+	case *p12Path != "":
+		password = os.Getenv(p12PasswordEnv)
+	default:
+		cfg, err := cf.load()
+		if err != nil {
+			return err
+		}
+		if cfg.P12Path == "" {
+			return usageError{"no P12 file configured; set CYBS_DM_P12_PATH, p12_path or -p12"}
+		}
+		*p12Path, password = cfg.P12Path, cfg.P12Password
+	}
+	tlsCert, err := cybs.LoadP12Certificate(*p12Path, password)
+	if err != nil {
+		return err
+	}
+
+	leaf := tlsCert.Leaf
+	days := int(time.Until(leaf.NotAfter).Hours() / 24)
+	fingerprint := sha256.Sum256(leaf.Raw)
+	fmt.Fprintf(stdout, "subject:      %s\n", leaf.Subject)
+	fmt.Fprintf(stdout, "issuer:       %s\n", leaf.Issuer)
+	fmt.Fprintf(stdout, "serial:       %s\n", leaf.SerialNumber.Text(16))
+	fmt.Fprintf(stdout, "not before:   %s\n", leaf.NotBefore.Format(time.RFC3339))
+	fmt.Fprintf(stdout, "not after:    %s\n", leaf.NotAfter.Format(time.RFC3339))
+	switch {
+	case days < 0:
+		fmt.Fprintf(stdout, "status:       EXPIRED %d days ago\n", -days)
+	default:
+		fmt.Fprintf(stdout, "status:       valid, expires in %d days\n", days)
+	}
+	fmt.Fprintf(stdout, "key:          %s\n", describeKey(leaf))
+	fmt.Fprintf(stdout, "sha256:       %s\n", strings.ToUpper(hex.EncodeToString(fingerprint[:])))
+	fmt.Fprintf(stdout, "chain:        %d CA certificate(s)\n", len(tlsCert.Certificate)-1)
+	return nil
+}
+
+// p12PasswordEnv holds the password of a P12 file named with -p12, so
+// that it never appears in the process list or shell history. It is the
+// variable LoadConfigFromEnv reads the configured P12 password from.
+const p12PasswordEnv = "CYBS_DM_P12_PASSWORD"
+
+func describeKey(cert *x509.Certificate) string {
+	switch pub := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d bits", pub.N.BitLen())
+	case *ecdsa.PublicKey:
+		return "ECDSA " + pub.Curve.Params().Name
+	case ed25519.PublicKey:
+		return "Ed25519"
+	}
+	return cert.PublicKeyAlgorithm.String()
+}
+
+func runDecode(args []string, _ io.Reader, stdout io.Writer) error {
+	fs := newFlagSet("decode")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return usageError{`expected codes, e.g. "cybs-dm decode 481 F^V MM-A"`}
+	}
+	for _, arg := range fs.Args() {
+		if n, err := strconv.Atoi(arg); err == nil {
+			printCode(stdout, "reason", arg, describeReason(n))
+			continue
+		}
+		for _, code := range models.SplitCodes(arg) {
+			if len(code) == 1 {
+				desc, _ := models.DescribeFactorCode(code)
+				printCode(stdout, "factor", strings.ToUpper(code), desc)
+			} else {
+				desc, _ := models.DescribeInfoCode(code)
+				printCode(stdout, "info", strings.ToUpper(code), desc)
+			}
+		}
+	}
+	return nil
+}
+
+func describeReason(code int) string {
+	desc, _ := models.DescribeReasonCode(code)
+	return desc
+}
+
+func printCode(w io.Writer, kind, code, desc string) {
+	if desc == "" {
+		desc = "unknown code"
+	}
+	fmt.Fprintf(w, "%-6s %-9s %s\n", kind, code, desc)
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+
+	cybs "github.com/hugochinchilla79/cybersource_soap_dm"
+)
+
+// configFlags selects where the client configuration is read from.
+type configFlags struct {
+	file    string
+	profile string
+	envFile string
+}
+
+func (f *configFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.file, "config", "", "YAML or JSON config `file`; CYBS_DM_* environment variables are used when empty")
+	fs.StringVar(&f.profile, "profile", "", "config file `profile` (default: CYBS_DM_PROFILE or the file's profile key)")
+	fs.StringVar(&f.envFile, "env-file", ".env", "`file` of CYBS_DM_* variables loaded when -config is empty")
+}
+
+// load reads the configuration with the loaders the library provides.
+func (f *configFlags) load() (cybs.Config, error) {
+	if f.file == "" {
+		return cybs.LoadConfigFromDotEnv(f.envFile), nil
+	}
+	if f.profile != "" {
+		return cybs.LoadConfigFileProfile(f.file, f.profile)
+	}
+	return cybs.LoadConfigFile(f.file)
+}
+
+// newClient loads the configuration and creates a client.
+func (f *configFlags) newClient() (*cybs.Client, error) {
+	cfg, err := f.load()
+	if err != nil {
+		return nil, err
+	}
+	return cybs.NewClient(cfg)
+}
@@ -0,0 +1,145 @@
+// Command cybs-dm runs Decision Manager requests and inspects signed
+// envelopes, certificates and reply codes from the command line.
+//
+//	cybs-dm analyze   [flags] [request.json]   run a risk analysis, print the decision as JSON
+//	cybs-dm sign      [flags] [request.json]   print the signed SOAP envelope
+//	cybs-dm verify    [envelope.xml]           check a signed SOAP envelope
+//	cybs-dm cert-info [flags]                  inspect the P12 certificate
+//	cybs-dm decode    CODE...                  explain reason, factor and info codes
+//	cybs-dm replay    [flags] requests.jsonl   re-screen a JSONL file of requests, resumably
+//
+// Requests are read from the named file or stdin as JSON in the form
+// documented on models.RiskAnalysisRequest.UnmarshalJSON, e.g.
+//
+//	{"MerchantReferenceCode": "order-1",
+//	 "BillTo": {"FirstName": "Ada", "Email": "ada@example.com"},
+//	 "Card": {"Number": "4111111111111111", "ExpirationMonth": "12", "ExpirationYear": "2030"},
+//	 "PurchaseTotals": {"Currency": "USD", "GrandTotalAmount": "10.00"}}
+//
+// The configuration is read with -config (a YAML or JSON file, see
+// cybersource_soap_dm.LoadConfigFile) or else from CYBS_DM_* environment
+// variables and the -env-file .env file.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Exit codes.
+const (
+	exitOK      = 0
+	exitFailure = 1 // the command ran but failed, e.g. an invalid signature
+	exitUsage   = 2
+)
+
+// errInvalid reports a negative result (an invalid envelope) that has
+// already been printed; it exits with exitFailure and no message.
+var errInvalid = errors.New("invalid")
+
+type command struct {
+	name    string
+	summary string
+	run     func(args []string, stdin io.Reader, stdout io.Writer) error
+}
+
+var commands = []command{
+	{"analyze", "run a risk analysis and print the decision as JSON", runAnalyze},
+	{"sign", "print the signed SOAP envelope for a request", runSign},
+	{"verify", "check the signature of a signed SOAP envelope", runVerify},
+	{"cert-info", "inspect the P12 certificate", runCertInfo},
+	{"decode", "explain reason, factor and info codes", runDecode},
+	{"replay", "re-screen a JSONL file of requests, resuming an interrupted run", runReplay},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "-help" || args[0] == "help" {
+		usage(stderr)
+		return exitUsage
+	}
+	for _, cmd := range commands {
+		if cmd.name != args[0] {
+			continue
+		}
+		err := cmd.run(args[1:], stdin, stdout)
+		switch {
+		case err == nil:
+			return exitOK
+		case errors.Is(err, errFlags):
+			return exitUsage
+		case errors.Is(err, errInvalid):
+			return exitFailure
+		}
+		fmt.Fprintf(stderr, "cybs-dm %s: %v\n", cmd.name, err)
+		if errors.As(err, new(usageError)) {
+			return exitUsage
+		}
+		return exitFailure
+	}
+	fmt.Fprintf(stderr, "cybs-dm: unknown command %q\n\n", args[0])
+	usage(stderr)
+	return exitUsage
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: cybs-dm <command> [flags] [args]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `Run "cybs-dm <command> -h" for the command's flags.`)
+}
+
+// usageError is a bad command line.
+type usageError struct{ msg string }
+
+func (e usageError) Error() string { return e.msg }
+
+// parseFlags parses args, mapping flag errors to errFlags.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return errFlags
+	}
+	return nil
+}
+
+// errFlags reports a bad flag or -h; the flag package has already
+// printed the message and usage.
+var errFlags = errors.New("bad flags")
+
+// newFlagSet returns a flag set that reports errors instead of exiting.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet("cybs-dm "+name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	return fs
+}
+
+// openInput opens the single optional file argument, or stdin when it is
+// absent or "-".
+func openInput(args []string, stdin io.Reader) (io.ReadCloser, error) {
+	switch {
+	case len(args) > 1:
+		return nil, usageError{"expected at most one input file"}
+	case len(args) == 0 || args[0] == "-":
+		return io.NopCloser(stdin), nil
+	}
+	return os.Open(args[0])
+}
+
+func readInput(args []string, stdin io.Reader) ([]byte, error) {
+	r, err := openInput(args, stdin)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+const testRequestJSON = `{"MerchantReferenceCode": "order-1",
+ "BillTo": {"FirstName": "Ada", "LastName": "Lovelace", "Street1": "1 Main St", "City": "Mountain View",
+  "State": "CA", "PostalCode": "94043", "Country": "US", "Email": "ada@example.com"},
+ "Card": {"Number": "4111111111111111", "ExpirationMonth": "12", "ExpirationYear": "2030"},
+ "PurchaseTotals": {"Currency": "USD", "GrandTotalAmount": "10.00"}}`
+
+func runCLI(t *testing.T, stdin string, args ...string) (code int, stdout, stderr string) {
+	t.Helper()
+	var out, errOut bytes.Buffer
+	code = run(args, strings.NewReader(stdin), &out, &errOut)
+	return code, out.String(), errOut.String()
+}
+
+func TestSignMasksAccountNumbers(t *testing.T) {
+	t.Setenv("CYBS_DM_MERCHANT_ID", "testmerchant")
+	t.Setenv("CYBS_DM_AUTH_MODE", "transaction_key")
+	t.Setenv("CYBS_DM_TRANSACTION_KEY", "secret-transaction-key")
+	noEnvFile := filepath.Join(t.TempDir(), "missing.env")
+
+	code, out, stderr := runCLI(t, testRequestJSON, "sign", "-env-file", noEnvFile)
+	if code != exitOK {
+		t.Fatalf("sign exited %d: %s", code, stderr)
+	}
+	for _, secret := range []string{"4111111111111111", "secret-transaction-key"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("sign output contains %q", secret)
+		}
+	}
+	if !strings.Contains(out, "411111******1111") {
+		t.Errorf("sign output does not contain the masked card number:\n%s", out)
+	}
+
+	code, out, stderr = runCLI(t, testRequestJSON, "sign", "-env-file", noEnvFile, "-unredacted")
+	if code != exitOK {
+		t.Fatalf("sign -unredacted exited %d: %s", code, stderr)
+	}
+	if !strings.Contains(out, "4111111111111111") {
+		t.Errorf("sign -unredacted output does not contain the card number:\n%s", out)
+	}
+}
+
+func writeP12(t *testing.T, password string) string {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "testmerchant"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := pkcs12.Modern2023.Encode(key, cert, nil, password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "test.p12")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCertInfoPassword(t *testing.T) {
+	p12 := writeP12(t, "p12-password")
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(passwordFile, []byte("p12-password\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("environment", func(t *testing.T) {
+		t.Setenv(p12PasswordEnv, "p12-password")
+		code, out, stderr := runCLI(t, "", "cert-info", "-p12", p12)
+		if code != exitOK {
+			t.Fatalf("cert-info exited %d: %s", code, stderr)
+		}
+		if !strings.Contains(out, "CN=testmerchant") {
+			t.Errorf("cert-info output does not name the subject:\n%s", out)
+		}
+	})
+	t.Run("password file", func(t *testing.T) {
+		t.Setenv(p12PasswordEnv, "wrong")
+		if code, _, stderr := runCLI(t, "", "cert-info", "-p12", p12, "-password-file", passwordFile); code != exitOK {
+			t.Fatalf("cert-info exited %d: %s", code, stderr)
+		}
+	})
+	t.Run("wrong password", func(t *testing.T) {
+		t.Setenv(p12PasswordEnv, "wrong")
+		if code, _, _ := runCLI(t, "", "cert-info", "-p12", p12); code != exitFailure {
+			t.Fatalf("cert-info exited %d, want %d", code, exitFailure)
+		}
+	})
+	t.Run("no password flag", func(t *testing.T) {
+		if code, _, _ := runCLI(t, "", "cert-info", "-p12", p12, "-password", "p12-password"); code != exitUsage {
+			t.Fatalf("cert-info -password exited %d, want %d", code, exitUsage)
+		}
+	})
+}
+
+func TestAnalyzeDryRun(t *testing.T) {
+	t.Setenv("CYBS_DM_MERCHANT_ID", "testmerchant")
+	t.Setenv("CYBS_DM_AUTH_MODE", "transaction_key")
+	t.Setenv("CYBS_DM_TRANSACTION_KEY", "secret-transaction-key")
+	noEnvFile := filepath.Join(t.TempDir(), "missing.env")
+
+	code, out, stderr := runCLI(t, testRequestJSON, "analyze", "-env-file", noEnvFile, "-dry-run")
+	if code != exitOK {
+		t.Fatalf("analyze -dry-run exited %d: %s", code, stderr)
+	}
+	var got analyzeOutput
+	if err := json.Unmarshal([]byte(out), &got); err != nil {
+		t.Fatalf("analyze output is not JSON: %v\n%s", err, out)
+	}
+	if !got.DryRun || got.Decision != "" {
+		t.Errorf("dry_run = %v, decision = %q; want a dry run without a decision", got.DryRun, got.Decision)
+	}
+	if !strings.Contains(got.RequestXML, "merchantReferenceCode>order-1<") {
+		t.Errorf("request_xml lacks the merchant reference code:\n%s", got.RequestXML)
+	}
+	if strings.Contains(got.RequestXML, "4111111111111111") {
+		t.Error("request_xml contains the unmasked card number")
+	}
+
+	if code, _, _ := runCLI(t, `{"MerchantReferenceCode": `, "analyze", "-env-file", noEnvFile, "-dry-run"); code != exitFailure {
+		t.Errorf("analyze with a truncated request exited %d, want %d", code, exitFailure)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	t.Setenv("CYBS_DM_MERCHANT_ID", "testmerchant")
+	t.Setenv("CYBS_DM_P12_PATH", writeP12(t, "p12-password"))
+	t.Setenv(p12PasswordEnv, "p12-password")
+	noEnvFile := filepath.Join(t.TempDir(), "missing.env")
+
+	code, signed, stderr := runCLI(t, testRequestJSON, "sign", "-env-file", noEnvFile, "-unredacted")
+	if code != exitOK {
+		t.Fatalf("sign exited %d: %s", code, stderr)
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		code, out, stderr := runCLI(t, signed, "verify")
+		if code != exitOK {
+			t.Fatalf("verify exited %d: %s\n%s", code, stderr, out)
+		}
+		if !strings.HasSuffix(out, "VALID\n") || strings.Contains(out, "MISMATCH") {
+			t.Errorf("verify output:\n%s", out)
+		}
+	})
+	t.Run("tampered body", func(t *testing.T) {
+		tampered := strings.Replace(signed, "order-1", "order-2", 1)
+		code, out, _ := runCLI(t, tampered, "verify")
+		if code != exitFailure {
+			t.Fatalf("verify exited %d, want %d", code, exitFailure)
+		}
+		if !strings.HasSuffix(out, "INVALID\n") || !strings.Contains(out, "digest MISMATCH") {
+			t.Errorf("verify output does not report the digest mismatch:\n%s", out)
+		}
+	})
+	t.Run("redacted", func(t *testing.T) {
+		_, redacted, _ := runCLI(t, testRequestJSON, "sign", "-env-file", noEnvFile)
+		if code, _, _ := runCLI(t, redacted, "verify"); code != exitFailure {
+			t.Fatalf("verify of a redacted envelope exited %d, want %d", code, exitFailure)
+		}
+	})
+	t.Run("not an envelope", func(t *testing.T) {
+		code, _, stderr := runCLI(t, "<not soap", "verify")
+		if code != exitFailure || !strings.HasPrefix(stderr, "cybs-dm verify: ") {
+			t.Fatalf("verify exited %d with %q, want %d and an error", code, stderr, exitFailure)
+		}
+	})
+}
+
+func TestDecode(t *testing.T) {
+	code, out, stderr := runCLI(t, "", "decode", "481", "f^V", "MM-A", "999", "ZZ-Z")
+	if code != exitOK {
+		t.Fatalf("decode exited %d: %s", code, stderr)
+	}
+	want := []string{
+		"reason 481       The order was rejected by Decision Manager.",
+		"factor F         Negative list:",
+		"factor V         Velocity:",
+		"info   MM-A      The billing and shipping addresses use different countries.",
+		"reason 999       unknown code",
+		"info   ZZ-Z      unknown code",
+	}
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("decode printed %d lines, want %d:\n%s", len(lines), len(want), out)
+	}
+	for i, w := range want {
+		if !strings.HasPrefix(lines[i], w) {
+			t.Errorf("line %d = %q, want prefix %q", i+1, lines[i], w)
+		}
+	}
+
+	if code, _, _ := runCLI(t, "", "decode"); code != exitUsage {
+		t.Errorf("decode without codes exited %d, want %d", code, exitUsage)
+	}
+}
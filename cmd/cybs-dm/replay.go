@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+
+	cybs "github.com/hugochinchilla79/cybersource_soap_dm"
+)
+
+func runReplay(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := newFlagSet("replay")
+	var cf configFlags
+	cf.register(fs)
+	output := fs.String("o", "", "results `file` (.jsonl or .csv); an existing file is resumed. Default: stdout, no resume")
+	format := fs.String("format", "", "results `format`: jsonl or csv (default: from the -o extension, else jsonl)")
+	concurrency := fs.Int("concurrency", cybs.DefaultBatchConcurrency, "requests in flight")
+	rate := fs.Float64("rate", 0, "maximum requests started per `second` (0: unlimited)")
+	burst := fs.Int("burst", 0, "requests that may start at once before -rate applies")
+	quiet := fs.Bool("q", false, "do not report progress on stderr")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return usageError{"expected one requests file (use - for stdin)"}
+	}
+	input := fs.Arg(0)
+	if input == "-" && *output != "" {
+		return usageError{"-o needs a requests file to resume against, not stdin"}
+	}
+
+	client, err := cf.newClient()
+	if err != nil {
+		return err
+	}
+	opts := cybs.ReplayOptions{
+		Format:        cybs.ReplayFormat(*format),
+		Concurrency:   *concurrency,
+		RatePerSecond: *rate,
+		Burst:         *burst,
+	}
+	if !*quiet {
+		done := 0
+		opts.Progress = func(res cybs.ReplayResult) {
+			done++
+			if res.Error != "" {
+				fmt.Fprintf(os.Stderr, "line %d: %s\n", res.Line, res.Error)
+			}
+			if done%100 == 0 {
+				fmt.Fprintf(os.Stderr, "%d screened\n", done)
+			}
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	var summary cybs.ReplaySummary
+	switch {
+	case *output != "":
+		summary, err = client.ReplayFile(ctx, input, *output, opts)
+	case input == "-":
+		summary, err = client.Replay(ctx, stdin, stdout, opts)
+	default:
+		var f *os.File
+		if f, err = os.Open(input); err != nil {
+			return err
+		}
+		defer f.Close()
+		summary, err = client.Replay(ctx, f, stdout, opts)
+	}
+	printReplaySummary(os.Stderr, summary)
+	return err
+}
+
+func printReplaySummary(w io.Writer, s cybs.ReplaySummary) {
+	fmt.Fprintf(w, "requests %d, skipped %d, screened %d, failed %d\n", s.Requests, s.Skipped, s.Screened, s.Failed)
+	decisions := make([]string, 0, len(s.Decisions))
+	for d := range s.Decisions {
+		decisions = append(decisions, d)
+	}
+	sort.Strings(decisions)
+	for _, d := range decisions {
+		fmt.Fprintf(w, "  %-8s %d\n", d, s.Decisions[d])
+	}
+}
@@ -2,11 +2,20 @@ package cybersource_soap_dm
 
 import (
 	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/hugochinchilla79/cybersource_soap_dm/models"
 	"github.com/joho/godotenv"
 )
 
+// DefaultTimeout is the HTTP timeout used when Config.Timeout is zero.
+const DefaultTimeout = 30 * time.Second
+
 // Environment represents the CyberSource environment (sandbox or production).
 type Environment string
 
@@ -15,38 +24,288 @@ const (
 	EnvProduction Environment = "production"
 )
 
+// AuthMode selects how requests are authenticated with CyberSource.
+type AuthMode string
+
+const (
+	// AuthCertificate signs requests with the P12 certificate
+	// (BinarySecurityToken + XML signature). It is the default.
+	AuthCertificate AuthMode = "certificate"
+
+	// AuthTransactionKey sends the merchant ID and SOAP transaction key
+	// in a WS-Security UsernameToken. No P12 file is needed.
+	AuthTransactionKey AuthMode = "transaction_key"
+)
+
 // Config holds the credentials and settings needed to interact with
 // the CyberSource Decision Manager SOAP API.
 type Config struct {
 	// MerchantID is the CyberSource merchant identifier.
 	MerchantID string
 
+	// ChildMerchantIDs lists the merchants this client may send requests
+	// for with a CyberSource meta key. MerchantID is then the portfolio
+	// (meta key) merchant that owns the P12 or transaction key, and
+	// requests select a child with RiskAnalysisRequest.MerchantID.
+	ChildMerchantIDs []string
+
+	// AuthMode selects certificate or transaction key authentication.
+	// Empty means AuthCertificate.
+	AuthMode AuthMode
+
 	// P12Path is the filesystem path to the P12/PFX certificate file
 	// used for WS-Security BinarySecurityToken + XML digital signature.
+	// Required with AuthCertificate.
 	P12Path string
 
 	// P12Password is the password that protects the P12 file.
 	P12Password string
 
+	// TransactionKey is the SOAP toolkit transaction key generated in the
+	// Business Center. Required with AuthTransactionKey.
+	TransactionKey string
+
 	// Env selects sandbox or production endpoints.
 	Env Environment
 
 	// BaseURL optionally overrides the SOAP endpoint URL.
 	// When empty, the URL is derived from Env.
 	BaseURL string
+
+	// AllowInsecureHTTP permits http:// BaseURL and Endpoints, e.g. for a
+	// local mock server. Never set it in production.
+	AllowInsecureHTTP bool
+
+	// Endpoints optionally lists SOAP endpoint URLs in order of preference,
+	// e.g. alternate data centres or egress gateways. When set, it replaces
+	// BaseURL and the client fails over down the list on connection errors.
+	Endpoints []string
+
+	// WrapTransport optionally wraps the HTTP transport that presents the
+	// P12 certificate, e.g. with a Cassette to record or replay exchanges,
+	// or with a proxy or logging RoundTripper.
+	WrapTransport func(http.RoundTripper) http.RoundTripper
+
+	// Timeout bounds each HTTP request to CyberSource, including reading
+	// the reply. Zero means DefaultTimeout.
+	Timeout time.Duration
+
+	// EndpointCooldown is how long an endpoint is skipped after a connection
+	// failure. Zero means DefaultEndpointCooldown.
+	EndpointCooldown time.Duration
+
+	// Retry optionally retries requests that could not reach any endpoint.
+	// Nil disables retrying.
+	Retry *RetryPolicy
+
+	// StrictTotals rejects requests whose item line totals do not add up to
+	// PurchaseTotals.GrandTotalAmount. A line total is Item.TotalAmount when
+	// set, otherwise UnitPrice × Quantity.
+	StrictTotals bool
+
+	// MDDSchema declares the named merchant-defined data fields accepted in
+	// RiskAnalysisRequest.MerchantDefinedFields. When nil, only numbered
+	// fields (MerchantDefinedData) can be sent.
+	MDDSchema *models.MDDSchema
+
+	// RateLimit caps the number of requests sent per second by this client.
+	// Zero disables rate limiting.
+	RateLimit float64
+
+	// RateBurst is the number of requests that may be sent at once before
+	// RateLimit applies. Zero means 1.
+	RateBurst int
+
+	// MaxInFlight caps the number of concurrent requests to CyberSource.
+	// Zero means unlimited.
+	MaxInFlight int
+
+	// RateLimitFailFast makes AnalyzeRisk return ErrRateLimited immediately
+	// when the rate limit or MaxInFlight is reached, instead of waiting.
+	RateLimitFailFast bool
+
+	// CircuitBreaker optionally enables a circuit breaker that stops sending
+	// requests while CyberSource is failing. Nil disables it.
+	CircuitBreaker *CircuitBreakerConfig
+
+	// Telemetry optionally receives spans and metrics for every call.
+	// Nil disables instrumentation.
+	Telemetry Telemetry
+
+	// Hooks are invoked around building, signing, sending and parsing each
+	// request, in order. See Hooks.
+	Hooks []Hooks
+
+	// AuditSink optionally stores an audit record of every AnalyzeRisk call,
+	// with the request envelope redacted. See FileAuditSink and SQLAuditSink.
+	AuditSink AuditSink
+
+	// DecisionManagerProfile is the Decision Manager profile used for
+	// requests that do not set RiskAnalysisRequest.DecisionManagerProfile.
+	// Empty uses the account's default profile.
+	DecisionManagerProfile string
+
+	// Logger optionally receives a Debug record per call, and Warn records
+	// for failed calls and endpoint failover. Nil disables logging.
+	Logger *slog.Logger
+
+	// Signing configures the WS-Security signature algorithms, timestamp
+	// and IDs. The zero value signs with RSA-SHA256 as CyberSource expects.
+	// It must be left zero with AuthTransactionKey, which does not sign.
+	Signing SigningOptions
+
+	// DryRun makes AnalyzeRisk build and sign requests without sending them.
+	// The redacted signed envelope is returned in RiskAnalysisAPIResponse.RequestXML.
+	DryRun bool
 }
 
-// Validate checks that the required configuration fields are present.
+// Validate checks the configuration and returns a *ConfigError listing
+// every problem found, or nil.
 func (c Config) Validate() error {
-	if c.MerchantID == "" {
-		return fmt.Errorf("cybersource_soap_dm: MerchantID is required")
+	var problems []string
+	addf := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	switch {
+	case c.MerchantID == "":
+		addf("MerchantID is required")
+	case !validMerchantID(c.MerchantID):
+		addf("MerchantID %q must be 1-%d letters, digits or underscores", c.MerchantID, maxMerchantIDLength)
+	}
+	for _, id := range c.ChildMerchantIDs {
+		if !validMerchantID(id) {
+			addf("ChildMerchantIDs: %q must be 1-%d letters, digits or underscores", id, maxMerchantIDLength)
+		}
+	}
+
+	switch c.Env {
+	case "", EnvSandbox, EnvProduction:
+	default:
+		addf("unknown Env %q (want %q or %q)", c.Env, EnvSandbox, EnvProduction)
+	}
+	if c.BaseURL != "" {
+		if err := c.checkEndpointURL(c.BaseURL); err != nil {
+			addf("BaseURL: %v", err)
+		}
 	}
-	if c.P12Path == "" {
-		return fmt.Errorf("cybersource_soap_dm: P12Path is required")
+	for _, u := range c.Endpoints {
+		if err := c.checkEndpointURL(u); err != nil {
+			addf("Endpoints: %v", err)
+		}
+	}
+
+	switch c.authMode() {
+	case AuthCertificate:
+		if c.P12Path == "" {
+			addf("P12Path is required")
+		} else if f, err := os.Open(expandHome(c.P12Path)); err != nil {
+			addf("P12Path: %v", err)
+		} else {
+			if info, err := f.Stat(); err == nil && info.IsDir() {
+				addf("P12Path: %s is a directory", c.P12Path)
+			}
+			f.Close()
+		}
+	case AuthTransactionKey:
+		if c.TransactionKey == "" {
+			addf("TransactionKey is required with AuthMode %q", AuthTransactionKey)
+		}
+		if !c.Signing.isZero() {
+			addf("Signing must not be set with AuthMode %q, which does not sign requests", AuthTransactionKey)
+		}
+	default:
+		addf("unknown AuthMode %q", c.AuthMode)
+	}
+
+	if c.Timeout < 0 {
+		addf("Timeout must not be negative")
+	}
+	if c.EndpointCooldown < 0 {
+		addf("EndpointCooldown must not be negative")
+	}
+	if r := c.Retry; r != nil && (r.MaxAttempts < 0 || r.Backoff < 0) {
+		addf("Retry MaxAttempts and Backoff must not be negative")
+	}
+	if c.RateLimit < 0 || c.RateBurst < 0 || c.MaxInFlight < 0 {
+		addf("RateLimit, RateBurst and MaxInFlight must not be negative")
+	}
+	if cb := c.CircuitBreaker; cb != nil && (cb.FailureThreshold < 0 || cb.Cooldown < 0) {
+		addf("CircuitBreaker FailureThreshold and Cooldown must not be negative")
+	}
+	if c.Signing.TimestampTTL < 0 {
+		addf("Signing.TimestampTTL must not be negative")
+	}
+
+	if len(problems) > 0 {
+		return &ConfigError{Problems: problems}
 	}
 	return nil
 }
 
+// ConfigError is returned by Config.Validate and lists every problem found.
+type ConfigError struct {
+	Problems []string
+}
+
+func (e *ConfigError) Error() string {
+	return "cybersource_soap_dm: invalid config: " + strings.Join(e.Problems, "; ")
+}
+
+// maxMerchantIDLength is the longest merchant ID CyberSource issues.
+const maxMerchantIDLength = 30
+
+func validMerchantID(id string) bool {
+	if id == "" || len(id) > maxMerchantIDLength {
+		return false
+	}
+	for _, r := range id {
+		if !(r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// checkEndpointURL requires an absolute https URL, or http when
+// AllowInsecureHTTP is set.
+func (c Config) checkEndpointURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	switch {
+	case u.Scheme == "https":
+	case u.Scheme == "http" && c.AllowInsecureHTTP:
+	case u.Scheme == "http":
+		return fmt.Errorf("%q is not https (set AllowInsecureHTTP for local testing)", raw)
+	default:
+		return fmt.Errorf("%q must be an https URL", raw)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("%q has no host", raw)
+	}
+	return nil
+}
+
+// ParseEnvironment parses "sandbox" or "production", ignoring case and
+// surrounding spaces. Anything else is an error, so a typo cannot send
+// live traffic to the wrong endpoint.
+func ParseEnvironment(s string) (Environment, error) {
+	switch env := Environment(strings.ToLower(strings.TrimSpace(s))); env {
+	case EnvSandbox, EnvProduction:
+		return env, nil
+	}
+	return "", fmt.Errorf("cybersource_soap_dm: unknown environment %q (want %q or %q)", s, EnvSandbox, EnvProduction)
+}
+
+func (c Config) authMode() AuthMode {
+	if c.AuthMode == "" {
+		return AuthCertificate
+	}
+	return c.AuthMode
+}
+
 // DefaultBaseURL returns the SOAP transaction endpoint for the configured environment.
 func (c Config) DefaultBaseURL() string {
 	if c.BaseURL != "" {
@@ -58,13 +317,24 @@ func (c Config) DefaultBaseURL() string {
 	return "https://ics2wstest.ic3.com/commerce/1.x/transactionProcessor"
 }
 
+// EndpointURLs returns the SOAP endpoints to use, in order of preference:
+// Endpoints when set, otherwise DefaultBaseURL.
+func (c Config) EndpointURLs() []string {
+	if len(c.Endpoints) > 0 {
+		return c.Endpoints
+	}
+	return []string{c.DefaultBaseURL()}
+}
+
 // LoadConfigFromEnv creates a Config from environment variables:
 //
-//	CYBS_DM_MERCHANT_ID   – merchant identifier (required)
-//	CYBS_DM_P12_PATH      – path to P12 certificate file (required)
-//	CYBS_DM_P12_PASSWORD  – P12 file password
-//	CYBS_DM_ENV           – "sandbox" (default) or "production"
-//	CYBS_DM_BASE_URL      – optional SOAP endpoint override
+//	CYBS_DM_MERCHANT_ID      – merchant identifier (required)
+//	CYBS_DM_AUTH_MODE        – "certificate" (default) or "transaction_key"
+//	CYBS_DM_P12_PATH         – path to P12 certificate file (certificate mode)
+//	CYBS_DM_P12_PASSWORD     – P12 file password
+//	CYBS_DM_TRANSACTION_KEY  – SOAP transaction key (transaction_key mode)
+//	CYBS_DM_ENV              – "sandbox" (default) or "production"; other values fail Validate
+//	CYBS_DM_BASE_URL         – optional SOAP endpoint override
 func LoadConfigFromEnv() Config {
 	return configFromEnv()
 }
@@ -80,15 +350,23 @@ func LoadConfigFromDotEnv(filenames ...string) Config {
 
 func configFromEnv() Config {
 	env := EnvSandbox
-	if os.Getenv("CYBS_DM_ENV") == "production" {
-		env = EnvProduction
+	if v := os.Getenv("CYBS_DM_ENV"); v != "" {
+		parsed, err := ParseEnvironment(v)
+		if err != nil {
+			// Keep the bad value so Validate reports it instead of
+			// silently falling back to sandbox.
+			parsed = Environment(v)
+		}
+		env = parsed
 	}
 
 	return Config{
-		MerchantID:  os.Getenv("CYBS_DM_MERCHANT_ID"),
-		P12Path:     os.Getenv("CYBS_DM_P12_PATH"),
-		P12Password: os.Getenv("CYBS_DM_P12_PASSWORD"),
-		Env:         env,
-		BaseURL:     os.Getenv("CYBS_DM_BASE_URL"),
+		MerchantID:     os.Getenv("CYBS_DM_MERCHANT_ID"),
+		AuthMode:       AuthMode(os.Getenv("CYBS_DM_AUTH_MODE")),
+		P12Path:        os.Getenv("CYBS_DM_P12_PATH"),
+		P12Password:    os.Getenv("CYBS_DM_P12_PASSWORD"),
+		TransactionKey: os.Getenv("CYBS_DM_TRANSACTION_KEY"),
+		Env:            env,
+		BaseURL:        os.Getenv("CYBS_DM_BASE_URL"),
 	}
 }
@@ -0,0 +1,120 @@
+package cybersource_soap_dm
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigValidate(t *testing.T) {
+	p12 := writeTestP12(t, testKey(t))
+	valid := func() Config {
+		return Config{MerchantID: "store_a", P12Path: p12, P12Password: testP12Password}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		want   string // "" means valid
+	}{
+		{"valid", func(*Config) {}, ""},
+		{"sandbox", func(c *Config) { c.Env = EnvSandbox }, ""},
+		{"production", func(c *Config) { c.Env = EnvProduction }, ""},
+		{"prod is not an environment", func(c *Config) { c.Env = "prod" }, `unknown Env "prod"`},
+		{"missing merchant", func(c *Config) { c.MerchantID = "" }, "MerchantID is required"},
+		{"merchant with dash", func(c *Config) { c.MerchantID = "store-a" }, `MerchantID "store-a" must be`},
+		{"merchant with space", func(c *Config) { c.MerchantID = "store a" }, "must be 1-30"},
+		{"merchant too long", func(c *Config) { c.MerchantID = strings.Repeat("a", 31) }, "must be 1-30"},
+		{"merchant at max length", func(c *Config) { c.MerchantID = strings.Repeat("a", 30) }, ""},
+		{"bad child merchant", func(c *Config) { c.ChildMerchantIDs = []string{"child.1"} }, `ChildMerchantIDs: "child.1"`},
+		{"https base URL", func(c *Config) { c.BaseURL = "https://example.com/tp" }, ""},
+		{"http base URL", func(c *Config) { c.BaseURL = "http://127.0.0.1:8080/tp" }, "is not https"},
+		{"http base URL allowed", func(c *Config) {
+			c.BaseURL = "http://127.0.0.1:8080/tp"
+			c.AllowInsecureHTTP = true
+		}, ""},
+		{"ftp base URL", func(c *Config) {
+			c.BaseURL = "ftp://example.com/tp"
+			c.AllowInsecureHTTP = true
+		}, "must be an https URL"},
+		{"relative base URL", func(c *Config) { c.BaseURL = "/tp" }, "must be an https URL"},
+		{"base URL without host", func(c *Config) { c.BaseURL = "https:///tp" }, "has no host"},
+		{"http endpoint", func(c *Config) { c.Endpoints = []string{"https://a.example.com", "http://b.example.com"} }, `Endpoints: "http://b.example.com" is not https`},
+		{"missing P12", func(c *Config) { c.P12Path = "" }, "P12Path is required"},
+		{"unreadable P12", func(c *Config) { c.P12Path = filepath.Join(t.TempDir(), "missing.p12") }, "no such file"},
+		{"P12 directory", func(c *Config) { c.P12Path = t.TempDir() }, "is a directory"},
+		{"transaction key", func(c *Config) {
+			c.AuthMode = AuthTransactionKey
+			c.P12Path = ""
+			c.TransactionKey = "key"
+		}, ""},
+		{"missing transaction key", func(c *Config) { c.AuthMode = AuthTransactionKey }, "TransactionKey is required"},
+		{"unknown auth mode", func(c *Config) { c.AuthMode = "oauth" }, `unknown AuthMode "oauth"`},
+		{"negative timeout", func(c *Config) { c.Timeout = -1 }, "Timeout must not be negative"},
+		{"negative rate", func(c *Config) { c.RateLimit = -1 }, "must not be negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := valid()
+			tt.modify(&cfg)
+			err := cfg.Validate()
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			var ce *ConfigError
+			if !errors.As(err, &ce) || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Validate() = %v, want a ConfigError containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigValidateListsEveryProblem(t *testing.T) {
+	err := Config{
+		MerchantID: "bad-id",
+		Env:        "prod",
+		BaseURL:    "http://example.com",
+		AuthMode:   AuthTransactionKey,
+		Timeout:    -1,
+	}.Validate()
+	var ce *ConfigError
+	if !errors.As(err, &ce) {
+		t.Fatalf("Validate() = %v, want a ConfigError", err)
+	}
+	want := []string{"MerchantID", "Env", "BaseURL", "TransactionKey", "Timeout"}
+	if len(ce.Problems) != len(want) {
+		t.Errorf("got %d problems %q, want %d", len(ce.Problems), ce.Problems, len(want))
+	}
+	for _, w := range want {
+		if !strings.Contains(err.Error(), w) {
+			t.Errorf("error %q does not mention %s", err, w)
+		}
+	}
+}
+
+func TestParseEnvironment(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Environment
+		wantErr bool
+	}{
+		{"sandbox", EnvSandbox, false},
+		{"production", EnvProduction, false},
+		{" Production\n", EnvProduction, false},
+		{"SANDBOX", EnvSandbox, false},
+		{"prod", "", true},
+		{"live", "", true},
+		{"test", "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseEnvironment(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseEnvironment(%q) = %q, %v; want %q, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
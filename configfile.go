@@ -0,0 +1,480 @@
+package cybersource_soap_dm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hugochinchilla79/cybersource_soap_dm/models"
+	"gopkg.in/yaml.v3"
+)
+
+// LoadConfigFile reads a YAML (.yaml, .yml) or JSON (.json) configuration
+// file and returns the Config of its selected profile: CYBS_DM_PROFILE when
+// set, otherwise the file's "profile" key, otherwise its only profile.
+//
+// A file has optional "defaults" shared by every profile and named
+// "profiles" that override them key by key:
+//
+//	profile: sandbox
+//	defaults:
+//	  timeout: 20s
+//	  mdd_schema:
+//	    - {name: loyalty_tier, index: 1, allowed_values: [gold, silver]}
+//	profiles:
+//	  sandbox:
+//	    merchant_id: store_a_test
+//	    p12_path: ~/keys/store_a_test.p12
+//	    p12_password: ${STORE_A_P12_PASSWORD}
+//	  prod-store-a:
+//	    env: production
+//	    merchant_id: store_a
+//	    auth_mode: transaction_key
+//	    transaction_key: ${STORE_A_TRANSACTION_KEY}
+//
+// String values may reference environment variables as ${NAME} or
+// ${NAME:-default}; "$$" is a literal "$". Referencing an unset variable
+// without a default is an error, and so is any unknown key. Numbers and
+// booleans may also be written as strings, so that they can come from the
+// environment too (rate_limit: ${RATE_LIMIT:-50}).
+//
+// Keys map to Config fields: merchant_id, child_merchant_ids, auth_mode,
+// p12_path, p12_password, transaction_key, env, base_url, endpoints,
+// endpoint_cooldown, retry (max_attempts, backoff), timeout,
+// strict_totals, rate_limit, rate_burst, max_in_flight,
+// rate_limit_fail_fast, circuit_breaker (failure_threshold, cooldown,
+// fallback_decision, fallback_reason_code), signing (signature_algorithm,
+// digest_algorithm, inclusive_prefixes, timestamp_ttl, random_ids,
+// streaming), mdd_schema (name, index, max_length, allowed_values, pii),
+// decision_manager_profile, dry_run and log_level, which creates a text
+// Logger on stderr. Durations use time.ParseDuration syntax ("30s").
+func LoadConfigFile(path string) (Config, error) {
+	return LoadConfigFileProfile(path, os.Getenv("CYBS_DM_PROFILE"))
+}
+
+// LoadConfigFileProfile is like LoadConfigFile but selects the named
+// profile. An empty name selects the file's default profile.
+func LoadConfigFileProfile(path, profile string) (Config, error) {
+	cfg, err := loadConfigFile(path, profile)
+	if err != nil {
+		return Config{}, fmt.Errorf("cybersource_soap_dm: config file %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func loadConfigFile(path, profile string) (Config, error) {
+	data, err := os.ReadFile(expandHome(path))
+	if err != nil {
+		return Config{}, err
+	}
+
+	var tree any
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &tree); err != nil {
+			return Config{}, err
+		}
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		if err := dec.Decode(&tree); err != nil {
+			return Config{}, err
+		}
+	default:
+		return Config{}, fmt.Errorf("unsupported file type %q (want .yaml, .yml or .json)", filepath.Ext(path))
+	}
+	if tree, err = interpolateEnv(tree, ""); err != nil {
+		return Config{}, err
+	}
+
+	// Re-encode as JSON so both formats share one strict decoder.
+	normalized, err := json.Marshal(tree)
+	if err != nil {
+		return Config{}, err
+	}
+	var file configFile
+	if err := decodeStrict(normalized, &file); err != nil {
+		return Config{}, err
+	}
+
+	if profile == "" {
+		profile = file.Profile
+	}
+	if profile == "" && len(file.Profiles) == 1 {
+		for name := range file.Profiles {
+			profile = name
+		}
+	}
+
+	var fp fileProfile
+	if len(file.Defaults) > 0 && string(file.Defaults) != "null" {
+		if err := decodeStrict(file.Defaults, &fp); err != nil {
+			return Config{}, fmt.Errorf("defaults: %w", err)
+		}
+	}
+	switch raw, ok := file.Profiles[profile]; {
+	case ok:
+		if err := decodeStrict(raw, &fp); err != nil {
+			return Config{}, fmt.Errorf("profile %q: %w", profile, err)
+		}
+	case profile != "" || len(file.Profiles) > 0:
+		return Config{}, fmt.Errorf("profile %q not found (have %s)", profile, strings.Join(file.profileNames(), ", "))
+	}
+
+	cfg, err := fp.config()
+	if err != nil {
+		if profile != "" {
+			return Config{}, fmt.Errorf("profile %q: %w", profile, err)
+		}
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+type configFile struct {
+	Profile  string                     `json:"profile"`
+	Defaults json.RawMessage            `json:"defaults"`
+	Profiles map[string]json.RawMessage `json:"profiles"`
+}
+
+func (f configFile) profileNames() []string {
+	names := make([]string, 0, len(f.Profiles))
+	for name := range f.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// fileProfile is one profile as written in a config file. Decoding a
+// profile over the defaults overrides only the keys it sets.
+type fileProfile struct {
+	MerchantID             string              `json:"merchant_id"`
+	ChildMerchantIDs       []string            `json:"child_merchant_ids"`
+	AuthMode               string              `json:"auth_mode"`
+	P12Path                string              `json:"p12_path"`
+	P12Password            string              `json:"p12_password"`
+	TransactionKey         string              `json:"transaction_key"`
+	Env                    string              `json:"env"`
+	BaseURL                string              `json:"base_url"`
+	Endpoints              []string            `json:"endpoints"`
+	EndpointCooldown       fileDuration        `json:"endpoint_cooldown"`
+	Retry                  *fileRetry          `json:"retry"`
+	Timeout                fileDuration        `json:"timeout"`
+	StrictTotals           fileBool            `json:"strict_totals"`
+	RateLimit              fileFloat           `json:"rate_limit"`
+	RateBurst              fileInt             `json:"rate_burst"`
+	MaxInFlight            fileInt             `json:"max_in_flight"`
+	RateLimitFailFast      fileBool            `json:"rate_limit_fail_fast"`
+	CircuitBreaker         *fileCircuitBreaker `json:"circuit_breaker"`
+	Signing                fileSigning         `json:"signing"`
+	MDDSchema              []fileMDDField      `json:"mdd_schema"`
+	DecisionManagerProfile string              `json:"decision_manager_profile"`
+	DryRun                 fileBool            `json:"dry_run"`
+	LogLevel               string              `json:"log_level"`
+}
+
+type fileRetry struct {
+	MaxAttempts fileInt      `json:"max_attempts"`
+	Backoff     fileDuration `json:"backoff"`
+}
+
+type fileCircuitBreaker struct {
+	FailureThreshold   fileInt      `json:"failure_threshold"`
+	Cooldown           fileDuration `json:"cooldown"`
+	FallbackDecision   string       `json:"fallback_decision"`
+	FallbackReasonCode fileInt      `json:"fallback_reason_code"`
+}
+
+type fileSigning struct {
+	SignatureAlgorithm string       `json:"signature_algorithm"`
+	DigestAlgorithm    string       `json:"digest_algorithm"`
+	InclusivePrefixes  []string     `json:"inclusive_prefixes"`
+	TimestampTTL       fileDuration `json:"timestamp_ttl"`
+	RandomIDs          fileBool     `json:"random_ids"`
+	Streaming          fileBool     `json:"streaming"`
+}
+
+type fileMDDField struct {
+	Name          string   `json:"name"`
+	Index         fileInt  `json:"index"`
+	MaxLength     fileInt  `json:"max_length"`
+	AllowedValues []string `json:"allowed_values"`
+	PII           fileBool `json:"pii"`
+}
+
+// signatureAlgorithmNames are the short names accepted for
+// signing.signature_algorithm besides the full algorithm URIs.
+var signatureAlgorithmNames = map[string]SignatureAlgorithm{
+	"rsa-sha256":     SignatureRSASHA256,
+	"rsa-sha512":     SignatureRSASHA512,
+	"rsa-pss-sha256": SignatureRSAPSSSHA256,
+	"rsa-pss-sha512": SignatureRSAPSSSHA512,
+	"ecdsa-sha256":   SignatureECDSASHA256,
+	"ecdsa-sha384":   SignatureECDSASHA384,
+}
+
+var digestAlgorithmNames = map[string]DigestAlgorithm{
+	"sha256": DigestSHA256,
+	"sha512": DigestSHA512,
+}
+
+func (p fileProfile) config() (Config, error) {
+	cfg := Config{
+		MerchantID:             p.MerchantID,
+		ChildMerchantIDs:       p.ChildMerchantIDs,
+		AuthMode:               AuthMode(p.AuthMode),
+		P12Path:                p.P12Path,
+		P12Password:            p.P12Password,
+		TransactionKey:         p.TransactionKey,
+		Env:                    EnvSandbox,
+		BaseURL:                p.BaseURL,
+		Endpoints:              p.Endpoints,
+		EndpointCooldown:       time.Duration(p.EndpointCooldown),
+		Timeout:                time.Duration(p.Timeout),
+		StrictTotals:           bool(p.StrictTotals),
+		RateLimit:              float64(p.RateLimit),
+		RateBurst:              int(p.RateBurst),
+		MaxInFlight:            int(p.MaxInFlight),
+		RateLimitFailFast:      bool(p.RateLimitFailFast),
+		DecisionManagerProfile: p.DecisionManagerProfile,
+		DryRun:                 bool(p.DryRun),
+	}
+
+	if r := p.Retry; r != nil {
+		cfg.Retry = &RetryPolicy{
+			MaxAttempts: int(r.MaxAttempts),
+			Backoff:     time.Duration(r.Backoff),
+		}
+	}
+
+	if p.Env != "" {
+		env, err := ParseEnvironment(p.Env)
+		if err != nil {
+			return Config{}, fmt.Errorf("env: %w", err)
+		}
+		cfg.Env = env
+	}
+
+	if cb := p.CircuitBreaker; cb != nil {
+		cfg.CircuitBreaker = &CircuitBreakerConfig{
+			FailureThreshold:   int(cb.FailureThreshold),
+			Cooldown:           time.Duration(cb.Cooldown),
+			FallbackDecision:   cb.FallbackDecision,
+			FallbackReasonCode: int(cb.FallbackReasonCode),
+		}
+	}
+
+	cfg.Signing = SigningOptions{
+		InclusivePrefixes: p.Signing.InclusivePrefixes,
+		TimestampTTL:      time.Duration(p.Signing.TimestampTTL),
+		RandomIDs:         bool(p.Signing.RandomIDs),
+		Streaming:         bool(p.Signing.Streaming),
+	}
+	if alg := p.Signing.SignatureAlgorithm; alg != "" {
+		if named, ok := signatureAlgorithmNames[strings.ToLower(alg)]; ok {
+			cfg.Signing.SignatureAlgorithm = named
+		} else if _, ok := signatureMethods[SignatureAlgorithm(alg)]; ok {
+			cfg.Signing.SignatureAlgorithm = SignatureAlgorithm(alg)
+		} else {
+			return Config{}, fmt.Errorf("signing.signature_algorithm: unknown algorithm %q", alg)
+		}
+	}
+	if alg := p.Signing.DigestAlgorithm; alg != "" {
+		if named, ok := digestAlgorithmNames[strings.ToLower(alg)]; ok {
+			cfg.Signing.DigestAlgorithm = named
+		} else {
+			cfg.Signing.DigestAlgorithm = DigestAlgorithm(alg)
+			if _, err := cfg.Signing.digestHash(); err != nil {
+				return Config{}, fmt.Errorf("signing.digest_algorithm: unknown algorithm %q", alg)
+			}
+		}
+	}
+
+	if len(p.MDDSchema) > 0 {
+		fields := make([]models.MDDField, len(p.MDDSchema))
+		for i, f := range p.MDDSchema {
+			fields[i] = models.MDDField{
+				Name:          f.Name,
+				Index:         int(f.Index),
+				MaxLength:     int(f.MaxLength),
+				AllowedValues: f.AllowedValues,
+				PII:           bool(f.PII),
+			}
+		}
+		schema, err := models.NewMDDSchema(fields...)
+		if err != nil {
+			return Config{}, fmt.Errorf("mdd_schema: %w", err)
+		}
+		cfg.MDDSchema = schema
+	}
+
+	if p.LogLevel != "" {
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(p.LogLevel)); err != nil {
+			return Config{}, fmt.Errorf("log_level: %w", err)
+		}
+		cfg.Logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+	}
+	return cfg, nil
+}
+
+// fileDuration is a time.Duration written as a string such as "30s".
+type fileDuration time.Duration
+
+func (d *fileDuration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"30s\", got %s", data)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = fileDuration(parsed)
+	return nil
+}
+
+// fileInt, fileFloat and fileBool accept a JSON number or boolean, or the
+// same written as a string, e.g. after ${ENV} interpolation. Like the
+// built-in types they leave the value unchanged on null.
+type (
+	fileInt   int
+	fileFloat float64
+	fileBool  bool
+)
+
+func (n *fileInt) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	v, err := strconv.Atoi(scalarText(data))
+	if err != nil {
+		return fmt.Errorf("want an integer, got %s", data)
+	}
+	*n = fileInt(v)
+	return nil
+}
+
+func (f *fileFloat) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	v, err := strconv.ParseFloat(scalarText(data), 64)
+	if err != nil {
+		return fmt.Errorf("want a number, got %s", data)
+	}
+	*f = fileFloat(v)
+	return nil
+}
+
+func (b *fileBool) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	v, err := strconv.ParseBool(scalarText(data))
+	if err != nil {
+		return fmt.Errorf("want true or false, got %s", data)
+	}
+	*b = fileBool(v)
+	return nil
+}
+
+// scalarText returns a JSON scalar as text, unquoting strings.
+func scalarText(data []byte) string {
+	var s string
+	if json.Unmarshal(data, &s) == nil {
+		return strings.TrimSpace(s)
+	}
+	return string(data)
+}
+
+func decodeStrict(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// interpolateEnv expands ${NAME} and ${NAME:-default} in every string
+// value of a decoded YAML or JSON tree. path locates errors.
+func interpolateEnv(v any, path string) (any, error) {
+	switch t := v.(type) {
+	case string:
+		s, err := expandEnv(t)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", strings.TrimPrefix(path, "."), err)
+		}
+		return s, nil
+	case map[string]any:
+		for k, child := range t {
+			expanded, err := interpolateEnv(child, path+"."+k)
+			if err != nil {
+				return nil, err
+			}
+			t[k] = expanded
+		}
+		return t, nil
+	case map[any]any:
+		m := make(map[string]any, len(t))
+		for k, child := range t {
+			m[fmt.Sprint(k)] = child
+		}
+		return interpolateEnv(m, path)
+	case []any:
+		for i, child := range t {
+			expanded, err := interpolateEnv(child, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			t[i] = expanded
+		}
+		return t, nil
+	}
+	return v, nil
+}
+
+func expandEnv(s string) (string, error) {
+	if !strings.Contains(s, "$") {
+		return s, nil
+	}
+	var out strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' {
+			out.WriteByte(s[i])
+			continue
+		}
+		switch {
+		case strings.HasPrefix(s[i:], "$$"):
+			out.WriteByte('$')
+			i++
+		case strings.HasPrefix(s[i:], "${"):
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated ${ in %q", s)
+			}
+			name, def, hasDefault := strings.Cut(s[i+2:i+end], ":-")
+			if name == "" {
+				return "", fmt.Errorf("empty variable name in %q", s)
+			}
+			value, ok := os.LookupEnv(name)
+			if !ok || (value == "" && hasDefault) {
+				if !hasDefault {
+					return "", fmt.Errorf("environment variable %s is not set", name)
+				}
+				value = def
+			}
+			out.WriteString(value)
+			i += end
+		default:
+			out.WriteByte('$')
+		}
+	}
+	return out.String(), nil
+}
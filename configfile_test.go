@@ -0,0 +1,158 @@
+package cybersource_soap_dm
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigFileInterpolatesNumbersAndDurations(t *testing.T) {
+	t.Setenv("CYBS_TEST_TIMEOUT", "12s")
+	t.Setenv("CYBS_TEST_RATE_LIMIT", "2.5")
+	t.Setenv("CYBS_TEST_BURST", "4")
+	t.Setenv("CYBS_TEST_THRESHOLD", "7")
+	t.Setenv("CYBS_TEST_STRICT", "true")
+	t.Setenv("CYBS_TEST_KEY", "secret")
+
+	path := writeConfigFile(t, "cybs.yaml", `
+profile: prod
+defaults:
+  timeout: ${CYBS_TEST_TIMEOUT}
+  retry:
+    max_attempts: ${CYBS_TEST_ATTEMPTS:-3}
+    backoff: ${CYBS_TEST_BACKOFF:-250ms}
+profiles:
+  prod:
+    merchant_id: store_a
+    auth_mode: transaction_key
+    transaction_key: ${CYBS_TEST_KEY}
+    strict_totals: ${CYBS_TEST_STRICT}
+    rate_limit: ${CYBS_TEST_RATE_LIMIT}
+    rate_burst: ${CYBS_TEST_BURST}
+    max_in_flight: 8
+    decision_manager_profile: ${CYBS_TEST_DM_PROFILE:-high_risk}
+    log_level: debug
+    circuit_breaker:
+      failure_threshold: ${CYBS_TEST_THRESHOLD}
+      cooldown: ${CYBS_TEST_COOLDOWN:-1m}
+      fallback_reason_code: "100"
+`)
+	cfg, err := LoadConfigFileProfile(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Timeout != 12*time.Second {
+		t.Errorf("Timeout = %v, want 12s", cfg.Timeout)
+	}
+	if cfg.RateLimit != 2.5 || cfg.RateBurst != 4 || cfg.MaxInFlight != 8 {
+		t.Errorf("RateLimit, RateBurst, MaxInFlight = %v, %d, %d, want 2.5, 4, 8", cfg.RateLimit, cfg.RateBurst, cfg.MaxInFlight)
+	}
+	if !cfg.StrictTotals {
+		t.Error("StrictTotals = false, want true")
+	}
+	if cfg.TransactionKey != "secret" {
+		t.Errorf("TransactionKey = %q, want %q", cfg.TransactionKey, "secret")
+	}
+	if r := cfg.Retry; r == nil || r.MaxAttempts != 3 || r.Backoff != 250*time.Millisecond {
+		t.Errorf("Retry = %+v, want 3 attempts with 250ms backoff", r)
+	}
+	if cfg.DecisionManagerProfile != "high_risk" {
+		t.Errorf("DecisionManagerProfile = %q, want %q", cfg.DecisionManagerProfile, "high_risk")
+	}
+	if cfg.Logger == nil || !cfg.Logger.Enabled(context.Background(), slog.LevelDebug) {
+		t.Error("log_level: debug did not create a Logger enabled at Debug")
+	}
+	cb := cfg.CircuitBreaker
+	if cb == nil || cb.FailureThreshold != 7 || cb.Cooldown != time.Minute || cb.FallbackReasonCode != 100 {
+		t.Errorf("CircuitBreaker = %+v, want threshold 7, cooldown 1m, reason code 100", cb)
+	}
+}
+
+func TestLoadConfigFileJSONNumbers(t *testing.T) {
+	path := writeConfigFile(t, "cybs.json", `{
+  "profiles": {
+    "sandbox": {
+      "merchant_id": "store_a_test",
+      "auth_mode": "transaction_key",
+      "transaction_key": "key",
+      "rate_limit": 10,
+      "rate_burst": 2,
+      "retry": {"max_attempts": 2},
+      "mdd_schema": [{"name": "tier", "index": 1, "max_length": 10}]
+    }
+  }
+}`)
+	cfg, err := LoadConfigFileProfile(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RateLimit != 10 || cfg.RateBurst != 2 {
+		t.Errorf("RateLimit, RateBurst = %v, %d, want 10, 2", cfg.RateLimit, cfg.RateBurst)
+	}
+	if cfg.Retry == nil || cfg.Retry.MaxAttempts != 2 || cfg.Retry.Backoff != 0 {
+		t.Errorf("Retry = %+v, want 2 attempts with the default backoff", cfg.Retry)
+	}
+	if cfg.MDDSchema == nil {
+		t.Error("MDDSchema = nil")
+	}
+}
+
+func TestLoadConfigFileErrors(t *testing.T) {
+	tests := []struct {
+		name, content, want string
+	}{
+		{
+			name:    "unknown key",
+			content: "merchant_id: store_a\nlog_levl: debug\n",
+			want:    `unknown field "log_levl"`,
+		},
+		{
+			name:    "bad log level",
+			content: "merchant_id: store_a\nlog_level: loud\n",
+			want:    "log_level:",
+		},
+		{
+			name:    "non-numeric interpolation",
+			content: "merchant_id: store_a\nrate_burst: ${CYBS_TEST_BURST:-many}\n",
+			want:    `want an integer, got "many"`,
+		},
+		{
+			name:    "unset variable",
+			content: "merchant_id: store_a\ntimeout: ${CYBS_TEST_UNSET_TIMEOUT}\n",
+			want:    "environment variable CYBS_TEST_UNSET_TIMEOUT is not set",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfigFile(t, "cybs.yaml", "profiles:\n  p:\n"+indent(tt.content, "    "))
+			_, err := LoadConfigFileProfile(path, "")
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("err = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func indent(s, prefix string) string {
+	lines := strings.SplitAfter(s, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "")
+}
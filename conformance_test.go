@@ -0,0 +1,162 @@
+package cybersource_soap_dm
+
+import (
+	"errors"
+	"flag"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/beevik/etree"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/golden")
+
+// transactionSchema loads CyberSource's CyberSourceTransaction_<version>.xsd
+// for the transaction-data version the client sends, skipping the test
+// when it has not been vendored into testdata/xsd.
+func transactionSchema(t *testing.T) *xsdValidator {
+	t.Helper()
+	version := strings.TrimPrefix(cybsNS, "urn:schemas-cybersource-com:transaction-data-")
+	path := filepath.Join("testdata", "xsd", "CyberSourceTransaction_"+version+".xsd")
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		t.Skipf("%s is not vendored; see testdata/xsd/README.md", path)
+	}
+	schema, err := loadXSD(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schema.ns != cybsNS {
+		t.Fatalf("%s has target namespace %q, want %q", path, schema.ns, cybsNS)
+	}
+	return schema
+}
+
+// buildFixtureEnvelope builds the unsigned envelope for a fixture with the
+// runtime-dependent client fields pinned, so it can be compared with a
+// golden file.
+func buildFixtureEnvelope(t *testing.T, c *Client, fixture requestFixture) []byte {
+	t.Helper()
+	env := buildTestEnvelope(t, c, fixture.req)
+	env.Body.RequestMessage.ClientLibraryVersion = "go1.x"
+	env.Body.RequestMessage.ClientEnvironment = "linux"
+	data, err := marshalEnvelope(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func requestMessageOf(t *testing.T, envelope []byte) *etree.Element {
+	t.Helper()
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(envelope); err != nil {
+		t.Fatal(err)
+	}
+	body := findChild(doc.Root(), "Body")
+	if body == nil {
+		t.Fatal("envelope has no SOAP Body")
+	}
+	rm := findChild(body, "requestMessage")
+	if rm == nil {
+		t.Fatal("SOAP Body has no requestMessage")
+	}
+	return rm
+}
+
+func TestGoldenEnvelopes(t *testing.T) {
+	c := newTestClient(t, Config{})
+	for _, fixture := range requestFixtures() {
+		t.Run(fixture.name, func(t *testing.T) {
+			got := buildFixtureEnvelope(t, c, fixture)
+			golden := filepath.Join("testdata", "golden", fixture.name+".xml")
+			if *update {
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v (run go test -run TestGoldenEnvelopes -update to create it)", err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("envelope differs from %s:\n%s", golden, lineDiff(string(want), string(got)))
+			}
+		})
+	}
+}
+
+func TestEnvelopesConformToSchema(t *testing.T) {
+	schema := transactionSchema(t)
+	c := newTestClient(t, Config{})
+	for _, fixture := range requestFixtures() {
+		t.Run(fixture.name, func(t *testing.T) {
+			for _, problem := range schema.Validate(requestMessageOf(t, buildFixtureEnvelope(t, c, fixture))) {
+				t.Error(problem)
+			}
+		})
+	}
+}
+
+func TestSchemaRejectsNonConformingMessages(t *testing.T) {
+	schema := transactionSchema(t)
+	c := newTestClient(t, Config{})
+	envelope := buildFixtureEnvelope(t, c, requestFixtures()[0])
+
+	tests := []struct {
+		name   string
+		mutate func(rm *etree.Element)
+		want   string
+	}{
+		{
+			name: "out of order",
+			mutate: func(rm *etree.Element) {
+				card := findChild(rm, "card")
+				rm.RemoveChild(card)
+				rm.InsertChildAt(0, card)
+			},
+			want: "element card is out of schema order",
+		},
+		{
+			name: "unknown element",
+			mutate: func(rm *etree.Element) {
+				rm.CreateElement("ns1:favouriteColour").SetText("blue")
+			},
+			want: "unexpected element favouriteColour",
+		},
+		{
+			name: "missing required element",
+			mutate: func(rm *etree.Element) {
+				rm.RemoveChild(findChild(rm, "merchantID"))
+			},
+			want: "expected merchantID",
+		},
+		{
+			name: "bad attribute value",
+			mutate: func(rm *etree.Element) {
+				findChild(rm, "afsService").CreateAttr("run", "yes")
+			},
+			want: "attribute run",
+		},
+		{
+			name: "wrong namespace",
+			mutate: func(rm *etree.Element) {
+				rm.CreateElement("deviceFingerprintID").SetText("fp")
+			},
+			want: `unexpected element deviceFingerprintID in namespace ""`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rm := requestMessageOf(t, envelope)
+			tt.mutate(rm)
+			problems := schema.Validate(rm)
+			if !strings.Contains(strings.Join(problems, "\n"), tt.want) {
+				t.Fatalf("problems = %q, want one containing %q", problems, tt.want)
+			}
+		})
+	}
+}
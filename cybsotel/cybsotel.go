@@ -0,0 +1,142 @@
+// Package cybsotel provides OpenTelemetry tracing and metrics for the
+// Decision Manager client.
+//
+//	tel, err := cybsotel.New(otel.GetTracerProvider(), otel.GetMeterProvider())
+//	cfg.Telemetry = tel
+//	client, err := cybersource_soap_dm.NewClient(cfg)
+//
+// It is a separate module, so the core package does not depend on
+// OpenTelemetry.
+package cybsotel
+
+import (
+	"context"
+	"fmt"
+
+	dm "github.com/hugochinchilla79/cybersource_soap_dm"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentationName is the tracer and meter name used by this package.
+const InstrumentationName = "github.com/hugochinchilla79/cybersource_soap_dm"
+
+// Telemetry implements cybersource_soap_dm.Telemetry with OpenTelemetry.
+type Telemetry struct {
+	tracer    trace.Tracer
+	duration  metric.Float64Histogram
+	decisions metric.Int64Counter
+	faults    metric.Int64Counter
+	retries   metric.Int64Counter
+}
+
+var _ dm.Telemetry = (*Telemetry)(nil)
+
+// New creates a Telemetry that records spans with tp and metrics with mp.
+//
+// Metrics:
+//
+//	cybersource.dm.duration   histogram (s)  AnalyzeRisk latency
+//	cybersource.dm.decisions  counter        decisions by decision and fallback
+//	cybersource.dm.faults     counter        SOAP faults by fault code
+//	cybersource.dm.retries    counter        endpoint failover retries
+func New(tp trace.TracerProvider, mp metric.MeterProvider) (*Telemetry, error) {
+	meter := mp.Meter(InstrumentationName)
+
+	duration, err := meter.Float64Histogram("cybersource.dm.duration",
+		metric.WithDescription("Duration of Decision Manager risk analysis calls."),
+		metric.WithUnit("s"))
+	if err != nil {
+		return nil, fmt.Errorf("cybsotel: create duration histogram: %w", err)
+	}
+	decisions, err := meter.Int64Counter("cybersource.dm.decisions",
+		metric.WithDescription("Decision Manager decisions."))
+	if err != nil {
+		return nil, fmt.Errorf("cybsotel: create decisions counter: %w", err)
+	}
+	faults, err := meter.Int64Counter("cybersource.dm.faults",
+		metric.WithDescription("SOAP faults returned by CyberSource."))
+	if err != nil {
+		return nil, fmt.Errorf("cybsotel: create faults counter: %w", err)
+	}
+	retries, err := meter.Int64Counter("cybersource.dm.retries",
+		metric.WithDescription("Requests retried on another endpoint after a connection failure."))
+	if err != nil {
+		return nil, fmt.Errorf("cybsotel: create retries counter: %w", err)
+	}
+
+	return &Telemetry{
+		tracer:    tp.Tracer(InstrumentationName),
+		duration:  duration,
+		decisions: decisions,
+		faults:    faults,
+		retries:   retries,
+	}, nil
+}
+
+// StartSpan implements cybersource_soap_dm.Telemetry.
+func (t *Telemetry) StartSpan(ctx context.Context, name string) (context.Context, dm.Span) {
+	kind := trace.SpanKindInternal
+	if name == dm.SpanHTTP {
+		kind = trace.SpanKindClient
+	}
+	ctx, span := t.tracer.Start(ctx, name, trace.WithSpanKind(kind))
+	return ctx, otelSpan{span}
+}
+
+// RecordCall implements cybersource_soap_dm.Telemetry.
+func (t *Telemetry) RecordCall(ctx context.Context, stats dm.CallStats) {
+	outcome := "ok"
+	switch {
+	case stats.FaultCode != "":
+		outcome = "fault"
+	case stats.Err != nil:
+		outcome = "error"
+	}
+	t.duration.Record(ctx, stats.Duration.Seconds(), metric.WithAttributes(attribute.String("outcome", outcome)))
+
+	if stats.Decision != "" {
+		t.decisions.Add(ctx, 1, metric.WithAttributes(
+			attribute.String(dm.AttrDecision, stats.Decision),
+			attribute.Bool(dm.AttrFallback, stats.Fallback),
+		))
+	}
+	if stats.FaultCode != "" {
+		t.faults.Add(ctx, 1, metric.WithAttributes(attribute.String(dm.AttrFaultCode, stats.FaultCode)))
+	}
+}
+
+// RecordRetry implements cybersource_soap_dm.Telemetry.
+func (t *Telemetry) RecordRetry(ctx context.Context, endpoint string) {
+	t.retries.Add(ctx, 1, metric.WithAttributes(attribute.String(dm.AttrEndpoint, endpoint)))
+}
+
+type otelSpan struct {
+	span trace.Span
+}
+
+func (s otelSpan) SetAttribute(key string, value any) {
+	switch v := value.(type) {
+	case string:
+		s.span.SetAttributes(attribute.String(key, v))
+	case int:
+		s.span.SetAttributes(attribute.Int(key, v))
+	case int64:
+		s.span.SetAttributes(attribute.Int64(key, v))
+	case bool:
+		s.span.SetAttributes(attribute.Bool(key, v))
+	default:
+		s.span.SetAttributes(attribute.String(key, fmt.Sprint(v)))
+	}
+}
+
+func (s otelSpan) RecordError(err error) {
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+func (s otelSpan) End() {
+	s.span.End()
+}
@@ -0,0 +1,172 @@
+package cybsotel
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	dm "github.com/hugochinchilla79/cybersource_soap_dm"
+	"github.com/hugochinchilla79/cybersource_soap_dm/models"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const acceptReply = `<?xml version="1.0" encoding="utf-8"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+<soap:Body><c:replyMessage xmlns:c="urn:schemas-cybersource-com:transaction-data-1.111">
+<c:merchantReferenceCode>otel-1</c:merchantReferenceCode>
+<c:requestID>7000000000000000000001</c:requestID>
+<c:decision>ACCEPT</c:decision>
+<c:reasonCode>100</c:reasonCode>
+</c:replyMessage></soap:Body></soap:Envelope>`
+
+func testRequest() models.RiskAnalysisRequest {
+	return models.RiskAnalysisRequest{
+		MerchantReferenceCode: "otel-1",
+		BillTo: &models.BillTo{
+			FirstName:  "Ada",
+			LastName:   "Lovelace",
+			Street1:    "1 Main St",
+			City:       "Mountain View",
+			State:      "CA",
+			PostalCode: "94043",
+			Country:    "US",
+			Email:      "ada@example.com",
+		},
+		Card: models.Card{Number: "4111111111111111", ExpirationMonth: "12", ExpirationYear: "2030"},
+		PurchaseTotals: models.PurchaseTotals{
+			Currency:         "USD",
+			GrandTotalAmount: models.MustParseAmount("10.00"),
+		},
+	}
+}
+
+// newTelemetry returns a Telemetry backed by an in-memory span recorder
+// and metric reader.
+func newTelemetry(t *testing.T) (*Telemetry, *tracetest.SpanRecorder, *sdkmetric.ManualReader) {
+	t.Helper()
+	spans := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	t.Cleanup(func() {
+		tp.Shutdown(context.Background())
+		mp.Shutdown(context.Background())
+	})
+
+	tel, err := New(tp, mp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tel, spans, reader
+}
+
+func collect(t *testing.T, reader *sdkmetric.ManualReader) map[string]metricdata.Aggregation {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	metrics := map[string]metricdata.Aggregation{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			metrics[m.Name] = m.Data
+		}
+	}
+	return metrics
+}
+
+func TestAnalyzeRiskEmitsSpansAndMetrics(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+		io.WriteString(w, acceptReply)
+	}))
+	defer srv.Close()
+
+	tel, spans, reader := newTelemetry(t)
+	client, err := dm.NewClient(dm.Config{
+		MerchantID:        "testmerchant",
+		AuthMode:          dm.AuthTransactionKey,
+		TransactionKey:    "key",
+		BaseURL:           srv.URL,
+		AllowInsecureHTTP: true,
+		Telemetry:         tel,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.AnalyzeRisk(context.Background(), testRequest()); err != nil {
+		t.Fatal(err)
+	}
+
+	ended := map[string]sdktrace.ReadOnlySpan{}
+	for _, s := range spans.Ended() {
+		ended[s.Name()] = s
+	}
+	root, ok := ended[dm.SpanAnalyzeRisk]
+	if !ok {
+		t.Fatalf("no %s span among %d ended spans", dm.SpanAnalyzeRisk, len(ended))
+	}
+	if !hasAttr(root.Attributes(), attribute.String(dm.AttrDecision, "ACCEPT")) {
+		t.Errorf("%s attributes = %v, want %s=ACCEPT", dm.SpanAnalyzeRisk, root.Attributes(), dm.AttrDecision)
+	}
+	httpSpan, ok := ended[dm.SpanHTTP]
+	if !ok {
+		t.Fatalf("no %s span", dm.SpanHTTP)
+	}
+	if httpSpan.SpanKind() != trace.SpanKindClient {
+		t.Errorf("%s kind = %v, want client", dm.SpanHTTP, httpSpan.SpanKind())
+	}
+	if httpSpan.Parent().SpanID() != root.SpanContext().SpanID() {
+		t.Errorf("%s is not a child of %s", dm.SpanHTTP, dm.SpanAnalyzeRisk)
+	}
+
+	metrics := collect(t, reader)
+	duration, ok := metrics["cybersource.dm.duration"].(metricdata.Histogram[float64])
+	if !ok || len(duration.DataPoints) != 1 || duration.DataPoints[0].Count != 1 {
+		t.Errorf("cybersource.dm.duration = %+v, want one observation", metrics["cybersource.dm.duration"])
+	}
+	decisions, ok := metrics["cybersource.dm.decisions"].(metricdata.Sum[int64])
+	if !ok || len(decisions.DataPoints) != 1 {
+		t.Fatalf("cybersource.dm.decisions = %+v, want one data point", metrics["cybersource.dm.decisions"])
+	}
+	dp := decisions.DataPoints[0]
+	if dp.Value != 1 || !dp.Attributes.HasValue(dm.AttrDecision) || !hasAttr(dp.Attributes.ToSlice(), attribute.Bool(dm.AttrFallback, false)) {
+		t.Errorf("decisions data point = %+v, want 1 ACCEPT without fallback", dp)
+	}
+}
+
+func TestRecordCallAndRetry(t *testing.T) {
+	tel, _, reader := newTelemetry(t)
+	ctx := context.Background()
+	tel.RecordCall(ctx, dm.CallStats{FaultCode: "c:ServerError"})
+	tel.RecordRetry(ctx, "https://ics2wsa.ic3.com/commerce/1.x/transactionProcessor")
+
+	metrics := collect(t, reader)
+	faults, ok := metrics["cybersource.dm.faults"].(metricdata.Sum[int64])
+	if !ok || len(faults.DataPoints) != 1 || !hasAttr(faults.DataPoints[0].Attributes.ToSlice(), attribute.String(dm.AttrFaultCode, "c:ServerError")) {
+		t.Errorf("cybersource.dm.faults = %+v, want one c:ServerError", metrics["cybersource.dm.faults"])
+	}
+	if _, ok := metrics["cybersource.dm.decisions"]; ok {
+		t.Error("a fault without a decision recorded a decision")
+	}
+	retries, ok := metrics["cybersource.dm.retries"].(metricdata.Sum[int64])
+	if !ok || len(retries.DataPoints) != 1 || retries.DataPoints[0].Value != 1 {
+		t.Errorf("cybersource.dm.retries = %+v, want 1", metrics["cybersource.dm.retries"])
+	}
+}
+
+func hasAttr(attrs []attribute.KeyValue, want attribute.KeyValue) bool {
+	for _, kv := range attrs {
+		if kv == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,197 @@
+// Package cybsprom exports Prometheus metrics for the Decision Manager client.
+//
+//	client, err := cybsprom.NewClient(cfg, prometheus.DefaultRegisterer)
+//
+// Metrics (with the default "cybersource_dm" namespace):
+//
+//	cybersource_dm_request_duration_seconds      histogram by outcome
+//	cybersource_dm_decisions_total               counter by decision and fallback
+//	cybersource_dm_reason_codes_total            counter by reason code
+//	cybersource_dm_soap_faults_total             counter by fault code
+//	cybersource_dm_http_errors_total             counter by HTTP status
+//	cybersource_dm_endpoint_retries_total        counter by endpoint
+//	cybersource_dm_certificate_expiry_days       gauge, days until the P12 leaf expires
+//	                                             (NaN without a certificate, e.g. with a transaction key)
+//
+// It is a separate module, so the core package does not depend on
+// Prometheus.
+package cybsprom
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	dm "github.com/hugochinchilla79/cybersource_soap_dm"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultNamespace is the metric namespace used by NewClient.
+const DefaultNamespace = "cybersource_dm"
+
+// Metrics implements cybersource_soap_dm.Telemetry by updating Prometheus
+// collectors. It does not record spans.
+type Metrics struct {
+	dm.NoopTelemetry
+
+	duration    *prometheus.HistogramVec
+	decisions   *prometheus.CounterVec
+	reasonCodes *prometheus.CounterVec
+	faults      *prometheus.CounterVec
+	httpErrors  *prometheus.CounterVec
+	retries     *prometheus.CounterVec
+	certExpiry  prometheus.GaugeFunc
+
+	mu   sync.RWMutex
+	cert *x509.Certificate
+}
+
+var _ dm.Telemetry = (*Metrics)(nil)
+
+// NewMetrics creates the collectors under the given namespace.
+// They must be registered with Register.
+func NewMetrics(namespace string) *Metrics {
+	m := &Metrics{
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "request_duration_seconds",
+			Help:      "Duration of Decision Manager risk analysis calls.",
+			Buckets:   []float64{.05, .1, .25, .5, 1, 2, 5, 10, 30},
+		}, []string{"outcome"}),
+		decisions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "decisions_total",
+			Help:      "Decision Manager decisions.",
+		}, []string{"decision", "fallback"}),
+		reasonCodes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "reason_codes_total",
+			Help:      "Decision Manager reply reason codes.",
+		}, []string{"reason_code"}),
+		faults: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "soap_faults_total",
+			Help:      "SOAP faults returned by CyberSource.",
+		}, []string{"fault_code"}),
+		httpErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_errors_total",
+			Help:      "Non-2xx HTTP replies from CyberSource that were not SOAP faults.",
+		}, []string{"status"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "endpoint_retries_total",
+			Help:      "Requests retried on another endpoint after a connection failure.",
+		}, []string{"endpoint"}),
+	}
+	m.certExpiry = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "certificate_expiry_days",
+		Help:      "Days until the P12 leaf certificate expires.",
+	}, m.certDaysLeft)
+	return m
+}
+
+// Register registers all collectors with reg. On failure, collectors
+// registered so far are unregistered again.
+func (m *Metrics) Register(reg prometheus.Registerer) error {
+	for i, c := range m.collectors() {
+		if err := reg.Register(c); err != nil {
+			for _, done := range m.collectors()[:i] {
+				reg.Unregister(done)
+			}
+			return fmt.Errorf("cybsprom: register collector: %w", err)
+		}
+	}
+	return nil
+}
+
+// Unregister removes all collectors from reg.
+func (m *Metrics) Unregister(reg prometheus.Registerer) {
+	for _, c := range m.collectors() {
+		reg.Unregister(c)
+	}
+}
+
+func (m *Metrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.duration, m.decisions, m.reasonCodes, m.faults, m.httpErrors, m.retries, m.certExpiry,
+	}
+}
+
+// SetCertificate sets the certificate reported by the expiry gauge,
+// typically client.Certificate().
+func (m *Metrics) SetCertificate(cert *x509.Certificate) {
+	m.mu.Lock()
+	m.cert = cert
+	m.mu.Unlock()
+}
+
+// RecordCall implements cybersource_soap_dm.Telemetry.
+func (m *Metrics) RecordCall(_ context.Context, stats dm.CallStats) {
+	outcome := "ok"
+	var httpErr *dm.HTTPError
+	switch {
+	case stats.FaultCode != "":
+		outcome = "fault"
+		m.faults.WithLabelValues(stats.FaultCode).Inc()
+	case errors.As(stats.Err, &httpErr):
+		outcome = "http_error"
+		m.httpErrors.WithLabelValues(strconv.Itoa(httpErr.StatusCode)).Inc()
+	case stats.Err != nil:
+		outcome = "error"
+	}
+	m.duration.WithLabelValues(outcome).Observe(stats.Duration.Seconds())
+
+	if stats.Decision != "" {
+		m.decisions.WithLabelValues(stats.Decision, strconv.FormatBool(stats.Fallback)).Inc()
+		m.reasonCodes.WithLabelValues(strconv.Itoa(stats.ReasonCode)).Inc()
+	}
+}
+
+// RecordRetry implements cybersource_soap_dm.Telemetry.
+func (m *Metrics) RecordRetry(_ context.Context, endpoint string) {
+	m.retries.WithLabelValues(endpoint).Inc()
+}
+
+// certDaysLeft returns NaN without a certificate, so expiry alerts such as
+// "< 30" do not fire for transaction key clients.
+func (m *Metrics) certDaysLeft() float64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.cert == nil {
+		return math.NaN()
+	}
+	return time.Until(m.cert.NotAfter).Hours() / 24
+}
+
+// NewClient creates a client whose calls are recorded in Prometheus
+// collectors registered with reg. Telemetry already set in cfg keeps
+// receiving calls alongside the metrics. The collectors are registered
+// first, so a registration failure (e.g. a second client on the same
+// registerer) does not build a client; they are unregistered again if the
+// client cannot be created.
+func NewClient(cfg dm.Config, reg prometheus.Registerer) (*dm.Client, error) {
+	m := NewMetrics(DefaultNamespace)
+	if err := m.Register(reg); err != nil {
+		return nil, err
+	}
+	if cfg.Telemetry != nil {
+		cfg.Telemetry = dm.MultiTelemetry(cfg.Telemetry, m)
+	} else {
+		cfg.Telemetry = m
+	}
+
+	client, err := dm.NewClient(cfg)
+	if err != nil {
+		m.Unregister(reg)
+		return nil, err
+	}
+	m.SetCertificate(client.Certificate())
+	return client, nil
+}
@@ -0,0 +1,65 @@
+package cybsprom
+
+import (
+	"math"
+	"testing"
+
+	dm "github.com/hugochinchilla79/cybersource_soap_dm"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func transactionKeyConfig() dm.Config {
+	return dm.Config{
+		MerchantID:     "testmerchant",
+		AuthMode:       dm.AuthTransactionKey,
+		TransactionKey: "key",
+	}
+}
+
+func gaugeValue(t *testing.T, reg *prometheus.Registry, name string) (float64, bool) {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range families {
+		if f.GetName() == name {
+			return f.GetMetric()[0].GetGauge().GetValue(), true
+		}
+	}
+	return 0, false
+}
+
+func TestCertificateExpiryNaNWithoutCertificate(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	if _, err := NewClient(transactionKeyConfig(), reg); err != nil {
+		t.Fatal(err)
+	}
+	v, ok := gaugeValue(t, reg, "cybersource_dm_certificate_expiry_days")
+	if !ok {
+		t.Fatal("certificate_expiry_days not gathered")
+	}
+	if !math.IsNaN(v) {
+		t.Errorf("certificate_expiry_days = %v without a certificate, want NaN", v)
+	}
+}
+
+func TestNewClientRegistrationFailure(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	if _, err := NewClient(transactionKeyConfig(), reg); err != nil {
+		t.Fatal(err)
+	}
+	if client, err := NewClient(transactionKeyConfig(), reg); err == nil || client != nil {
+		t.Errorf("second NewClient on one registry = %v, %v; want nil client and error", client, err)
+	}
+}
+
+func TestNewClientInvalidConfigUnregisters(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	if _, err := NewClient(dm.Config{}, reg); err == nil {
+		t.Fatal("NewClient with empty config: want error")
+	}
+	if _, err := NewClient(transactionKeyConfig(), reg); err != nil {
+		t.Errorf("NewClient after a failed one: %v (collectors left registered)", err)
+	}
+}
@@ -0,0 +1,29 @@
+module github.com/hugochinchilla79/cybersource_soap_dm/cybsprom
+
+go 1.23.0
+
+// Development against a checkout of the core module uses a workspace, which
+// is not committed: go work init . ./cybsotel ./cybsprom
+
+require (
+	github.com/hugochinchilla79/cybersource_soap_dm v0.0.0-20261018163830-62298f882900
+	github.com/prometheus/client_golang v1.20.5
+)
+
+require (
+	github.com/beevik/etree v1.6.0 // indirect
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/joho/godotenv v1.5.1 // indirect
+	github.com/jonboulle/clockwork v0.5.0 // indirect
+	github.com/munnerz/goautoneg v0.0.0-20191010083416-a7dc8b61c822 // indirect
+	github.com/prometheus/client_model v0.6.1 // indirect
+	github.com/prometheus/common v0.55.0 // indirect
+	github.com/prometheus/procfs v0.15.1 // indirect
+	github.com/russellhaering/goxmldsig v1.5.0 // indirect
+	golang.org/x/crypto v0.11.0 // indirect
+	golang.org/x/sys v0.34.0 // indirect
+	google.golang.org/protobuf v1.34.2 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+	software.sslmate.com/src/go-pkcs12 v0.7.0 // indirect
+)
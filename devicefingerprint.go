@@ -0,0 +1,17 @@
+package cybersource_soap_dm
+
+import "github.com/hugochinchilla79/cybersource_soap_dm/devicefingerprint"
+
+// DeviceFingerprintProfile returns the profiling tag settings for a session,
+// using the ThreatMetrix organization ID of the configured environment.
+func (c Config) DeviceFingerprintProfile(sessionID string) devicefingerprint.Profile {
+	orgID := devicefingerprint.SandboxOrgID
+	if c.Env == EnvProduction {
+		orgID = devicefingerprint.ProductionOrgID
+	}
+	return devicefingerprint.Profile{
+		OrgID:      orgID,
+		MerchantID: c.MerchantID,
+		SessionID:  sessionID,
+	}
+}
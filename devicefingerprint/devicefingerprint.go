@@ -0,0 +1,130 @@
+// Package devicefingerprint generates Decision Manager device fingerprint
+// session IDs and builds the ThreatMetrix profiling tags that collect the
+// device data for them.
+//
+// The same session ID is used twice: the checkout page loads the profiling
+// tag with session_id set to the merchant ID followed by the session ID,
+// and the server sends the bare session ID as deviceFingerprintID in the
+// risk analysis request.
+package devicefingerprint
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/url"
+	"strings"
+)
+
+// ThreatMetrix organization IDs for CyberSource device fingerprinting.
+const (
+	SandboxOrgID    = "1snn5n9w"
+	ProductionOrgID = "k8vif92e"
+)
+
+// DefaultHost is the ThreatMetrix profiling host.
+const DefaultHost = "h.online-metrix.net"
+
+// MaxSessionIDLength is the maximum length of a deviceFingerprintID.
+const MaxSessionIDLength = 88
+
+// NewSessionID returns a random 32-character hexadecimal session ID.
+func NewSessionID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("devicefingerprint: generate session id: %w", err)
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+// ValidateSessionID checks that a session ID is 1-88 characters of
+// letters, digits, hyphens and underscores.
+func ValidateSessionID(id string) error {
+	if id == "" {
+		return fmt.Errorf("devicefingerprint: session id is empty")
+	}
+	if len(id) > MaxSessionIDLength {
+		return fmt.Errorf("devicefingerprint: session id is %d characters, max %d", len(id), MaxSessionIDLength)
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return fmt.Errorf("devicefingerprint: session id contains invalid character %q", c)
+		}
+	}
+	return nil
+}
+
+// Profile describes one device profiling session.
+type Profile struct {
+	// OrgID is the ThreatMetrix organization ID: SandboxOrgID or ProductionOrgID.
+	OrgID string
+
+	// MerchantID is the CyberSource merchant ID.
+	MerchantID string
+
+	// SessionID is the session ID that is later sent as deviceFingerprintID.
+	SessionID string
+
+	// Host optionally overrides DefaultHost, e.g. for a first-party
+	// profiling domain configured with CyberSource.
+	Host string
+}
+
+// Validate checks that the profile can produce a usable tag.
+func (p Profile) Validate() error {
+	if p.OrgID == "" {
+		return fmt.Errorf("devicefingerprint: OrgID is required")
+	}
+	if p.MerchantID == "" {
+		return fmt.Errorf("devicefingerprint: MerchantID is required")
+	}
+	return ValidateSessionID(p.SessionID)
+}
+
+// ProfilingSessionID returns the session_id value for the profiling tag:
+// the merchant ID immediately followed by the session ID.
+func (p Profile) ProfilingSessionID() string {
+	return p.MerchantID + p.SessionID
+}
+
+// ScriptURL returns the URL of the tags.js profiling script.
+func (p Profile) ScriptURL() string {
+	return p.tagURL("/fp/tags.js")
+}
+
+// IframeURL returns the URL of the profiling iframe used when JavaScript is disabled.
+func (p Profile) IframeURL() string {
+	return p.tagURL("/fp/tags")
+}
+
+// HTML returns the script tag and noscript iframe to embed in the checkout page.
+func (p Profile) HTML() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "<script type=\"text/javascript\" src=\"%s\"></script>\n", html.EscapeString(p.ScriptURL()))
+	fmt.Fprintf(&b, "<noscript>\n  <iframe style=\"width: 100px; height: 100px; border: 0; position: absolute; top: -5000px;\" src=\"%s\"></iframe>\n</noscript>\n", html.EscapeString(p.IframeURL()))
+	return b.String()
+}
+
+// JS returns a JavaScript snippet that loads the profiling script
+// dynamically, for single-page checkouts that cannot render HTML tags.
+// The URL is a JSON string literal with <, > and & escaped, so the snippet
+// is safe to inline in a <script> element.
+func (p Profile) JS() string {
+	src, _ := json.Marshal(p.ScriptURL()) // a string always marshals
+	return fmt.Sprintf("(function(){var s=document.createElement(\"script\");s.type=\"text/javascript\";s.async=true;s.src=%s;document.head.appendChild(s);})();\n", src)
+}
+
+func (p Profile) tagURL(path string) string {
+	host := p.Host
+	if host == "" {
+		host = DefaultHost
+	}
+	q := url.Values{}
+	q.Set("org_id", p.OrgID)
+	q.Set("session_id", p.ProfilingSessionID())
+	u := url.URL{Scheme: "https", Host: host, Path: path, RawQuery: q.Encode()}
+	return u.String()
+}
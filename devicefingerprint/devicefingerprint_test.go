@@ -0,0 +1,108 @@
+package devicefingerprint
+
+import (
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestNewSessionID(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		id, err := NewSessionID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !regexp.MustCompile(`^[0-9a-f]{32}$`).MatchString(id) {
+			t.Fatalf("NewSessionID() = %q, want 32 lowercase hex characters", id)
+		}
+		if err := ValidateSessionID(id); err != nil {
+			t.Fatalf("ValidateSessionID(%q) = %v", id, err)
+		}
+		if seen[id] {
+			t.Fatalf("NewSessionID() returned %q twice", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestValidateSessionID(t *testing.T) {
+	tests := []struct {
+		id      string
+		wantErr bool
+	}{
+		{"a", false},
+		{"Session_1-abc", false},
+		{strings.Repeat("a", MaxSessionIDLength), false},
+		{"", true},
+		{strings.Repeat("a", MaxSessionIDLength+1), true},
+		{"session 1", true},
+		{"session.1", true},
+		{"séance", true},
+	}
+	for _, tt := range tests {
+		if err := ValidateSessionID(tt.id); (err != nil) != tt.wantErr {
+			t.Errorf("ValidateSessionID(%q) = %v, want error %v", tt.id, err, tt.wantErr)
+		}
+	}
+}
+
+func TestProfileURLs(t *testing.T) {
+	p := Profile{OrgID: SandboxOrgID, MerchantID: "store_a", SessionID: "0123456789abcdef0123456789abcdef"}
+	if err := p.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := p.ProfilingSessionID(), "store_a0123456789abcdef0123456789abcdef"; got != want {
+		t.Errorf("ProfilingSessionID() = %q, want %q", got, want)
+	}
+
+	u, err := url.Parse(p.ScriptURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "https" || u.Host != DefaultHost || u.Path != "/fp/tags.js" {
+		t.Errorf("ScriptURL() = %s", u)
+	}
+	if q := u.Query(); q.Get("org_id") != SandboxOrgID || q.Get("session_id") != p.ProfilingSessionID() {
+		t.Errorf("ScriptURL() query = %v", q)
+	}
+
+	p.Host = "fp.example.com"
+	if got := p.IframeURL(); !strings.HasPrefix(got, "https://fp.example.com/fp/tags?") {
+		t.Errorf("IframeURL() with Host = %s", got)
+	}
+}
+
+func TestProfileValidate(t *testing.T) {
+	valid := Profile{OrgID: SandboxOrgID, MerchantID: "store_a", SessionID: "s1"}
+	for name, p := range map[string]Profile{
+		"no org":      {MerchantID: valid.MerchantID, SessionID: valid.SessionID},
+		"no merchant": {OrgID: valid.OrgID, SessionID: valid.SessionID},
+		"bad session": {OrgID: valid.OrgID, MerchantID: valid.MerchantID, SessionID: "s 1"},
+	} {
+		if err := p.Validate(); err == nil {
+			t.Errorf("%s: Validate() = nil, want an error", name)
+		}
+	}
+}
+
+func TestJSEscapesScriptURL(t *testing.T) {
+	p := Profile{OrgID: SandboxOrgID, MerchantID: "store_a", SessionID: "s1", Host: `x"</script><script>alert(1)//`}
+	js := p.JS()
+	if strings.ContainsAny(js, "<>&") {
+		t.Fatalf("JS() has unescaped HTML characters, so inlining it can close the enclosing script element:\n%s", js)
+	}
+	m := regexp.MustCompile(`s\.src=("(?:[^"\\]|\\.)*");`).FindStringSubmatch(js)
+	if m == nil {
+		t.Fatalf("JS() has no string literal src:\n%s", js)
+	}
+	var src string
+	if err := json.Unmarshal([]byte(m[1]), &src); err != nil {
+		t.Fatalf("src %s is not a valid string literal: %v", m[1], err)
+	}
+	if src != p.ScriptURL() {
+		t.Errorf("src = %q, want ScriptURL() %q", src, p.ScriptURL())
+	}
+}
@@ -0,0 +1,54 @@
+package cybersource_soap_dm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hugochinchilla79/cybersource_soap_dm/devicefingerprint"
+	"github.com/hugochinchilla79/cybersource_soap_dm/models"
+)
+
+func TestDeviceFingerprintProfile(t *testing.T) {
+	tests := []struct {
+		env  Environment
+		want string
+	}{
+		{"", devicefingerprint.SandboxOrgID},
+		{EnvSandbox, devicefingerprint.SandboxOrgID},
+		{EnvProduction, devicefingerprint.ProductionOrgID},
+	}
+	for _, tt := range tests {
+		p := Config{MerchantID: "store_a", Env: tt.env}.DeviceFingerprintProfile("s1")
+		if p.OrgID != tt.want || p.MerchantID != "store_a" || p.SessionID != "s1" {
+			t.Errorf("Env %q: profile = %+v, want OrgID %s", tt.env, p, tt.want)
+		}
+	}
+}
+
+// TestDeviceFingerprintSessionRoundTrip checks that the bare session ID
+// given to the profile is accepted and the tag's prefixed one is not.
+func TestDeviceFingerprintSessionRoundTrip(t *testing.T) {
+	c := &Client{cfg: Config{MerchantID: "store_a"}}
+	sessionID, err := devicefingerprint.NewSessionID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := c.cfg.DeviceFingerprintProfile(sessionID)
+
+	req := models.RiskAnalysisRequest{PurchaseTotals: models.PurchaseTotals{Currency: "USD"}, DeviceFingerprintID: sessionID}
+	if _, err := c.validateRequest(req); err != nil {
+		t.Errorf("bare session ID rejected: %v", err)
+	}
+
+	req.DeviceFingerprintID = p.ProfilingSessionID()
+	_, err = c.validateRequest(req)
+	var ve *models.ValidationError
+	if !errors.As(err, &ve) || ve.Field != "deviceFingerprintID" {
+		t.Errorf("profiling session ID %q: err = %v, want a deviceFingerprintID ValidationError", req.DeviceFingerprintID, err)
+	}
+
+	other := &Client{cfg: Config{MerchantID: "store_b"}}
+	if _, err := other.validateRequest(req); err != nil {
+		t.Errorf("another merchant's prefix rejected: %v", err)
+	}
+}
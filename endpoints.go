@@ -0,0 +1,201 @@
+package cybersource_soap_dm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// DefaultEndpointCooldown is how long an endpoint is skipped after a
+// connection failure when Config.EndpointCooldown is not set.
+const DefaultEndpointCooldown = 30 * time.Second
+
+// DefaultRetryBackoff is the wait before the second attempt when
+// RetryPolicy.Backoff is not set.
+const DefaultRetryBackoff = 200 * time.Millisecond
+
+// RetryPolicy retries requests that could not reach any endpoint.
+//
+// An attempt tries every endpoint in turn (see Config.Endpoints). When none
+// of them could be reached, the client waits Backoff, doubling it after
+// each attempt, and tries again, up to MaxAttempts attempts in total. Like
+// failover, retrying is limited to requests that were never written to a
+// connection, so a transaction cannot be processed twice.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts. Zero or one disables
+	// retrying.
+	MaxAttempts int
+
+	// Backoff is the wait before the second attempt. Zero means
+	// DefaultRetryBackoff.
+	Backoff time.Duration
+}
+
+// endpointPool selects the SOAP endpoint for each request. It sticks to the
+// last endpoint that answered and moves down the ordered list only when an
+// endpoint cannot be reached. It is safe for concurrent use.
+type endpointPool struct {
+	urls     []string
+	cooldown time.Duration
+
+	mu        sync.Mutex
+	current   int
+	downUntil []time.Time
+}
+
+func newEndpointPool(urls []string, cooldown time.Duration) *endpointPool {
+	if cooldown <= 0 {
+		cooldown = DefaultEndpointCooldown
+	}
+	return &endpointPool{
+		urls:      urls,
+		cooldown:  cooldown,
+		downUntil: make([]time.Time, len(urls)),
+	}
+}
+
+// order returns the endpoint indexes to try: the sticky endpoint first,
+// then the rest in configured order, with endpoints still cooling down
+// after a failure moved to the end.
+func (p *endpointPool) order() []int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	candidates := make([]int, 0, len(p.urls))
+	candidates = append(candidates, p.current)
+	for i := range p.urls {
+		if i != p.current {
+			candidates = append(candidates, i)
+		}
+	}
+
+	now := time.Now()
+	healthy := make([]int, 0, len(p.urls))
+	var down []int
+	for _, i := range candidates {
+		if now.Before(p.downUntil[i]) {
+			down = append(down, i)
+		} else {
+			healthy = append(healthy, i)
+		}
+	}
+	return append(healthy, down...)
+}
+
+func (p *endpointPool) markUp(i int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.current = i
+	p.downUntil[i] = time.Time{}
+}
+
+func (p *endpointPool) markDown(i int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.downUntil[i] = time.Now().Add(p.cooldown)
+}
+
+// rawReply is an HTTP reply from CyberSource before SOAP parsing.
+type rawReply struct {
+	Status   int
+	Body     []byte
+	Endpoint string
+}
+
+// send posts a signed SOAP envelope and returns the HTTP reply.
+//
+// It fails over to the next endpoint only when the request could not be
+// written to the connection (DNS, dial or TLS errors), and retries per
+// Config.Retry when no endpoint could be reached. Once the request has
+// been sent it is never retried, so a transaction cannot be processed
+// twice.
+func (c *Client) send(ctx context.Context, signedPayload []byte) (rawReply, error) {
+	attempts, backoff := 1, DefaultRetryBackoff
+	if r := c.cfg.Retry; r != nil {
+		attempts = max(r.MaxAttempts, 1)
+		if r.Backoff > 0 {
+			backoff = r.Backoff
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		reply, sent, err := c.sendOnce(ctx, signedPayload, attempt > 1)
+		if sent || attempt == attempts {
+			return reply, err
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return reply, err
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+// sendOnce tries each endpoint in turn. sent is false when no endpoint
+// could be reached, so the request may be retried.
+func (c *Client) sendOnce(ctx context.Context, signedPayload []byte, retry bool) (reply rawReply, sent bool, err error) {
+	var lastErr error
+	for n, i := range c.endpoints.order() {
+		url := c.endpoints.urls[i]
+		if n > 0 || retry {
+			c.telemetry.RecordRetry(ctx, url)
+		}
+		status, body, wrote, err := c.post(ctx, url, signedPayload)
+		if err == nil {
+			c.endpoints.markUp(i)
+			return rawReply{Status: status, Body: body, Endpoint: url}, true, nil
+		}
+		if wrote || ctx.Err() != nil {
+			return rawReply{Status: status, Endpoint: url}, true, err
+		}
+		c.endpoints.markDown(i)
+		c.logFailover(ctx, url, err)
+		lastErr = err
+	}
+	return rawReply{}, false, lastErr
+}
+
+// post sends the payload to one endpoint. wrote reports whether the request
+// was written to the connection, i.e. whether CyberSource may have seen it.
+func (c *Client) post(ctx context.Context, url string, payload []byte) (status int, body []byte, wrote bool, err error) {
+	var mu sync.Mutex
+	trace := &httptrace.ClientTrace{
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			mu.Lock()
+			wrote = true
+			mu.Unlock()
+		},
+	}
+	wroteRequest := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return wrote
+	}
+
+	httpReq, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return 0, nil, false, fmt.Errorf("cybersource_soap_dm: create HTTP request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "text/xml; charset=utf-8")
+	httpReq.Header.Set("SOAPAction", "runTransaction")
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return 0, nil, wroteRequest(), fmt.Errorf("cybersource_soap_dm: send SOAP request to %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, nil, true, fmt.Errorf("cybersource_soap_dm: read response: %w", err)
+	}
+	return resp.StatusCode, respBody, true, nil
+}
@@ -0,0 +1,93 @@
+package cybersource_soap_dm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyTransport fails the first failures requests before they are
+// written, as a refused connection does.
+type flakyTransport struct {
+	next     http.RoundTripper
+	failures int32
+	calls    atomic.Int32
+}
+
+func (f *flakyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if f.calls.Add(1) <= f.failures {
+		return nil, errors.New("connection refused")
+	}
+	return f.next.RoundTrip(req)
+}
+
+func TestSendRetriesUnreachableEndpoints(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name      string
+		retry     *RetryPolicy
+		failures  int32
+		wantErr   bool
+		wantCalls int32
+	}{
+		{"no policy", nil, 1, true, 1},
+		{"recovers", &RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}, 2, false, 3},
+		{"gives up", &RetryPolicy{MaxAttempts: 2, Backoff: time.Millisecond}, 5, true, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flaky := &flakyTransport{failures: tt.failures}
+			c := newTestClient(t, Config{
+				BaseURL:           srv.URL,
+				AllowInsecureHTTP: true,
+				Retry:             tt.retry,
+				WrapTransport: func(next http.RoundTripper) http.RoundTripper {
+					flaky.next = next
+					return flaky
+				},
+			})
+
+			reply, err := c.send(context.Background(), []byte("<Envelope/>"))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("send() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && string(reply.Body) != "ok" {
+				t.Errorf("reply body = %q, want %q", reply.Body, "ok")
+			}
+			if got := flaky.calls.Load(); got != tt.wantCalls {
+				t.Errorf("transport calls = %d, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestSendDoesNotRetryWrittenRequests(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		// Drop the connection after reading the request.
+		conn, _, _ := w.(http.Hijacker).Hijack()
+		conn.Close()
+	}))
+	defer srv.Close()
+
+	c := newTestClient(t, Config{
+		BaseURL:           srv.URL,
+		AllowInsecureHTTP: true,
+		Retry:             &RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond},
+	})
+	if _, err := c.send(context.Background(), []byte("<Envelope/>")); err == nil {
+		t.Fatal("send() error = nil, want the dropped connection")
+	}
+	if got := calls.Load(); got != 1 {
+		t.Errorf("server saw %d requests, want 1", got)
+	}
+}
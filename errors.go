@@ -1,10 +1,15 @@
 package cybersource_soap_dm
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 )
 
+// ErrRateLimited is returned when Config.RateLimitFailFast is set and the
+// client-side rate limit or in-flight cap has been reached.
+var ErrRateLimited = errors.New("cybersource_soap_dm: rate limited")
+
 // HTTPError is returned when CyberSource responds with a non-2xx HTTP status.
 type HTTPError struct {
 	StatusCode int
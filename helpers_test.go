@@ -0,0 +1,188 @@
+package cybersource_soap_dm
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hugochinchilla79/cybersource_soap_dm/models"
+	pkcs12 "software.sslmate.com/src/go-pkcs12"
+)
+
+const testP12Password = "test-password"
+
+var (
+	testRSAKeyOnce sync.Once
+	testRSAKey     *rsa.PrivateKey
+)
+
+// testKey returns a shared RSA key, generated once per test binary.
+func testKey(t testing.TB) *rsa.PrivateKey {
+	t.Helper()
+	testRSAKeyOnce.Do(func() {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			panic(err)
+		}
+		testRSAKey = key
+	})
+	return testRSAKey
+}
+
+// writeTestP12 writes a self-signed certificate for key to a P12 file in a
+// temporary directory and returns its path.
+func writeTestP12(t testing.TB, key crypto.Signer) string {
+	t.Helper()
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(4242),
+		Subject:      pkix.Name{CommonName: "testmerchant"},
+		NotBefore:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:     time.Date(2044, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := pkcs12.Modern2023.Encode(key, cert, nil, testP12Password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "test.p12")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// testECKey returns a new P-256 key.
+func testECKey(t testing.TB) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// newTestClient creates a client for cfg, filling in the merchant ID and a
+// test P12 certificate when they are not set.
+func newTestClient(t testing.TB, cfg Config) *Client {
+	t.Helper()
+	if cfg.MerchantID == "" {
+		cfg.MerchantID = "testmerchant"
+	}
+	if cfg.P12Path == "" && cfg.authMode() == AuthCertificate {
+		cfg.P12Path = writeTestP12(t, testKey(t))
+		cfg.P12Password = testP12Password
+	}
+	c, err := NewClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// testRequest returns a valid card request.
+func testRequest(ref string) models.RiskAnalysisRequest {
+	return models.RiskAnalysisRequest{
+		MerchantReferenceCode: ref,
+		BillTo: &models.BillTo{
+			FirstName:  "Ada",
+			LastName:   "Lovelace",
+			Street1:    "1 Main St",
+			City:       "Mountain View",
+			State:      "CA",
+			PostalCode: "94043",
+			Country:    "US",
+			Email:      "ada@example.com",
+			IPAddress:  "203.0.113.7",
+		},
+		Card: models.Card{Number: "4111111111111111", ExpirationMonth: "12", ExpirationYear: "2030"},
+		PurchaseTotals: models.PurchaseTotals{
+			Currency:         "USD",
+			GrandTotalAmount: models.MustParseAmount("10.00"),
+		},
+	}
+}
+
+// buildTestEnvelope validates and builds req the way AnalyzeRisk does.
+func buildTestEnvelope(t testing.TB, c *Client, req models.RiskAnalysisRequest) soapEnvelope {
+	t.Helper()
+	mdd, err := c.validateRequest(req)
+	if err != nil {
+		t.Fatalf("request is invalid: %v", err)
+	}
+	env, err := c.buildSOAPRequest(req, mdd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return env
+}
+
+// requestFixture is a named valid request covering one payment method or
+// request feature.
+type requestFixture struct {
+	name string
+	req  models.RiskAnalysisRequest
+}
+
+// requestFixtures returns a request for each payment method, plus requests
+// with items, merchant-defined data, a Decision Manager profile and text
+// that needs escaping.
+func requestFixtures() []requestFixture {
+	check := testRequest("fixture-check")
+	check.PaymentMethod = models.Check{
+		AccountNumber:     "4100987654",
+		AccountType:       models.CheckAccountChecking,
+		BankTransitNumber: "011000015",
+		CheckNumber:       "1021",
+	}
+
+	paypal := testRequest("fixture-paypal")
+	paypal.PaymentMethod = models.PayPal{PayerID: "PAYER12345", PayerEmail: "ada@example.com", PayerStatus: "verified"}
+
+	giftCard := testRequest("fixture-giftcard")
+	giftCard.PaymentMethod = models.GiftCard{Number: "6035710000000001", ExpirationMonth: "06", ExpirationYear: "2031"}
+
+	items := testRequest("fixture-items")
+	items.Items = []models.Item{
+		{UnitPrice: models.MustParseAmount("2.50"), Quantity: 2, ProductName: "Notebook", ProductSKU: "nb-1", ProductRisk: models.ProductRiskLow},
+		{UnitPrice: models.MustParseAmount("5.00"), Quantity: 1, ProductName: "Pen", ProductSKU: "pen-1", GiftCategory: true},
+	}
+
+	mdd := testRequest("fixture-mdd")
+	mdd.MerchantDefinedData = map[int]string{1: "web", 3: "gold", 20: "returning"}
+
+	profile := testRequest("fixture-dm-profile")
+	profile.DecisionManagerProfile = "high_risk"
+
+	escaping := testRequest("fixture-escaping")
+	escaping.BillTo.FirstName = `Zoë "Z" O'Brien`
+	escaping.BillTo.LastName = "Smith & <Sons>"
+	escaping.BillTo.Street1 = "Straße 1 > 0"
+
+	return []requestFixture{
+		{"card", testRequest("fixture-card")},
+		{"check", check},
+		{"paypal", paypal},
+		{"giftcard", giftCard},
+		{"items", items},
+		{"mdd", mdd},
+		{"dm-profile", profile},
+		{"escaping", escaping},
+	}
+}
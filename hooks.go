@@ -0,0 +1,163 @@
+package cybersource_soap_dm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/hugochinchilla79/cybersource_soap_dm/models"
+)
+
+// Hooks are callbacks invoked at each stage of AnalyzeRisk. All fields are
+// optional. Config.Hooks runs as a chain: for each stage, hooks are called in
+// slice order and the first error aborts the call, wrapped in a *HookError.
+type Hooks struct {
+	// BeforeBuild may modify the request model before it is validated and
+	// built, e.g. to add merchant-defined data from ctx.
+	BeforeBuild func(ctx context.Context, req *models.RiskAnalysisRequest) error
+
+	// AfterBuild receives the unsigned SOAP envelope and returns the
+	// envelope to sign, which may be modified.
+	AfterBuild func(ctx context.Context, envelope []byte) ([]byte, error)
+
+	// BeforeSend receives a copy of the signed envelope just before it is
+	// sent. It cannot change what is sent.
+	BeforeSend func(ctx context.Context, signed []byte) error
+
+	// AfterReceive receives the HTTP status and a copy of the raw body of
+	// the reply before it is parsed. An error aborts the call without the
+	// reply counting towards the circuit breaker.
+	AfterReceive func(ctx context.Context, status int, body []byte) error
+
+	// AfterParse may inspect or modify the parsed response. It is only
+	// called when the reply parsed into a decision.
+	AfterParse func(ctx context.Context, resp *models.RiskAnalysisAPIResponse) error
+}
+
+// Hook stage names reported in HookError.
+const (
+	StageBeforeBuild  = "BeforeBuild"
+	StageAfterBuild   = "AfterBuild"
+	StageBeforeSend   = "BeforeSend"
+	StageAfterReceive = "AfterReceive"
+	StageAfterParse   = "AfterParse"
+)
+
+// HookError is returned when a hook aborts a call.
+type HookError struct {
+	Stage string
+	Err   error
+}
+
+func (e *HookError) Error() string {
+	return fmt.Sprintf("cybersource_soap_dm: %s hook: %v", e.Stage, e.Err)
+}
+
+func (e *HookError) Unwrap() error { return e.Err }
+
+func (c *Client) runBeforeBuild(ctx context.Context, req *models.RiskAnalysisRequest) error {
+	if len(c.cfg.Hooks) == 0 {
+		return nil
+	}
+	// Hooks get their own copies of the maps, slices and pointed-to values
+	// so that changes never leak into the caller's request.
+	req.Items = slices.Clone(req.Items)
+	req.MerchantDefinedData = maps.Clone(req.MerchantDefinedData)
+	req.MerchantDefinedFields = maps.Clone(req.MerchantDefinedFields)
+	if req.BillTo != nil {
+		billTo := *req.BillTo
+		req.BillTo = &billTo
+	}
+	switch pm := req.PaymentMethod.(type) {
+	case *models.Card:
+		if pm != nil {
+			card := *pm
+			req.PaymentMethod = &card
+		}
+	case *models.Check:
+		if pm != nil {
+			check := *pm
+			req.PaymentMethod = &check
+		}
+	case *models.PayPal:
+		if pm != nil {
+			paypal := *pm
+			req.PaymentMethod = &paypal
+		}
+	case *models.GiftCard:
+		if pm != nil {
+			giftCard := *pm
+			req.PaymentMethod = &giftCard
+		}
+	}
+
+	for _, h := range c.cfg.Hooks {
+		if h.BeforeBuild == nil {
+			continue
+		}
+		if err := h.BeforeBuild(ctx, req); err != nil {
+			return &HookError{Stage: StageBeforeBuild, Err: err}
+		}
+	}
+	return nil
+}
+
+func (c *Client) hasAfterBuildHooks() bool {
+	for _, h := range c.cfg.Hooks {
+		if h.AfterBuild != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Client) runAfterBuild(ctx context.Context, envelope []byte) ([]byte, error) {
+	for _, h := range c.cfg.Hooks {
+		if h.AfterBuild == nil {
+			continue
+		}
+		var err error
+		if envelope, err = h.AfterBuild(ctx, envelope); err != nil {
+			return nil, &HookError{Stage: StageAfterBuild, Err: err}
+		}
+	}
+	return envelope, nil
+}
+
+func (c *Client) runBeforeSend(ctx context.Context, signed []byte) error {
+	for _, h := range c.cfg.Hooks {
+		if h.BeforeSend == nil {
+			continue
+		}
+		if err := h.BeforeSend(ctx, bytes.Clone(signed)); err != nil {
+			return &HookError{Stage: StageBeforeSend, Err: err}
+		}
+	}
+	return nil
+}
+
+func (c *Client) runAfterReceive(ctx context.Context, status int, body []byte) error {
+	for _, h := range c.cfg.Hooks {
+		if h.AfterReceive == nil {
+			continue
+		}
+		if err := h.AfterReceive(ctx, status, bytes.Clone(body)); err != nil {
+			return &HookError{Stage: StageAfterReceive, Err: err}
+		}
+	}
+	return nil
+}
+
+func (c *Client) runAfterParse(ctx context.Context, resp *models.RiskAnalysisAPIResponse) error {
+	for _, h := range c.cfg.Hooks {
+		if h.AfterParse == nil {
+			continue
+		}
+		if err := h.AfterParse(ctx, resp); err != nil {
+			return &HookError{Stage: StageAfterParse, Err: err}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+package cybersource_soap_dm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hugochinchilla79/cybersource_soap_dm/models"
+)
+
+// hookServer replies with reply and keeps the last request body.
+type hookServer struct {
+	status int
+	reply  string
+	calls  atomic.Int32
+	last   atomic.Value // []byte
+}
+
+func (s *hookServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	s.last.Store(body)
+	s.calls.Add(1)
+	if s.status != 0 {
+		w.WriteHeader(s.status)
+	}
+	io.WriteString(w, s.reply)
+}
+
+func newHookClient(t *testing.T, s *hookServer, cfg Config) *Client {
+	t.Helper()
+	if s.reply == "" {
+		s.reply = acceptReply
+	}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	cfg.BaseURL = srv.URL
+	cfg.AllowInsecureHTTP = true
+	return newTestClient(t, cfg)
+}
+
+// recordingHooks returns Hooks that append "<name>.<stage>" to calls.
+func recordingHooks(name string, calls *[]string) Hooks {
+	record := func(stage string) { *calls = append(*calls, name+"."+stage) }
+	return Hooks{
+		BeforeBuild: func(context.Context, *models.RiskAnalysisRequest) error { record(StageBeforeBuild); return nil },
+		AfterBuild: func(_ context.Context, envelope []byte) ([]byte, error) {
+			record(StageAfterBuild)
+			return envelope, nil
+		},
+		BeforeSend:   func(context.Context, []byte) error { record(StageBeforeSend); return nil },
+		AfterReceive: func(context.Context, int, []byte) error { record(StageAfterReceive); return nil },
+		AfterParse:   func(context.Context, *models.RiskAnalysisAPIResponse) error { record(StageAfterParse); return nil },
+	}
+}
+
+func TestHooksChainOrder(t *testing.T) {
+	var calls []string
+	c := newHookClient(t, &hookServer{}, Config{Hooks: []Hooks{recordingHooks("a", &calls), recordingHooks("b", &calls)}})
+	if _, err := c.AnalyzeRisk(context.Background(), testRequest("hooks")); err != nil {
+		t.Fatal(err)
+	}
+	var want []string
+	for _, stage := range []string{StageBeforeBuild, StageAfterBuild, StageBeforeSend, StageAfterReceive, StageAfterParse} {
+		want = append(want, "a."+stage, "b."+stage)
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("hook calls = %v, want %v", calls, want)
+	}
+}
+
+func TestHooksFirstErrorAborts(t *testing.T) {
+	errStop := errors.New("stop")
+	for _, stage := range []string{StageBeforeBuild, StageAfterBuild, StageBeforeSend, StageAfterReceive, StageAfterParse} {
+		t.Run(stage, func(t *testing.T) {
+			var calls []string
+			failing := recordingHooks("a", &calls)
+			switch stage {
+			case StageBeforeBuild:
+				failing.BeforeBuild = func(context.Context, *models.RiskAnalysisRequest) error { return errStop }
+			case StageAfterBuild:
+				failing.AfterBuild = func(context.Context, []byte) ([]byte, error) { return nil, errStop }
+			case StageBeforeSend:
+				failing.BeforeSend = func(context.Context, []byte) error { return errStop }
+			case StageAfterReceive:
+				failing.AfterReceive = func(context.Context, int, []byte) error { return errStop }
+			case StageAfterParse:
+				failing.AfterParse = func(context.Context, *models.RiskAnalysisAPIResponse) error { return errStop }
+			}
+			s := &hookServer{}
+			c := newHookClient(t, s, Config{Hooks: []Hooks{failing, recordingHooks("b", &calls)}})
+
+			_, err := c.AnalyzeRisk(context.Background(), testRequest("hooks"))
+			var hookErr *HookError
+			if !errors.As(err, &hookErr) || hookErr.Stage != stage || !errors.Is(err, errStop) {
+				t.Fatalf("error = %v, want a %s HookError wrapping errStop", err, stage)
+			}
+			for _, call := range calls {
+				if call == "b."+stage {
+					t.Errorf("second %s hook ran after the first failed", stage)
+				}
+			}
+			sent := stage == StageAfterReceive || stage == StageAfterParse
+			if got := s.calls.Load() == 1; got != sent {
+				t.Errorf("request sent = %v, want %v", got, sent)
+			}
+		})
+	}
+}
+
+func TestBeforeBuildDoesNotLeakIntoCallerRequest(t *testing.T) {
+	s := &hookServer{}
+	c := newHookClient(t, s, Config{Hooks: []Hooks{{
+		BeforeBuild: func(_ context.Context, req *models.RiskAnalysisRequest) error {
+			req.BillTo.FirstName = "Eve"
+			req.Items[0].ProductSKU = "changed"
+			req.MerchantDefinedData[1] = "changed"
+			req.MerchantDefinedData[2] = "added"
+			req.PaymentMethod.(*models.Check).CheckNumber = "9999"
+			return nil
+		},
+	}}})
+
+	req := testRequest("hooks-copy")
+	req.Items = []models.Item{{UnitPrice: models.MustParseAmount("10.00"), Quantity: 1, ProductSKU: "sku-1"}}
+	req.MerchantDefinedData = map[int]string{1: "web"}
+	check := &models.Check{AccountNumber: "4100987654", AccountType: models.CheckAccountChecking, BankTransitNumber: "011000015", CheckNumber: "1021"}
+	req.PaymentMethod = check
+	if _, err := c.AnalyzeRisk(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := string(s.last.Load().([]byte))
+	for _, want := range []string{"Eve", "changed", "added", "9999"} {
+		if !strings.Contains(sent, want) {
+			t.Errorf("sent envelope lacks %q from BeforeBuild", want)
+		}
+	}
+	if req.BillTo.FirstName != "Ada" || req.Items[0].ProductSKU != "sku-1" || len(req.MerchantDefinedData) != 1 ||
+		req.MerchantDefinedData[1] != "web" || check.CheckNumber != "1021" {
+		t.Errorf("BeforeBuild changed the caller's request: %+v, check %+v", req, *check)
+	}
+}
+
+func TestAfterBuildAndBeforeSend(t *testing.T) {
+	s := &hookServer{}
+	c := newHookClient(t, s, Config{Hooks: []Hooks{{
+		AfterBuild: func(_ context.Context, envelope []byte) ([]byte, error) {
+			return bytes.Replace(envelope, []byte("hooks-before"), []byte("hooks-after"), 1), nil
+		},
+		BeforeSend: func(_ context.Context, signed []byte) error {
+			clear(signed)
+			return nil
+		},
+	}}})
+	if _, err := c.AnalyzeRisk(context.Background(), testRequest("hooks-before")); err != nil {
+		t.Fatal(err)
+	}
+	sent := s.last.Load().([]byte)
+	if !bytes.Contains(sent, []byte("hooks-after")) {
+		t.Error("AfterBuild rewrite was not sent")
+	}
+	report, err := VerifySignedEnvelope(sent)
+	if err != nil || !report.Valid() {
+		t.Errorf("sent envelope does not verify after BeforeSend changed its copy: %v, %+v", err, report)
+	}
+}
+
+func TestAfterReceiveRunsBeforeParse(t *testing.T) {
+	t.Run("gets a copy", func(t *testing.T) {
+		var status int
+		c := newHookClient(t, &hookServer{}, Config{Hooks: []Hooks{{
+			AfterReceive: func(_ context.Context, st int, body []byte) error {
+				status = st
+				clear(body)
+				return nil
+			},
+		}}})
+		resp, err := c.AnalyzeRisk(context.Background(), testRequest("hooks"))
+		if err != nil {
+			t.Fatalf("reply unparseable after AfterReceive changed its copy: %v", err)
+		}
+		if status != http.StatusOK || resp.Data.Decision != models.DecisionAccept {
+			t.Errorf("status %d, decision %q; want 200, ACCEPT", status, resp.Data.Decision)
+		}
+		if string(resp.Body) != acceptReply {
+			t.Errorf("response Body = %q, want the reply untouched by AfterReceive", resp.Body)
+		}
+	})
+
+	t.Run("sees unparseable replies", func(t *testing.T) {
+		var seen []byte
+		c := newHookClient(t, &hookServer{reply: "<not soap"}, Config{Hooks: []Hooks{{
+			AfterReceive: func(_ context.Context, _ int, body []byte) error {
+				seen = body
+				return errors.New("rejected")
+			},
+		}}})
+		_, err := c.AnalyzeRisk(context.Background(), testRequest("hooks"))
+		var hookErr *HookError
+		if !errors.As(err, &hookErr) || hookErr.Stage != StageAfterReceive {
+			t.Fatalf("error = %v, want the AfterReceive HookError rather than a parse error", err)
+		}
+		if string(seen) != "<not soap" {
+			t.Errorf("AfterReceive saw %q", seen)
+		}
+	})
+
+	t.Run("abort is not a breaker failure", func(t *testing.T) {
+		s := &hookServer{status: http.StatusServiceUnavailable, reply: "unavailable"}
+		c := newHookClient(t, s, Config{
+			CircuitBreaker: &CircuitBreakerConfig{FailureThreshold: 1, Cooldown: time.Hour},
+			Hooks: []Hooks{{
+				AfterReceive: func(context.Context, int, []byte) error { return errors.New("rejected") },
+			}},
+		})
+		for i := 0; i < 3; i++ {
+			if _, err := c.AnalyzeRisk(context.Background(), testRequest("hooks")); errors.Is(err, ErrCircuitOpen) {
+				t.Fatalf("call %d: breaker opened on replies AfterReceive aborted", i+1)
+			}
+		}
+		if got := s.calls.Load(); got != 3 {
+			t.Errorf("server saw %d requests, want 3", got)
+		}
+	})
+}
+
+func TestAfterParseModifiesResponse(t *testing.T) {
+	c := newHookClient(t, &hookServer{}, Config{Hooks: []Hooks{{
+		AfterParse: func(_ context.Context, resp *models.RiskAnalysisAPIResponse) error {
+			resp.Data.Decision = models.DecisionReview
+			return nil
+		},
+	}}})
+	resp, err := c.AnalyzeRisk(context.Background(), testRequest("hooks"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data.Decision != models.DecisionReview {
+		t.Errorf("decision = %q, want the AfterParse change", resp.Data.Decision)
+	}
+}
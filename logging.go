@@ -0,0 +1,44 @@
+package cybersource_soap_dm
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/hugochinchilla79/cybersource_soap_dm/models"
+)
+
+// logCall logs a finished AnalyzeRisk call: failures at Warn, decisions at
+// Debug. Nothing is logged when Config.Logger is nil.
+func (c *Client) logCall(ctx context.Context, req models.RiskAnalysisRequest, stats CallStats) {
+	if c.cfg.Logger == nil {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.String("merchant_reference_code", req.MerchantReferenceCode),
+		slog.Duration("duration", stats.Duration),
+	}
+	if stats.Endpoint != "" {
+		attrs = append(attrs, slog.String("endpoint", stats.Endpoint))
+	}
+	if stats.Err != nil {
+		attrs = append(attrs, slog.Any("error", stats.Err))
+		c.cfg.Logger.LogAttrs(ctx, slog.LevelWarn, "cybersource risk analysis failed", attrs...)
+		return
+	}
+	attrs = append(attrs,
+		slog.String("decision", stats.Decision),
+		slog.Int("reason_code", stats.ReasonCode),
+		slog.String("request_id", stats.RequestID),
+		slog.Bool("fallback", stats.Fallback),
+	)
+	c.cfg.Logger.LogAttrs(ctx, slog.LevelDebug, "cybersource risk analysis", attrs...)
+}
+
+// logFailover logs a connection failure that moves a request to the next endpoint.
+func (c *Client) logFailover(ctx context.Context, endpoint string, err error) {
+	if c.cfg.Logger == nil {
+		return
+	}
+	c.cfg.Logger.LogAttrs(ctx, slog.LevelWarn, "cybersource endpoint unreachable, failing over",
+		slog.String("endpoint", endpoint), slog.Any("error", err))
+}
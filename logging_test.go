@@ -0,0 +1,75 @@
+package cybersource_soap_dm
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestAnalyzeRiskLogsCalls(t *testing.T) {
+	var fail atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, acceptReply)
+	}))
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	c := newTestClient(t, Config{
+		BaseURL:           srv.URL,
+		AllowInsecureHTTP: true,
+		Logger:            slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug})),
+	})
+
+	if _, err := c.AnalyzeRisk(context.Background(), testRequest("logged")); err != nil {
+		t.Fatal(err)
+	}
+	if out := buf.String(); !strings.Contains(out, "level=DEBUG") || !strings.Contains(out, "merchant_reference_code=logged") || !strings.Contains(out, "decision=ACCEPT") {
+		t.Errorf("success log = %q, want a DEBUG record with the reference code and decision", out)
+	}
+
+	buf.Reset()
+	fail.Store(true)
+	if _, err := c.AnalyzeRisk(context.Background(), testRequest("logged")); err == nil {
+		t.Fatal("want an error from a 503 reply")
+	}
+	if out := buf.String(); !strings.Contains(out, "level=WARN") || !strings.Contains(out, "error=") {
+		t.Errorf("failure log = %q, want a WARN record with the error", out)
+	}
+}
+
+func TestDecisionManagerProfileDefault(t *testing.T) {
+	c := newTestClient(t, Config{DecisionManagerProfile: "default_profile"})
+
+	profileOf := func(override string) string {
+		t.Helper()
+		req := testRequest("profile")
+		req.DecisionManagerProfile = override
+		rm := requestMessageOf(t, buildFixtureEnvelope(t, c, requestFixture{"profile", req}))
+		dm := findChild(rm, "decisionManager")
+		if dm == nil {
+			return ""
+		}
+		return findChild(dm, "profile").Text()
+	}
+	if got := profileOf(""); got != "default_profile" {
+		t.Errorf("profile = %q, want the Config default", got)
+	}
+	if got := profileOf("high_risk"); got != "high_risk" {
+		t.Errorf("profile = %q, want the request override", got)
+	}
+
+	c = newTestClient(t, Config{})
+	if got := profileOf(""); got != "" {
+		t.Errorf("profile = %q without any configured, want no decisionManager element", got)
+	}
+}
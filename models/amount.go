@@ -0,0 +1,304 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ErrAmountOverflow is returned when an Amount operation exceeds the
+// representable range (18 significant digits).
+var ErrAmountOverflow = errors.New("amount overflow")
+
+// maxScale is the largest number of fractional digits an Amount may carry.
+const maxScale = 8
+
+// Amount is an exact decimal money amount. It is stored as an integer
+// coefficient and a number of fractional digits, so "10.50" is 1050 with
+// scale 2. The zero value is 0 and is treated as "not set" by optional fields.
+//
+// Amounts marshal to and from their decimal string form (e.g. "10.50").
+type Amount struct {
+	coef  int64
+	scale int
+}
+
+// RoundingMode selects how Round discards fractional digits.
+type RoundingMode int
+
+const (
+	// RoundHalfEven rounds to the nearest value, ties to the even neighbour (banker's rounding).
+	RoundHalfEven RoundingMode = iota
+	// RoundHalfUp rounds to the nearest value, ties away from zero.
+	RoundHalfUp
+	// RoundDown truncates towards zero.
+	RoundDown
+)
+
+// NewAmountFromMinorUnits creates an Amount from an integer count of the
+// currency's minor units, e.g. 1050 USD cents is 10.50 and 1050 JPY is 1050.
+func NewAmountFromMinorUnits(minor int64, currency string) (Amount, error) {
+	exp, ok := CurrencyExponent(currency)
+	if !ok {
+		return Amount{}, fmt.Errorf("unknown ISO 4217 currency %q", currency)
+	}
+	return Amount{coef: minor, scale: exp}, nil
+}
+
+// ParseAmount parses a plain decimal string such as "1000.50" or "-3".
+// Thousands separators, exponents, signs other than a leading "-",
+// whitespace and currency symbols are rejected.
+func ParseAmount(s string) (Amount, error) {
+	digits := s
+	neg := strings.HasPrefix(digits, "-")
+	if neg {
+		digits = digits[1:]
+	}
+	intPart, fracPart, hasDot := strings.Cut(digits, ".")
+	if intPart == "" || !isDigits(intPart) || (hasDot && !isDigits(fracPart)) {
+		return Amount{}, fmt.Errorf("invalid amount %q", s)
+	}
+	if len(fracPart) > maxScale {
+		return Amount{}, fmt.Errorf("invalid amount %q: more than %d decimal places", s, maxScale)
+	}
+	intPart = strings.TrimLeft(intPart, "0")
+	if len(intPart)+len(fracPart) > 18 {
+		return Amount{}, fmt.Errorf("invalid amount %q: %w", s, ErrAmountOverflow)
+	}
+	coef, err := strconv.ParseInt("0"+intPart+fracPart, 10, 64)
+	if err != nil {
+		return Amount{}, fmt.Errorf("invalid amount %q: %w", s, err)
+	}
+	if neg {
+		coef = -coef
+	}
+	return Amount{coef: coef, scale: len(fracPart)}, nil
+}
+
+// MustParseAmount is like ParseAmount but panics on invalid input.
+// It is intended for literals in code and tests.
+func MustParseAmount(s string) Amount {
+	a, err := ParseAmount(s)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+// IsZero reports whether the amount is zero.
+func (a Amount) IsZero() bool { return a.coef == 0 }
+
+// Sign returns -1, 0 or 1 depending on the sign of the amount.
+func (a Amount) Sign() int {
+	switch {
+	case a.coef < 0:
+		return -1
+	case a.coef > 0:
+		return 1
+	}
+	return 0
+}
+
+// Places returns the number of significant fractional digits, ignoring
+// trailing zeros ("10.50" has 1, "10.00" has 0).
+func (a Amount) Places() int {
+	coef, scale := a.coef, a.scale
+	for scale > 0 && coef%10 == 0 {
+		coef /= 10
+		scale--
+	}
+	return scale
+}
+
+// Cmp compares a and b and returns -1, 0 or 1.
+func (a Amount) Cmp(b Amount) int {
+	x, y, err := align(a, b)
+	if err != nil {
+		// Alignment only overflows when rescaling a huge coefficient,
+		// in which case the sign alone decides.
+		return compareInt(a.Sign(), b.Sign())
+	}
+	return compareInt64(x.coef, y.coef)
+}
+
+// Add returns a + b.
+func (a Amount) Add(b Amount) (Amount, error) {
+	x, y, err := align(a, b)
+	if err != nil {
+		return Amount{}, err
+	}
+	sum := x.coef + y.coef
+	if (y.coef > 0 && sum < x.coef) || (y.coef < 0 && sum > x.coef) {
+		return Amount{}, ErrAmountOverflow
+	}
+	return Amount{coef: sum, scale: x.scale}, nil
+}
+
+// Mul returns a multiplied by an integer quantity.
+func (a Amount) Mul(n int64) (Amount, error) {
+	if a.coef == 0 || n == 0 {
+		return Amount{scale: a.scale}, nil
+	}
+	p := a.coef * n
+	if p/n != a.coef || (a.coef == -1 && n == math.MinInt64) || (n == -1 && a.coef == math.MinInt64) {
+		return Amount{}, ErrAmountOverflow
+	}
+	return Amount{coef: p, scale: a.scale}, nil
+}
+
+// Round returns the amount rounded to the given number of fractional digits.
+func (a Amount) Round(places int, mode RoundingMode) Amount {
+	if places < 0 {
+		places = 0
+	}
+	if places >= a.scale {
+		return a
+	}
+	div := pow10(a.scale - places)
+	q, r := a.coef/div, a.coef%div
+	if r != 0 {
+		away := false
+		half := abs64(r) * 2
+		switch mode {
+		case RoundHalfUp:
+			away = half >= div
+		case RoundHalfEven:
+			away = half > div || (half == div && q%2 != 0)
+		}
+		if away {
+			if a.coef < 0 {
+				q--
+			} else {
+				q++
+			}
+		}
+	}
+	return Amount{coef: q, scale: places}
+}
+
+// RoundToCurrency rounds the amount to the minor units of an ISO 4217 currency.
+func (a Amount) RoundToCurrency(currency string, mode RoundingMode) (Amount, error) {
+	exp, ok := CurrencyExponent(currency)
+	if !ok {
+		return Amount{}, fmt.Errorf("unknown ISO 4217 currency %q", currency)
+	}
+	return a.Round(exp, mode), nil
+}
+
+// ValidateCurrency checks that the currency is a known ISO 4217 code and that
+// the amount has no more fractional digits than the currency's minor unit
+// allows (e.g. "12.345" is rejected for JPY and USD).
+func (a Amount) ValidateCurrency(currency string) error {
+	exp, ok := CurrencyExponent(currency)
+	if !ok {
+		return fmt.Errorf("unknown ISO 4217 currency %q", currency)
+	}
+	if p := a.Places(); p > exp {
+		return fmt.Errorf("amount %s has %d decimal places, %s allows %d", a, p, currency, exp)
+	}
+	return nil
+}
+
+// Format returns the canonical string for the given currency: exactly as many
+// fractional digits as the currency's minor unit, e.g. "10.50" for USD and
+// "1050" for JPY. Unknown currencies fall back to String. The amount must
+// already satisfy ValidateCurrency; extra digits are rounded half-even.
+func (a Amount) Format(currency string) string {
+	exp, ok := CurrencyExponent(currency)
+	if !ok {
+		return a.String()
+	}
+	r := a.Round(exp, RoundHalfEven)
+	if r.scale < exp {
+		if scaled, err := r.rescale(exp); err == nil {
+			r = scaled
+		}
+	}
+	return r.String()
+}
+
+// String returns the amount in plain decimal notation, keeping its scale
+// (e.g. "10.50", "-3", "0.005").
+func (a Amount) String() string {
+	s := strconv.FormatInt(abs64(a.coef), 10)
+	if a.scale > 0 {
+		if len(s) <= a.scale {
+			s = strings.Repeat("0", a.scale-len(s)+1) + s
+		}
+		s = s[:len(s)-a.scale] + "." + s[len(s)-a.scale:]
+	}
+	if a.coef < 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (a Amount) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (a *Amount) UnmarshalText(text []byte) error {
+	parsed, err := ParseAmount(string(text))
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+func (a Amount) rescale(scale int) (Amount, error) {
+	if scale <= a.scale {
+		return a, nil
+	}
+	m := pow10(scale - a.scale)
+	if a.coef != 0 && abs64(a.coef) > math.MaxInt64/m {
+		return Amount{}, ErrAmountOverflow
+	}
+	return Amount{coef: a.coef * m, scale: scale}, nil
+}
+
+func align(a, b Amount) (Amount, Amount, error) {
+	scale := max(a.scale, b.scale)
+	x, err := a.rescale(scale)
+	if err != nil {
+		return Amount{}, Amount{}, err
+	}
+	y, err := b.rescale(scale)
+	if err != nil {
+		return Amount{}, Amount{}, err
+	}
+	return x, y, nil
+}
+
+func pow10(n int) int64 {
+	p := int64(1)
+	for i := 0; i < n; i++ {
+		p *= 10
+	}
+	return p
+}
+
+func abs64(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareInt(a, b int) int {
+	return compareInt64(int64(a), int64(b))
+}
@@ -0,0 +1,193 @@
+package models
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"10", "10", false},
+		{"10.50", "10.50", false},
+		{"-3", "-3", false},
+		{"0.005", "0.005", false},
+		{"007.10", "7.10", false},
+		{"1,000.5", "", true},
+		{"1e3", "", true},
+		{"-", "", true},
+		{"", "", true},
+		{".5", "", true},
+		{"5.", "", true},
+		{"+5", "", true},
+		{" 5", "", true},
+		{"$5", "", true},
+		{"1.123456789", "", true},
+		{"1000000000000000000", "", true},
+	}
+	for _, tt := range tests {
+		got, err := ParseAmount(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseAmount(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got.String() != tt.want {
+			t.Errorf("ParseAmount(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+	if _, err := ParseAmount("1000000000000000000"); !errors.Is(err, ErrAmountOverflow) {
+		t.Errorf("19-digit amount error = %v, want ErrAmountOverflow", err)
+	}
+}
+
+func TestAmountRound(t *testing.T) {
+	tests := []struct {
+		in     string
+		places int
+		mode   RoundingMode
+		want   string
+	}{
+		{"2.345", 2, RoundHalfEven, "2.34"},
+		{"2.355", 2, RoundHalfEven, "2.36"},
+		{"2.3451", 2, RoundHalfEven, "2.35"},
+		{"-2.345", 2, RoundHalfEven, "-2.34"},
+		{"2.345", 2, RoundHalfUp, "2.35"},
+		{"2.344", 2, RoundHalfUp, "2.34"},
+		{"-2.345", 2, RoundHalfUp, "-2.35"},
+		{"2.349", 2, RoundDown, "2.34"},
+		{"-2.349", 2, RoundDown, "-2.34"},
+		{"0.5", 0, RoundHalfEven, "0"},
+		{"1.5", 0, RoundHalfEven, "2"},
+		{"0.5", 0, RoundHalfUp, "1"},
+		{"10.5", -1, RoundDown, "10"},
+		{"2.3", 2, RoundHalfEven, "2.3"},
+	}
+	for _, tt := range tests {
+		if got := MustParseAmount(tt.in).Round(tt.places, tt.mode).String(); got != tt.want {
+			t.Errorf("%s.Round(%d, %d) = %s, want %s", tt.in, tt.places, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestAmountOverflow(t *testing.T) {
+	max := Amount{coef: math.MaxInt64}
+	min := Amount{coef: math.MinInt64}
+	tests := []struct {
+		name string
+		op   func() (Amount, error)
+	}{
+		{"add", func() (Amount, error) { return max.Add(MustParseAmount("1")) }},
+		{"add negative", func() (Amount, error) { return min.Add(MustParseAmount("-1")) }},
+		{"add rescale", func() (Amount, error) { return max.Add(MustParseAmount("0.01")) }},
+		{"mul", func() (Amount, error) { return MustParseAmount("999999999999999.99").Mul(1000) }},
+		{"mul min by -1", func() (Amount, error) { return min.Mul(-1) }},
+		{"mul -1 by min", func() (Amount, error) { return MustParseAmount("-1").Mul(math.MinInt64) }},
+	}
+	for _, tt := range tests {
+		if _, err := tt.op(); !errors.Is(err, ErrAmountOverflow) {
+			t.Errorf("%s: error = %v, want ErrAmountOverflow", tt.name, err)
+		}
+	}
+
+	sum, err := MustParseAmount("10.5").Add(MustParseAmount("0.25"))
+	if err != nil || sum.String() != "10.75" {
+		t.Errorf("10.5 + 0.25 = %s, %v, want 10.75", sum, err)
+	}
+	product, err := MustParseAmount("19.99").Mul(3)
+	if err != nil || product.String() != "59.97" {
+		t.Errorf("19.99 × 3 = %s, %v, want 59.97", product, err)
+	}
+}
+
+func TestAmountCurrency(t *testing.T) {
+	tests := []struct {
+		in       string
+		currency string
+		want     string
+		wantErr  bool
+	}{
+		{"1050", "JPY", "1050", false},
+		{"1050.00", "JPY", "1050", false},
+		{"1050.5", "JPY", "", true},
+		{"10.5", "USD", "10.50", false},
+		{"10", "USD", "10.00", false},
+		{"10.505", "USD", "", true},
+		{"1.5", "KWD", "1.500", false},
+		{"1.234", "KWD", "1.234", false},
+		{"1.2345", "KWD", "", true},
+		{"10", "usd", "10.00", false},
+		{"10", "XXZ", "", true},
+	}
+	for _, tt := range tests {
+		a := MustParseAmount(tt.in)
+		err := a.ValidateCurrency(tt.currency)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s.ValidateCurrency(%s) error = %v, wantErr %v", tt.in, tt.currency, err, tt.wantErr)
+			continue
+		}
+		if err == nil {
+			if got := a.Format(tt.currency); got != tt.want {
+				t.Errorf("%s.Format(%s) = %s, want %s", tt.in, tt.currency, got, tt.want)
+			}
+		}
+	}
+
+	for _, tt := range []struct {
+		minor    int64
+		currency string
+		want     string
+	}{
+		{1050, "JPY", "1050"},
+		{1050, "USD", "10.50"},
+		{1050, "KWD", "1.050"},
+	} {
+		a, err := NewAmountFromMinorUnits(tt.minor, tt.currency)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := a.Format(tt.currency); got != tt.want {
+			t.Errorf("NewAmountFromMinorUnits(%d, %s) = %s, want %s", tt.minor, tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTotals(t *testing.T) {
+	item := func(price string, qty int, total string) Item {
+		it := Item{UnitPrice: MustParseAmount(price), Quantity: qty}
+		if total != "" {
+			it.TotalAmount = MustParseAmount(total)
+		}
+		return it
+	}
+	tests := []struct {
+		name    string
+		grand   string
+		items   []Item
+		wantErr bool
+	}{
+		{"no items", "10.00", nil, false},
+		{"price times quantity", "25.00", []Item{item("10", 2, ""), item("5.00", 1, "")}, false},
+		{"mismatch", "25.01", []Item{item("10", 2, ""), item("5.00", 1, "")}, true},
+		{"total amount wins", "18.00", []Item{item("10", 2, "18")}, false},
+		{"total amount mismatch", "20.00", []Item{item("10", 2, "18")}, true},
+		{"overflow", "1", []Item{item("999999999999999999", 100, "")}, true},
+	}
+	for _, tt := range tests {
+		r := RiskAnalysisRequest{
+			PurchaseTotals: PurchaseTotals{Currency: "USD", GrandTotalAmount: MustParseAmount(tt.grand)},
+			Items:          tt.items,
+		}
+		err := r.ValidateTotals()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+		var ve *ValidationError
+		if err != nil && !errors.As(err, &ve) {
+			t.Errorf("%s: error %T is not a *ValidationError", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package models
+
+import "strings"
+
+// reasonCodes describes the reason codes Decision Manager requests return.
+var reasonCodes = map[int]string{
+	100: "Successful transaction.",
+	101: "The request is missing one or more required fields.",
+	102: "One or more fields in the request contain invalid data.",
+	150: "General system failure.",
+	151: "The request was received but there was a server timeout.",
+	152: "The request was received, but a service did not finish running in time.",
+	202: "Expired card.",
+	231: "Invalid account number.",
+	234: "A problem exists with the CyberSource merchant configuration.",
+	400: "The fraud score exceeds the threshold.",
+	480: "The order is marked for review by Decision Manager.",
+	481: "The order was rejected by Decision Manager.",
+}
+
+// factorCodes describes the single-letter AFS risk factor codes.
+var factorCodes = map[string]string{
+	"A": "Excessive address change: the customer changed the billing address two or more times in the last six months.",
+	"B": "Card BIN or authorization risk: the card BIN or the authorization history is high risk.",
+	"C": "High number of account numbers used by the customer in the last six months.",
+	"D": "Email address impact: the email user name or domain is high risk.",
+	"E": "Positive list: the customer is on the merchant's positive list.",
+	"F": "Negative list: the account number, address, email or IP address is on the negative list.",
+	"G": "Geolocation inconsistencies: the customer's email domain, phone, billing, shipping or IP address is suspicious.",
+	"H": "Excessive name changes: the customer changed the name two or more times in the last six months.",
+	"I": "Internet inconsistencies: the IP address and email domain do not match the billing address.",
+	"N": "Nonsensical input in the customer name and address fields.",
+	"O": "Obscenities in the customer input.",
+	"P": "Identity morphing: multiple values of an identity element are linked to one value of another.",
+	"Q": "Phone inconsistencies: the customer's phone number is suspicious.",
+	"R": "Risky order: the transaction, customer and merchant information show multiple high-risk correlations.",
+	"T": "Time hedge: the customer is ordering at an unusual time of day.",
+	"U": "Unverifiable address: the billing or shipping address cannot be verified.",
+	"V": "Velocity: the account number was used many times in the past 15 minutes.",
+	"W": "Marked as suspicious: the billing or shipping address is similar to one previously marked suspicious.",
+	"Y": "Gift order: the billing and shipping addresses do not correlate.",
+	"Z": "Invalid value: the request contained an unexpected value and a default was substituted.",
+}
+
+// infoCodes describes common AFS information codes (address, suspicious,
+// identity, internet, phone and velocity codes).
+var infoCodes = map[string]string{
+	"COR-BA":    "The billing address has corrected elements or can be normalized.",
+	"COR-SA":    "The shipping address has corrected elements or can be normalized.",
+	"INTL-BA":   "The billing country is outside the U.S.",
+	"INTL-SA":   "The shipping country is outside the U.S.",
+	"MIL-USA":   "The address is a U.S. military address.",
+	"MM-A":      "The billing and shipping addresses use different countries.",
+	"MM-BIN":    "The card BIN does not match the country of the billing address.",
+	"MM-C":      "The billing and shipping addresses use different cities.",
+	"MM-CO":     "The billing and shipping addresses use different countries.",
+	"MM-ST":     "The billing and shipping addresses use different states.",
+	"MM-Z":      "The billing and shipping addresses use different postal codes.",
+	"UNV-ADDR":  "The address is unverifiable.",
+	"BAD-FP":    "The device is risky.",
+	"INTL-BIN":  "The card is issued outside the U.S.",
+	"MUL-EM":    "The customer has used more than four email addresses.",
+	"NON-BC":    "The billing city is nonsensical.",
+	"NON-FN":    "The customer first name is nonsensical.",
+	"NON-LN":    "The customer last name is nonsensical.",
+	"OBS-BC":    "The billing city contains obscenities.",
+	"OBS-EM":    "The billing email address contains obscenities.",
+	"RISK-AVS":  "The combined AVS and billing address result is high risk.",
+	"RISK-BC":   "The billing city has a high chargeback rate.",
+	"RISK-BIN":  "Cards with this BIN have a high chargeback rate.",
+	"RISK-DEV":  "Some device characteristics are risky.",
+	"RISK-EM":   "The customer's email domain has a high chargeback rate.",
+	"RISK-TB":   "The day and hour of the order at the billing address is risky.",
+	"RISK-TS":   "The day and hour of the order at the shipping address is risky.",
+	"MM-EMBCO":  "The email domain does not match the billing country.",
+	"MM-IPBC":   "The email domain does not match the billing city.",
+	"MM-IPBCO":  "The IP address country does not match the billing country.",
+	"MM-IPBST":  "The IP address state does not match the billing state.",
+	"FREE-EM":   "The customer's email address is from a free email provider.",
+	"INTL-IPCO": "The IP address country is outside the U.S.",
+	"INV-EM":    "The customer's email address is invalid.",
+	"RISK-IP":   "The IP address is high risk.",
+	"MM-TZTLO":  "The device time zone does not match other location information.",
+	"VEL-ADDR":  "Different billing or shipping states were used with the account number.",
+	"VEL-CC":    "Different account numbers were used with the customer identity.",
+	"VEL-NAME":  "Different names were used with the account number.",
+	"VELS-CC":   "The account number was used many times in the short-term velocity window.",
+	"VELL-CC":   "The account number was used many times in the long-term velocity window.",
+}
+
+// DescribeReasonCode returns a description of a CyberSource reason code.
+func DescribeReasonCode(code int) (string, bool) {
+	d, ok := reasonCodes[code]
+	return d, ok
+}
+
+// DescribeFactorCode returns a description of an AFS risk factor code
+// such as "F" or "V".
+func DescribeFactorCode(code string) (string, bool) {
+	d, ok := factorCodes[strings.ToUpper(code)]
+	return d, ok
+}
+
+// DescribeInfoCode returns a description of an AFS information code such
+// as "MM-A" or "RISK-BIN".
+func DescribeInfoCode(code string) (string, bool) {
+	d, ok := infoCodes[strings.ToUpper(code)]
+	return d, ok
+}
+
+// SplitCodes splits a "^"-separated AFS code list such as "F^V^Y".
+func SplitCodes(s string) []string {
+	var codes []string
+	for _, c := range strings.Split(s, "^") {
+		if c = strings.TrimSpace(c); c != "" {
+			codes = append(codes, c)
+		}
+	}
+	return codes
+}
@@ -0,0 +1,17 @@
+package models
+
+import "fmt"
+
+// ValidationError is returned when a request field fails client-side validation
+// before anything is sent to CyberSource.
+type ValidationError struct {
+	// Field is the request field path (e.g. "check.bankTransitNumber").
+	Field string
+
+	// Message describes the problem.
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.Field, e.Message)
+}
@@ -0,0 +1,30 @@
+package models
+
+import "fmt"
+
+// Validate checks the enumerated product rule fields of the item.
+// Amounts are checked against the order currency by ValidateAmounts.
+func (it Item) Validate() error {
+	switch it.ProductRisk {
+	case "", ProductRiskLow, ProductRiskNormal, ProductRiskHigh:
+	default:
+		return &ValidationError{Field: "productRisk", Message: fmt.Sprintf("unknown value %q", it.ProductRisk)}
+	}
+	hedges := []struct {
+		name  string
+		value string
+	}{
+		{"hostHedge", it.HostHedge},
+		{"timeHedge", it.TimeHedge},
+		{"velocityHedge", it.VelocityHedge},
+		{"nonsensicalHedge", it.NonsensicalHedge},
+	}
+	for _, h := range hedges {
+		switch h.value {
+		case "", HedgeLow, HedgeNormal, HedgeHigh, HedgeOff:
+		default:
+			return &ValidationError{Field: h.name, Message: fmt.Sprintf("unknown value %q", h.value)}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package models
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"unicode/utf8"
+)
+
+// MDD index range and default value length accepted by CyberSource
+// for merchantDefinedData fields.
+const (
+	MDDMinIndex         = 1
+	MDDMaxIndex         = 100
+	MDDDefaultMaxLength = 255
+)
+
+// MDDField declares a named merchant-defined data field.
+type MDDField struct {
+	// Name is the application-level name used to fill the field (e.g. "loyalty_tier").
+	Name string
+
+	// Index is the CyberSource field number (1-100) the value is sent as.
+	Index int
+
+	// MaxLength is the maximum value length in characters.
+	// Zero means MDDDefaultMaxLength.
+	MaxLength int
+
+	// AllowedValues optionally restricts the field to a fixed set of values.
+	AllowedValues []string
+
+	// PII marks fields that carry personal data and must be redacted in logs and audit records.
+	PII bool
+}
+
+// MDDSchema is a registry of named merchant-defined data fields.
+// It is immutable after creation and safe for concurrent use.
+type MDDSchema struct {
+	byName  map[string]MDDField
+	byIndex map[int]MDDField
+}
+
+// NewMDDSchema creates a schema from field declarations. Names and indexes
+// must be unique and indexes must be within MDDMinIndex..MDDMaxIndex.
+func NewMDDSchema(fields ...MDDField) (*MDDSchema, error) {
+	s := &MDDSchema{
+		byName:  make(map[string]MDDField, len(fields)),
+		byIndex: make(map[int]MDDField, len(fields)),
+	}
+	for _, f := range fields {
+		if f.Name == "" {
+			return nil, fmt.Errorf("mdd field %d: name is required", f.Index)
+		}
+		if f.Index < MDDMinIndex || f.Index > MDDMaxIndex {
+			return nil, fmt.Errorf("mdd field %q: index %d out of range %d-%d", f.Name, f.Index, MDDMinIndex, MDDMaxIndex)
+		}
+		if f.MaxLength < 0 {
+			return nil, fmt.Errorf("mdd field %q: negative MaxLength", f.Name)
+		}
+		if _, dup := s.byName[f.Name]; dup {
+			return nil, fmt.Errorf("mdd field %q declared twice", f.Name)
+		}
+		if other, dup := s.byIndex[f.Index]; dup {
+			return nil, fmt.Errorf("mdd field %q: index %d already used by %q", f.Name, f.Index, other.Name)
+		}
+		f.AllowedValues = slices.Clone(f.AllowedValues)
+		s.byName[f.Name] = f
+		s.byIndex[f.Index] = f
+	}
+	return s, nil
+}
+
+// Field returns the declaration for a field name.
+func (s *MDDSchema) Field(name string) (MDDField, bool) {
+	if s == nil {
+		return MDDField{}, false
+	}
+	f, ok := s.byName[name]
+	return f, ok
+}
+
+// FieldByIndex returns the declaration for a CyberSource field number.
+func (s *MDDSchema) FieldByIndex(index int) (MDDField, bool) {
+	if s == nil {
+		return MDDField{}, false
+	}
+	f, ok := s.byIndex[index]
+	return f, ok
+}
+
+// Resolve merges named values and raw numbered values into the numbered
+// map sent to CyberSource, validating every value. Named values require a
+// declaration in the schema; numbered values are checked against the
+// declaration for their index when there is one. A nil schema accepts
+// numbered values only. Values are checked in index order, then name
+// order, so the error reported for a request is always the same.
+func (s *MDDSchema) Resolve(named map[string]string, numbered map[int]string) (map[int]string, error) {
+	if len(named) == 0 && len(numbered) == 0 {
+		return nil, nil
+	}
+	out := make(map[int]string, len(named)+len(numbered))
+	for _, index := range slices.Sorted(maps.Keys(numbered)) {
+		value := numbered[index]
+		f, ok := s.FieldByIndex(index)
+		if !ok {
+			f = MDDField{Name: fmt.Sprintf("field%d", index), Index: index}
+		}
+		if err := f.validate(value); err != nil {
+			return nil, err
+		}
+		out[index] = value
+	}
+	for _, name := range slices.Sorted(maps.Keys(named)) {
+		value := named[name]
+		f, ok := s.Field(name)
+		if !ok {
+			return nil, &ValidationError{Field: "merchantDefinedData." + name, Message: "not declared in the MDD schema"}
+		}
+		if _, dup := out[f.Index]; dup {
+			return nil, &ValidationError{Field: "merchantDefinedData." + name, Message: fmt.Sprintf("field%d is also set by number", f.Index)}
+		}
+		if err := f.validate(value); err != nil {
+			return nil, err
+		}
+		out[f.Index] = value
+	}
+	return out, nil
+}
+
+func (f MDDField) validate(value string) error {
+	field := "merchantDefinedData." + f.Name
+	if f.Index < MDDMinIndex || f.Index > MDDMaxIndex {
+		return &ValidationError{Field: field, Message: fmt.Sprintf("index %d out of range %d-%d", f.Index, MDDMinIndex, MDDMaxIndex)}
+	}
+	maxLen := f.MaxLength
+	if maxLen == 0 {
+		maxLen = MDDDefaultMaxLength
+	}
+	if n := utf8.RuneCountInString(value); n > maxLen {
+		return &ValidationError{Field: field, Message: fmt.Sprintf("length %d exceeds %d", n, maxLen)}
+	}
+	if len(f.AllowedValues) > 0 && !slices.Contains(f.AllowedValues, value) {
+		if f.PII {
+			return &ValidationError{Field: field, Message: "value not allowed"}
+		}
+		return &ValidationError{Field: field, Message: fmt.Sprintf("value %q not allowed", value)}
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package models
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewMDDSchema(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields []MDDField
+		want   string
+	}{
+		{"valid", []MDDField{{Name: "channel", Index: 1}, {Name: "tier", Index: 100}}, ""},
+		{"duplicate name", []MDDField{{Name: "tier", Index: 1}, {Name: "tier", Index: 2}}, `"tier" declared twice`},
+		{"duplicate index", []MDDField{{Name: "channel", Index: 3}, {Name: "tier", Index: 3}}, `index 3 already used by "channel"`},
+		{"index 0", []MDDField{{Name: "tier", Index: 0}}, "index 0 out of range 1-100"},
+		{"index 101", []MDDField{{Name: "tier", Index: 101}}, "index 101 out of range 1-100"},
+		{"missing name", []MDDField{{Index: 4}}, "mdd field 4: name is required"},
+		{"negative max length", []MDDField{{Name: "tier", Index: 1, MaxLength: -1}}, "negative MaxLength"},
+	}
+	for _, tt := range tests {
+		_, err := NewMDDSchema(tt.fields...)
+		if tt.want == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want it to contain %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestMDDSchemaCopiesAllowedValues(t *testing.T) {
+	allowed := []string{"gold", "silver"}
+	s, err := NewMDDSchema(MDDField{Name: "tier", Index: 1, AllowedValues: allowed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	allowed[0] = "bronze"
+	if _, err := s.Resolve(map[string]string{"tier": "gold"}, nil); err != nil {
+		t.Errorf("changing the caller's slice changed the schema: %v", err)
+	}
+}
+
+func TestMDDSchemaResolve(t *testing.T) {
+	s, err := NewMDDSchema(
+		MDDField{Name: "channel", Index: 1, MaxLength: 3},
+		MDDField{Name: "tier", Index: 2, AllowedValues: []string{"gold", "silver"}},
+		MDDField{Name: "email", Index: 3, AllowedValues: []string{"ada@example.com"}, PII: true},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		named    map[string]string
+		numbered map[int]string
+		want     map[int]string
+		field    string
+		message  string
+	}{
+		{name: "empty"},
+		{
+			name:     "named and numbered",
+			named:    map[string]string{"channel": "web", "tier": "gold"},
+			numbered: map[int]string{20: "returning"},
+			want:     map[int]string{1: "web", 2: "gold", 20: "returning"},
+		},
+		{name: "max length in characters", named: map[string]string{"channel": "añb"}, want: map[int]string{1: "añb"}},
+		{name: "too long", named: map[string]string{"channel": "mobile"}, field: "merchantDefinedData.channel", message: "length 6 exceeds 3"},
+		{name: "default max length", numbered: map[int]string{50: strings.Repeat("x", 256)}, field: "merchantDefinedData.field50", message: "exceeds 255"},
+		{name: "numbered uses declaration", numbered: map[int]string{1: "mobile"}, field: "merchantDefinedData.channel", message: "exceeds 3"},
+		{name: "not allowed", named: map[string]string{"tier": "bronze"}, field: "merchantDefinedData.tier", message: `value "bronze" not allowed`},
+		{name: "PII value not echoed", named: map[string]string{"email": "eve@example.com"}, field: "merchantDefinedData.email", message: "value not allowed"},
+		{name: "undeclared name", named: map[string]string{"loyalty": "1"}, field: "merchantDefinedData.loyalty", message: "not declared"},
+		{name: "index 0", numbered: map[int]string{0: "x"}, field: "merchantDefinedData.field0", message: "index 0 out of range"},
+		{name: "index 101", numbered: map[int]string{101: "x"}, field: "merchantDefinedData.field101", message: "index 101 out of range"},
+		{
+			name:     "named and numbered conflict",
+			named:    map[string]string{"tier": "gold"},
+			numbered: map[int]string{2: "silver"},
+			field:    "merchantDefinedData.tier",
+			message:  "field2 is also set by number",
+		},
+	}
+	for _, tt := range tests {
+		got, err := s.Resolve(tt.named, tt.numbered)
+		if tt.field == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			} else if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+			}
+			continue
+		}
+		var ve *ValidationError
+		if !errors.As(err, &ve) || ve.Field != tt.field || !strings.Contains(ve.Message, tt.message) {
+			t.Errorf("%s: err = %v, want %s: ...%s...", tt.name, err, tt.field, tt.message)
+		}
+		if strings.Contains(tt.name, "PII") && strings.Contains(err.Error(), "eve@example.com") {
+			t.Errorf("%s: error %q contains the PII value", tt.name, err)
+		}
+	}
+}
+
+func TestMDDSchemaResolveReportsFirstErrorInOrder(t *testing.T) {
+	s, err := NewMDDSchema(MDDField{Name: "a", Index: 5, MaxLength: 1}, MDDField{Name: "b", Index: 6, MaxLength: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	numbered := map[int]string{}
+	for i := 10; i < 60; i++ {
+		numbered[i] = strings.Repeat("x", 300)
+	}
+	for i := 0; i < 20; i++ {
+		_, err := s.Resolve(nil, numbered)
+		if want := "merchantDefinedData.field10"; err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("err = %v, want the lowest index %s", err, want)
+		}
+		_, err = s.Resolve(map[string]string{"b": "yy", "a": "xx", "c": "z"}, nil)
+		if want := "merchantDefinedData.a"; err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("err = %v, want the first name %s", err, want)
+		}
+	}
+}
+
+func TestNilMDDSchemaResolve(t *testing.T) {
+	var s *MDDSchema
+	got, err := s.Resolve(nil, map[int]string{7: "web"})
+	if err != nil || !reflect.DeepEqual(got, map[int]string{7: "web"}) {
+		t.Errorf("nil schema numbered = %v, %v", got, err)
+	}
+	if _, err := s.Resolve(map[string]string{"tier": "gold"}, nil); err == nil {
+		t.Error("nil schema accepted a named value")
+	}
+}
@@ -0,0 +1,177 @@
+package models
+
+import "strings"
+
+// PaymentMethod is a payment instrument that Decision Manager can screen.
+// It is implemented by Card, Check, PayPal and GiftCard.
+type PaymentMethod interface {
+	// Validate checks the payment details before they are sent to CyberSource.
+	Validate() error
+
+	paymentMethod()
+}
+
+// Check account types accepted by CyberSource.
+const (
+	CheckAccountChecking          = "C"
+	CheckAccountSavings           = "S"
+	CheckAccountCorporateChecking = "X"
+	CheckAccountGeneralLedger     = "G"
+)
+
+// Check contains electronic check (eCheck/ACH) details.
+type Check struct {
+	// AccountNumber is the bank account number.
+	AccountNumber string
+
+	// AccountType is one of the CheckAccount* constants.
+	AccountType string
+
+	// BankTransitNumber is the nine-digit ABA routing number.
+	BankTransitNumber string
+
+	// CheckNumber is the optional check number.
+	CheckNumber string
+
+	// SecCode is the optional ACH Standard Entry Class code (e.g. "WEB", "TEL").
+	SecCode string
+}
+
+// PayPal contains the PayPal payer details.
+type PayPal struct {
+	// PayerID is the PayPal-assigned payer identifier.
+	PayerID string
+
+	// PayerEmail is the email address of the PayPal account.
+	PayerEmail string
+
+	// PayerStatus is "verified" or "unverified".
+	PayerStatus string
+}
+
+// GiftCard contains stored value (gift card) details.
+type GiftCard struct {
+	// Number is the gift card account number.
+	Number string
+
+	// ExpirationMonth is the optional two-digit expiration month.
+	ExpirationMonth string
+
+	// ExpirationYear is the optional four-digit expiration year.
+	ExpirationYear string
+}
+
+func (Card) paymentMethod()     {}
+func (Check) paymentMethod()    {}
+func (PayPal) paymentMethod()   {}
+func (GiftCard) paymentMethod() {}
+
+// Validate checks the card number format and Luhn checksum and the expiration date.
+func (c Card) Validate() error {
+	if !isDigits(c.Number) || len(c.Number) < 12 || len(c.Number) > 19 {
+		return &ValidationError{Field: "card.number", Message: "must be 12-19 digits"}
+	}
+	if !luhnValid(c.Number) {
+		return &ValidationError{Field: "card.number", Message: "fails Luhn check"}
+	}
+	return validateExpiration("card", c.ExpirationMonth, c.ExpirationYear, true)
+}
+
+// Validate checks the account number, account type and ABA routing number checksum.
+func (c Check) Validate() error {
+	if !isDigits(c.AccountNumber) || len(c.AccountNumber) > 17 {
+		return &ValidationError{Field: "check.accountNumber", Message: "must be 1-17 digits"}
+	}
+	switch c.AccountType {
+	case CheckAccountChecking, CheckAccountSavings, CheckAccountCorporateChecking, CheckAccountGeneralLedger:
+	default:
+		return &ValidationError{Field: "check.accountType", Message: "must be one of C, S, X or G"}
+	}
+	if !abaRoutingValid(c.BankTransitNumber) {
+		return &ValidationError{Field: "check.bankTransitNumber", Message: "not a valid ABA routing number"}
+	}
+	if c.CheckNumber != "" && !isDigits(c.CheckNumber) {
+		return &ValidationError{Field: "check.checkNumber", Message: "must be digits"}
+	}
+	return nil
+}
+
+// Validate checks that the payer is identified and the status is known.
+func (p PayPal) Validate() error {
+	if p.PayerID == "" && p.PayerEmail == "" {
+		return &ValidationError{Field: "paypal", Message: "PayerID or PayerEmail is required"}
+	}
+	if p.PayerEmail != "" && !strings.Contains(p.PayerEmail, "@") {
+		return &ValidationError{Field: "paypal.payerEmail", Message: "not an email address"}
+	}
+	switch p.PayerStatus {
+	case "", "verified", "unverified":
+	default:
+		return &ValidationError{Field: "paypal.payerStatus", Message: `must be "verified" or "unverified"`}
+	}
+	return nil
+}
+
+// Validate checks the gift card number and, when present, the expiration date.
+func (g GiftCard) Validate() error {
+	if !isDigits(g.Number) || len(g.Number) > 32 {
+		return &ValidationError{Field: "giftCard.number", Message: "must be 1-32 digits"}
+	}
+	return validateExpiration("giftCard", g.ExpirationMonth, g.ExpirationYear, false)
+}
+
+func validateExpiration(field, month, year string, required bool) error {
+	if month == "" && year == "" && !required {
+		return nil
+	}
+	if len(month) != 2 || !isDigits(month) || month < "01" || month > "12" {
+		return &ValidationError{Field: field + ".expirationMonth", Message: "must be 01-12"}
+	}
+	if len(year) != 4 || !isDigits(year) {
+		return &ValidationError{Field: field + ".expirationYear", Message: "must be four digits"}
+	}
+	return nil
+}
+
+// abaRoutingValid applies the ABA routing number checksum:
+// 3*(d1+d4+d7) + 7*(d2+d5+d8) + (d3+d6+d9) must be a multiple of 10.
+func abaRoutingValid(routing string) bool {
+	if len(routing) != 9 || !isDigits(routing) {
+		return false
+	}
+	weights := [3]int{3, 7, 1}
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += int(routing[i]-'0') * weights[i%3]
+	}
+	return sum%10 == 0
+}
+
+func luhnValid(number string) bool {
+	sum := 0
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		d := int(number[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
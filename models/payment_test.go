@@ -0,0 +1,82 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLuhnValid(t *testing.T) {
+	tests := []struct {
+		number string
+		want   bool
+	}{
+		{"4111111111111111", true},
+		{"5555555555554444", true},
+		{"378282246310005", true},
+		{"6011111111111117", true},
+		{"79927398713", true},
+		{"4111111111111112", false},
+		{"79927398710", false},
+		{"1234567812345678", false},
+	}
+	for _, tt := range tests {
+		if got := luhnValid(tt.number); got != tt.want {
+			t.Errorf("luhnValid(%q) = %v, want %v", tt.number, got, tt.want)
+		}
+	}
+}
+
+func TestABARoutingValid(t *testing.T) {
+	tests := []struct {
+		routing string
+		want    bool
+	}{
+		{"011000015", true},
+		{"021000021", true},
+		{"122105278", true},
+		{"026009593", true},
+		{"011000016", false}, // bad checksum
+		{"021000012", false}, // transposed digits
+		{"02100002", false},
+		{"0210000210", false},
+		{"02100002a", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := abaRoutingValid(tt.routing); got != tt.want {
+			t.Errorf("abaRoutingValid(%q) = %v, want %v", tt.routing, got, tt.want)
+		}
+	}
+}
+
+func TestPaymentMethodValidate(t *testing.T) {
+	card := Card{Number: "4111111111111111", ExpirationMonth: "12", ExpirationYear: "2030"}
+	check := Check{AccountNumber: "4100987654", AccountType: CheckAccountChecking, BankTransitNumber: "011000015"}
+
+	tests := []struct {
+		name  string
+		pm    interface{ Validate() error }
+		field string // "" means valid
+	}{
+		{"card", card, ""},
+		{"card failing Luhn", func() Card { c := card; c.Number = "4111111111111112"; return c }(), "card.number"},
+		{"card too short", func() Card { c := card; c.Number = "41111111111"; return c }(), "card.number"},
+		{"card with spaces", func() Card { c := card; c.Number = "4111 1111 1111 1111"; return c }(), "card.number"},
+		{"check", check, ""},
+		{"check bad routing checksum", func() Check { c := check; c.BankTransitNumber = "011000016"; return c }(), "check.bankTransitNumber"},
+		{"check short routing", func() Check { c := check; c.BankTransitNumber = "01100001"; return c }(), "check.bankTransitNumber"},
+	}
+	for _, tt := range tests {
+		err := tt.pm.Validate()
+		if tt.field == "" {
+			if err != nil {
+				t.Errorf("%s: Validate() = %v, want nil", tt.name, err)
+			}
+			continue
+		}
+		var ve *ValidationError
+		if !errors.As(err, &ve) || ve.Field != tt.field {
+			t.Errorf("%s: Validate() = %v, want a %s ValidationError", tt.name, err, tt.field)
+		}
+	}
+}
@@ -5,22 +5,42 @@ type RiskAnalysisRequest struct {
 	// MerchantReferenceCode is a unique reference for this transaction.
 	MerchantReferenceCode string
 
+	// DecisionManagerProfile optionally selects the Decision Manager
+	// profile that evaluates the order, overriding
+	// Config.DecisionManagerProfile. Empty uses the account default.
+	DecisionManagerProfile string
+
+	// MerchantID optionally selects the merchant the request is sent for.
+	// Empty means the client's Config.MerchantID; a Client also accepts
+	// its meta key children (Config.ChildMerchantIDs), and MultiClient
+	// routes on it.
+	MerchantID string
+
 	// BillTo contains the customer billing address and contact info.
 	BillTo *BillTo
 
 	// Card contains the payment card details.
+	// It is used when PaymentMethod is nil.
 	Card Card
 
+	// PaymentMethod optionally selects a non-card payment instrument
+	// (Check, PayPal or GiftCard). When set, Card is ignored.
+	PaymentMethod PaymentMethod
+
 	// Items is a list of line items in the transaction.
 	Items []Item
 
 	// PurchaseTotals contains the total amount and currency.
 	PurchaseTotals PurchaseTotals
 
-	// MerchantDefinedData is a map of field number (1-20) to value.
+	// MerchantDefinedData is a map of field number (1-100) to value.
 	// These are custom merchant fields used for risk analysis rules.
 	MerchantDefinedData map[int]string
 
+	// MerchantDefinedFields fills merchant-defined data fields by name.
+	// Names are resolved through the MDDSchema configured on the client.
+	MerchantDefinedFields map[string]string
+
 	// DeviceFingerprintID is the device fingerprint session identifier.
 	DeviceFingerprintID string
 }
@@ -58,15 +78,60 @@ type Card struct {
 
 // Item represents a line item in the transaction.
 type Item struct {
-	UnitPrice   string
+	UnitPrice   Amount
 	Quantity    int
 	ProductCode string
 	ProductName string
 	ProductSKU  string
+
+	// ProductRisk is the product risk level: one of the ProductRisk* constants.
+	ProductRisk string
+
+	// TaxAmount is the tax for the line.
+	TaxAmount Amount
+
+	// TotalAmount is the line total including tax and discounts.
+	// When set, it is used instead of UnitPrice × Quantity for total checks.
+	TotalAmount Amount
+
+	// DiscountAmount is the discount applied to the line.
+	DiscountAmount Amount
+
+	// GiftCategory marks the item as a gift, so billing/shipping address
+	// mismatches are weighed less by Decision Manager.
+	GiftCategory bool
+
+	// TimeCategory is the product's time-of-order category used by product rules.
+	TimeCategory string
+
+	// HostHedge, TimeHedge, VelocityHedge and NonsensicalHedge set the weight of
+	// the corresponding tests for this product: one of the Hedge* constants.
+	HostHedge        string
+	TimeHedge        string
+	VelocityHedge    string
+	NonsensicalHedge string
 }
 
+// Product risk levels for Item.ProductRisk.
+const (
+	ProductRiskLow    = "low"
+	ProductRiskNormal = "normal"
+	ProductRiskHigh   = "high"
+)
+
+// Hedge levels for the Item hedge fields.
+const (
+	HedgeLow    = "low"
+	HedgeNormal = "normal"
+	HedgeHigh   = "high"
+	HedgeOff    = "off"
+)
+
 // PurchaseTotals contains the total amount and currency for the transaction.
 type PurchaseTotals struct {
-	Currency         string
-	GrandTotalAmount string
+	// Currency is the ISO 4217 alphabetic currency code (e.g. "USD").
+	Currency string
+
+	// GrandTotalAmount is the total order amount in Currency.
+	GrandTotalAmount Amount
 }
@@ -0,0 +1,102 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// riskAnalysisRequestFields has the fields of RiskAnalysisRequest without
+// its JSON methods.
+type riskAnalysisRequestFields RiskAnalysisRequest
+
+// requestJSON is the JSON form of a RiskAnalysisRequest. PaymentMethod
+// shadows the interface-typed field with one member per concrete type.
+type requestJSON struct {
+	riskAnalysisRequestFields
+	PaymentMethod *paymentMethodJSON `json:",omitempty"`
+}
+
+type paymentMethodJSON struct {
+	Card     *Card     `json:",omitempty"`
+	Check    *Check    `json:",omitempty"`
+	PayPal   *PayPal   `json:",omitempty"`
+	GiftCard *GiftCard `json:",omitempty"`
+}
+
+// MarshalJSON encodes the request in the form UnmarshalJSON reads.
+func (r RiskAnalysisRequest) MarshalJSON() ([]byte, error) {
+	out := requestJSON{riskAnalysisRequestFields: riskAnalysisRequestFields(r)}
+	switch pm := r.PaymentMethod.(type) {
+	case nil:
+	case Card:
+		out.PaymentMethod = &paymentMethodJSON{Card: &pm}
+	case Check:
+		out.PaymentMethod = &paymentMethodJSON{Check: &pm}
+	case PayPal:
+		out.PaymentMethod = &paymentMethodJSON{PayPal: &pm}
+	case GiftCard:
+		out.PaymentMethod = &paymentMethodJSON{GiftCard: &pm}
+	case *Card:
+		out.PaymentMethod = &paymentMethodJSON{Card: pm}
+	case *Check:
+		out.PaymentMethod = &paymentMethodJSON{Check: pm}
+	case *PayPal:
+		out.PaymentMethod = &paymentMethodJSON{PayPal: pm}
+	case *GiftCard:
+		out.PaymentMethod = &paymentMethodJSON{GiftCard: pm}
+	default:
+		return nil, fmt.Errorf("cannot encode payment method %T", pm)
+	}
+	if pm := out.PaymentMethod; pm != nil && pm.Card == nil && pm.Check == nil && pm.PayPal == nil && pm.GiftCard == nil {
+		return nil, fmt.Errorf("cannot encode nil payment method %T", r.PaymentMethod)
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON decodes a request from a JSON object whose keys are the
+// RiskAnalysisRequest field names (matched case-insensitively). Amounts
+// are decimal strings, MerchantDefinedData keys are field numbers, and a
+// non-card PaymentMethod is an object with exactly one of "Check",
+// "PayPal", "GiftCard" or "Card":
+//
+//	{"MerchantReferenceCode": "order-1",
+//	 "BillTo": {"FirstName": "Ada", "LastName": "Lovelace", "Email": "ada@example.com", ...},
+//	 "Card": {"Number": "4111111111111111", "ExpirationMonth": "12", "ExpirationYear": "2030"},
+//	 "Items": [{"UnitPrice": "10.00", "Quantity": 1, "ProductSKU": "sku-1"}],
+//	 "PurchaseTotals": {"Currency": "USD", "GrandTotalAmount": "10.00"},
+//	 "MerchantDefinedData": {"1": "web"}}
+//
+// Unknown keys are rejected so that misspelled fields are not silently
+// dropped.
+func (r *RiskAnalysisRequest) UnmarshalJSON(data []byte) error {
+	var in requestJSON
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&in); err != nil {
+		return err
+	}
+	req := RiskAnalysisRequest(in.riskAnalysisRequestFields)
+	if pm := in.PaymentMethod; pm != nil {
+		var methods []PaymentMethod
+		if pm.Card != nil {
+			methods = append(methods, *pm.Card)
+		}
+		if pm.Check != nil {
+			methods = append(methods, *pm.Check)
+		}
+		if pm.PayPal != nil {
+			methods = append(methods, *pm.PayPal)
+		}
+		if pm.GiftCard != nil {
+			methods = append(methods, *pm.GiftCard)
+		}
+		if len(methods) != 1 {
+			return errors.New("PaymentMethod must set exactly one of Card, Check, PayPal or GiftCard")
+		}
+		req.PaymentMethod = methods[0]
+	}
+	*r = req
+	return nil
+}
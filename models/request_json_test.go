@@ -0,0 +1,113 @@
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func jsonTestRequest() RiskAnalysisRequest {
+	return RiskAnalysisRequest{
+		MerchantReferenceCode: "order-1",
+		BillTo: &BillTo{
+			FirstName: "Ada",
+			LastName:  "Lovelace",
+			Email:     "ada@example.com",
+			Country:   "US",
+		},
+		Card: Card{Number: "4111111111111111", ExpirationMonth: "12", ExpirationYear: "2030"},
+		Items: []Item{
+			{UnitPrice: MustParseAmount("2.50"), Quantity: 2, ProductSKU: "sku-1"},
+		},
+		PurchaseTotals:      PurchaseTotals{Currency: "USD", GrandTotalAmount: MustParseAmount("5.00")},
+		MerchantDefinedData: map[int]string{1: "web", 20: "gold"},
+	}
+}
+
+func TestRiskAnalysisRequestJSONRoundTrip(t *testing.T) {
+	check := Check{AccountNumber: "4100987654", AccountType: CheckAccountChecking, BankTransitNumber: "011000015", CheckNumber: "1021"}
+	paypal := PayPal{PayerID: "PAYER12345", PayerEmail: "ada@example.com", PayerStatus: "verified"}
+	giftCard := GiftCard{Number: "6035710000000001", ExpirationMonth: "06", ExpirationYear: "2031"}
+	card := Card{Number: "5555555555554444", ExpirationMonth: "01", ExpirationYear: "2029"}
+
+	tests := []struct {
+		name string
+		pm   PaymentMethod
+		want PaymentMethod
+	}{
+		{"card field", nil, nil},
+		{"card", card, card},
+		{"check", check, check},
+		{"paypal", paypal, paypal},
+		{"giftcard", giftCard, giftCard},
+		// Pointers decode as the value they point to.
+		{"card pointer", &card, card},
+		{"check pointer", &check, check},
+		{"paypal pointer", &paypal, paypal},
+		{"giftcard pointer", &giftCard, giftCard},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := jsonTestRequest()
+			req.PaymentMethod = tt.pm
+			data, err := json.Marshal(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got RiskAnalysisRequest
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatalf("decode %s: %v", data, err)
+			}
+			want := req
+			want.PaymentMethod = tt.want
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("round trip of %s =\n%+v\nwant\n%+v", data, got, want)
+			}
+		})
+	}
+}
+
+func TestRiskAnalysisRequestMarshalNilPointer(t *testing.T) {
+	req := jsonTestRequest()
+	req.PaymentMethod = (*Check)(nil)
+	if _, err := json.Marshal(req); err == nil {
+		t.Error("nil *Check payment method encoded without error")
+	}
+}
+
+func TestRiskAnalysisRequestUnmarshalJSON(t *testing.T) {
+	var req RiskAnalysisRequest
+	err := json.Unmarshal([]byte(`{
+		"merchantReferenceCode": "order-1",
+		"PurchaseTotals": {"Currency": "JPY", "GrandTotalAmount": "1050"},
+		"MerchantDefinedData": {"3": "gold"},
+		"PaymentMethod": {"PayPal": {"PayerID": "P1"}}
+	}`), &req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.MerchantReferenceCode != "order-1" || req.PurchaseTotals.GrandTotalAmount.Format("JPY") != "1050" ||
+		req.MerchantDefinedData[3] != "gold" || req.PaymentMethod != (PayPal{PayerID: "P1"}) {
+		t.Errorf("decoded %+v", req)
+	}
+
+	tests := []struct {
+		name, in, want string
+	}{
+		{"unknown key", `{"MerchantRefCode": "order-1"}`, `unknown field "MerchantRefCode"`},
+		{"unknown nested key", `{"BillTo": {"FistName": "Ada"}}`, `unknown field "FistName"`},
+		{"unknown payment method", `{"PaymentMethod": {"Cash": {}}}`, `unknown field "Cash"`},
+		{"two payment methods", `{"PaymentMethod": {"Check": {}, "PayPal": {}}}`, "exactly one"},
+		{"empty payment method", `{"PaymentMethod": {}}`, "exactly one"},
+		{"numeric amount", `{"PurchaseTotals": {"GrandTotalAmount": 10.5}}`, "cannot unmarshal number"},
+		{"malformed amount", `{"PurchaseTotals": {"GrandTotalAmount": "1,000.50"}}`, "invalid amount"},
+	}
+	for _, tt := range tests {
+		var req RiskAnalysisRequest
+		err := json.Unmarshal([]byte(tt.in), &req)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want it to contain %q", tt.name, err, tt.want)
+		}
+	}
+}
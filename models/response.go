@@ -9,6 +9,16 @@ type RiskAnalysisAPIResponse struct {
 	// Body is the raw SOAP XML response body.
 	Body []byte
 
+	// Endpoint is the SOAP endpoint URL that served the request.
+	Endpoint string
+
+	// DryRun is true when the client is in dry-run mode and nothing was sent.
+	DryRun bool
+
+	// RequestXML is the signed request envelope with account numbers
+	// redacted. It is only set in dry-run mode.
+	RequestXML []byte
+
 	// Data is the parsed risk analysis response.
 	Data RiskAnalysisResponse
 }
@@ -33,6 +43,11 @@ type RiskAnalysisResponse struct {
 	// AFSReply contains the Advanced Fraud Screen scoring details.
 	// Nil when AFS data is not available (e.g. on errors).
 	AFSReply *AFSReply
+
+	// Fallback is true when the decision was not made by Decision Manager but
+	// is the client's configured fallback while its circuit breaker is open.
+	// Such orders should be screened again later.
+	Fallback bool
 }
 
 // AFSReply contains the Advanced Fraud Screen scoring and risk factor details.
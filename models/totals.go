@@ -0,0 +1,72 @@
+package models
+
+import "fmt"
+
+// ValidateAmounts checks that the currency is a known ISO 4217 code and that
+// the grand total and every item price fit its minor unit and are not negative.
+func (r RiskAnalysisRequest) ValidateAmounts() error {
+	currency := r.PurchaseTotals.Currency
+	if _, ok := CurrencyExponent(currency); !ok {
+		return &ValidationError{Field: "purchaseTotals.currency", Message: fmt.Sprintf("unknown ISO 4217 currency %q", currency)}
+	}
+	if err := validateAmount("purchaseTotals.grandTotalAmount", r.PurchaseTotals.GrandTotalAmount, currency); err != nil {
+		return err
+	}
+	for i, item := range r.Items {
+		amounts := []struct {
+			name string
+			a    Amount
+		}{
+			{"unitPrice", item.UnitPrice},
+			{"taxAmount", item.TaxAmount},
+			{"totalAmount", item.TotalAmount},
+			{"discountAmount", item.DiscountAmount},
+		}
+		for _, f := range amounts {
+			if err := validateAmount(fmt.Sprintf("item[%d].%s", i, f.name), f.a, currency); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateTotals checks that the sum of the item line totals equals
+// GrandTotalAmount. A line total is TotalAmount when set, otherwise
+// UnitPrice × Quantity. It is a no-op when there are no items.
+func (r RiskAnalysisRequest) ValidateTotals() error {
+	if len(r.Items) == 0 {
+		return nil
+	}
+	var sum Amount
+	for i, item := range r.Items {
+		line := item.TotalAmount
+		var err error
+		if line.IsZero() {
+			line, err = item.UnitPrice.Mul(int64(item.Quantity))
+		}
+		if err == nil {
+			sum, err = sum.Add(line)
+		}
+		if err != nil {
+			return &ValidationError{Field: fmt.Sprintf("item[%d]", i), Message: err.Error()}
+		}
+	}
+	if sum.Cmp(r.PurchaseTotals.GrandTotalAmount) != 0 {
+		return &ValidationError{
+			Field:   "purchaseTotals.grandTotalAmount",
+			Message: fmt.Sprintf("%s does not match item total %s", r.PurchaseTotals.GrandTotalAmount, sum),
+		}
+	}
+	return nil
+}
+
+func validateAmount(field string, a Amount, currency string) error {
+	if a.Sign() < 0 {
+		return &ValidationError{Field: field, Message: "must not be negative"}
+	}
+	if err := a.ValidateCurrency(currency); err != nil {
+		return &ValidationError{Field: field, Message: err.Error()}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package cybersource_soap_dm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/hugochinchilla79/cybersource_soap_dm/models"
+)
+
+// ErrUnknownMerchant is returned by MultiClient when a request cannot be
+// routed to a configured merchant.
+var ErrUnknownMerchant = errors.New("cybersource_soap_dm: unknown merchant")
+
+// MerchantResolver returns the merchant ID for a request that does not set
+// RiskAnalysisRequest.MerchantID, e.g. from the storefront in ctx.
+type MerchantResolver func(ctx context.Context, req models.RiskAnalysisRequest) (string, error)
+
+// MultiClient routes requests to one Client per merchant. Merchants whose
+// configs use the same P12 file (or transaction key mode) share the loaded
+// certificate and HTTP transport, so connections are pooled across them.
+//
+// A meta key config (Config.ChildMerchantIDs) serves its portfolio merchant
+// and every listed child with a single Client.
+type MultiClient struct {
+	clients    []*Client
+	byMerchant map[string]*Client
+	resolver   MerchantResolver
+}
+
+// NewMultiClient creates a client for each config. resolver is consulted
+// for requests without a MerchantID and may be nil. Every merchant ID,
+// including meta key children, must be configured only once.
+func NewMultiClient(configs []Config, resolver MerchantResolver) (*MultiClient, error) {
+	m := &MultiClient{
+		byMerchant: make(map[string]*Client),
+		resolver:   resolver,
+	}
+	credentials := make(map[string]*credential)
+	for _, cfg := range configs {
+		c, err := newClient(cfg, credentials)
+		if err != nil {
+			return nil, fmt.Errorf("merchant %q: %w", cfg.MerchantID, err)
+		}
+		for _, id := range append([]string{cfg.MerchantID}, cfg.ChildMerchantIDs...) {
+			if _, dup := m.byMerchant[id]; dup {
+				return nil, fmt.Errorf("cybersource_soap_dm: merchant %q configured twice", id)
+			}
+			m.byMerchant[id] = c
+		}
+		m.clients = append(m.clients, c)
+	}
+	return m, nil
+}
+
+// Client returns the client serving a merchant ID.
+func (m *MultiClient) Client(merchantID string) (*Client, bool) {
+	c, ok := m.byMerchant[merchantID]
+	return c, ok
+}
+
+// Clients returns the clients in config order.
+func (m *MultiClient) Clients() []*Client {
+	return append([]*Client(nil), m.clients...)
+}
+
+// AnalyzeRisk routes the request to its merchant's client and performs the
+// risk analysis. The merchant is RiskAnalysisRequest.MerchantID, or the
+// resolver's answer when it is empty.
+func (m *MultiClient) AnalyzeRisk(ctx context.Context, req models.RiskAnalysisRequest) (models.RiskAnalysisAPIResponse, error) {
+	c, merchantID, err := m.route(ctx, req)
+	if err != nil {
+		return models.RiskAnalysisAPIResponse{}, err
+	}
+	req.MerchantID = merchantID
+	return c.AnalyzeRisk(ctx, req)
+}
+
+func (m *MultiClient) route(ctx context.Context, req models.RiskAnalysisRequest) (*Client, string, error) {
+	merchantID := req.MerchantID
+	if merchantID == "" && m.resolver != nil {
+		var err error
+		if merchantID, err = m.resolver(ctx, req); err != nil {
+			return nil, "", fmt.Errorf("cybersource_soap_dm: resolve merchant: %w", err)
+		}
+	}
+	if merchantID == "" {
+		return nil, "", fmt.Errorf("%w: request has no MerchantID", ErrUnknownMerchant)
+	}
+	c, ok := m.byMerchant[merchantID]
+	if !ok {
+		return nil, "", fmt.Errorf("%w %q", ErrUnknownMerchant, merchantID)
+	}
+	return c, merchantID, nil
+}
@@ -0,0 +1,186 @@
+package cybersource_soap_dm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hugochinchilla79/cybersource_soap_dm/models"
+)
+
+var merchantIDPattern = regexp.MustCompile(`merchantID>([^<]*)<`)
+
+type storefrontKey struct{}
+
+// storefrontResolver maps the storefront in ctx to a merchant ID.
+func storefrontResolver(ctx context.Context, _ models.RiskAnalysisRequest) (string, error) {
+	switch ctx.Value(storefrontKey{}) {
+	case "eu":
+		return "store_a_eu", nil
+	case "b":
+		return "store_b", nil
+	case nil:
+		return "", errors.New("no storefront")
+	}
+	return "store_unknown", nil
+}
+
+// newTestMultiClient returns a MultiClient for store_a (with meta key
+// child store_a_eu) and store_b sharing one P12 file, and store_c with its
+// own, all sending to one server that records the merchant IDs it sees.
+func newTestMultiClient(t *testing.T) (*MultiClient, func() []string) {
+	t.Helper()
+	var (
+		mu   sync.Mutex
+		seen []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if m := merchantIDPattern.FindSubmatch(body); m != nil {
+			mu.Lock()
+			seen = append(seen, string(m[1]))
+			mu.Unlock()
+		}
+		io.WriteString(w, acceptReply)
+	}))
+	t.Cleanup(srv.Close)
+
+	shared := writeTestP12(t, testKey(t))
+	base := Config{BaseURL: srv.URL, AllowInsecureHTTP: true, P12Password: testP12Password}
+	a, b, other := base, base, base
+	a.MerchantID, a.P12Path, a.ChildMerchantIDs = "store_a", shared, []string{"store_a_eu"}
+	b.MerchantID, b.P12Path = "store_b", shared
+	other.MerchantID, other.P12Path = "store_c", writeTestP12(t, testKey(t))
+
+	m, err := NewMultiClient([]Config{a, b, other}, storefrontResolver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), seen...)
+	}
+}
+
+func TestMultiClientRouting(t *testing.T) {
+	m, seen := newTestMultiClient(t)
+
+	tests := []struct {
+		name       string
+		storefront string
+		merchantID string
+		want       string
+	}{
+		{name: "resolver picks a meta key child", storefront: "eu", want: "store_a_eu"},
+		{name: "resolver picks a merchant", storefront: "b", want: "store_b"},
+		{name: "request merchant wins over resolver", storefront: "eu", merchantID: "store_c", want: "store_c"},
+		{name: "portfolio merchant", merchantID: "store_a", want: "store_a"},
+	}
+	for _, tt := range tests {
+		ctx := context.Background()
+		if tt.storefront != "" {
+			ctx = context.WithValue(ctx, storefrontKey{}, tt.storefront)
+		}
+		req := testRequest("multi")
+		req.MerchantID = tt.merchantID
+		if _, err := m.AnalyzeRisk(ctx, req); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		got := seen()
+		if last := got[len(got)-1]; last != tt.want {
+			t.Errorf("%s: sent for merchant %q, want %q", tt.name, last, tt.want)
+		}
+	}
+}
+
+func TestMultiClientUnknownMerchant(t *testing.T) {
+	m, seen := newTestMultiClient(t)
+
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		merchantID string
+		want       string
+	}{
+		{"unknown request merchant", context.Background(), "store_z", `"store_z"`},
+		{"resolver returns unknown merchant", context.WithValue(context.Background(), storefrontKey{}, "zz"), "", `"store_unknown"`},
+	}
+	for _, tt := range tests {
+		req := testRequest("multi")
+		req.MerchantID = tt.merchantID
+		_, err := m.AnalyzeRisk(tt.ctx, req)
+		if !errors.Is(err, ErrUnknownMerchant) || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want ErrUnknownMerchant for %s", tt.name, err, tt.want)
+		}
+	}
+
+	if _, err := m.AnalyzeRisk(context.Background(), testRequest("multi")); err == nil || !strings.Contains(err.Error(), "no storefront") {
+		t.Errorf("resolver error = %v, want it wrapped", err)
+	}
+
+	noResolver, err := NewMultiClient([]Config{{
+		MerchantID:     "store_a",
+		AuthMode:       AuthTransactionKey,
+		TransactionKey: "key",
+	}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := noResolver.AnalyzeRisk(context.Background(), testRequest("multi")); !errors.Is(err, ErrUnknownMerchant) {
+		t.Errorf("no MerchantID and no resolver: err = %v, want ErrUnknownMerchant", err)
+	}
+
+	if got := seen(); len(got) != 0 {
+		t.Errorf("requests sent for unknown merchants: %v", got)
+	}
+}
+
+func TestMultiClientSharesCredentials(t *testing.T) {
+	m, _ := newTestMultiClient(t)
+
+	a, _ := m.Client("store_a")
+	child, _ := m.Client("store_a_eu")
+	b, _ := m.Client("store_b")
+	other, _ := m.Client("store_c")
+	if a == nil || b == nil || other == nil {
+		t.Fatal("configured merchant has no client")
+	}
+	if child != a {
+		t.Error("meta key child is not served by its portfolio merchant's client")
+	}
+	if len(m.Clients()) != 3 {
+		t.Errorf("got %d clients, want one per config", len(m.Clients()))
+	}
+	if a.httpClient.Transport != b.httpClient.Transport {
+		t.Error("merchants with the same P12 file do not share the transport")
+	}
+	if &a.tlsCert.Certificate[0][0] != &b.tlsCert.Certificate[0][0] {
+		t.Error("merchants with the same P12 file loaded it twice")
+	}
+	if a.httpClient.Transport == other.httpClient.Transport {
+		t.Error("merchants with different P12 files share a transport")
+	}
+}
+
+func TestNewMultiClientRejectsDuplicateMerchants(t *testing.T) {
+	key := func(id string, children ...string) Config {
+		return Config{MerchantID: id, ChildMerchantIDs: children, AuthMode: AuthTransactionKey, TransactionKey: "key"}
+	}
+	tests := [][]Config{
+		{key("store_a"), key("store_a")},
+		{key("store_a", "store_b"), key("store_b")},
+	}
+	for _, configs := range tests {
+		if _, err := NewMultiClient(configs, nil); err == nil || !strings.Contains(err.Error(), "configured twice") {
+			t.Errorf("%v: err = %v, want a duplicate merchant error", configs, err)
+		}
+	}
+}
@@ -10,6 +10,13 @@ import (
 	pkcs12 "software.sslmate.com/src/go-pkcs12"
 )
 
+// LoadP12Certificate loads a P12/PFX certificate file, e.g. to inspect the
+// certificate before creating a Client. A leading "~/" in p12Path is
+// expanded to the user's home directory.
+func LoadP12Certificate(p12Path, password string) (tls.Certificate, error) {
+	return loadP12Certificate(p12Path, password)
+}
+
 // loadP12Certificate loads a P12/PFX certificate file and returns a TLS certificate
 // containing the leaf certificate, CA chain, and private key.
 func loadP12Certificate(p12Path, password string) (tls.Certificate, error) {
@@ -0,0 +1,46 @@
+package cybersource_soap_dm
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/hugochinchilla79/cybersource_soap_dm/models"
+)
+
+func TestPointerPaymentMethods(t *testing.T) {
+	c := newTestClient(t, Config{})
+	check := &models.Check{AccountNumber: "4100", AccountType: models.CheckAccountChecking, BankTransitNumber: "011000015"}
+
+	req := testRequest("order-1")
+	req.PaymentMethod = check
+	env := buildTestEnvelope(t, c, req)
+	if env.Body.RequestMessage.Check == nil || env.Body.RequestMessage.Card != nil {
+		t.Errorf("*Check built as %+v, want a check element and no card", env.Body.RequestMessage)
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		t.Fatalf("marshal *Check: %v", err)
+	}
+	var decoded models.RiskAnalysisRequest
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := decoded.PaymentMethod.(models.Check); !ok || got != *check {
+		t.Errorf("round trip PaymentMethod = %#v, want %#v", decoded.PaymentMethod, *check)
+	}
+
+	req.PaymentMethod = (*models.PayPal)(nil)
+	var ve *models.ValidationError
+	if _, err := c.validateRequest(req); !errors.As(err, &ve) || ve.Field != "paymentMethod" {
+		t.Errorf("validate nil *PayPal: err = %v, want paymentMethod ValidationError", err)
+	}
+	if _, err := c.buildSOAPRequest(req, nil); err == nil {
+		t.Error("build nil *PayPal: want error")
+	}
+	if _, err := json.Marshal(req); err == nil || !strings.Contains(err.Error(), "nil payment method") {
+		t.Errorf("marshal nil *PayPal: err = %v", err)
+	}
+}
@@ -0,0 +1,122 @@
+package cybersource_soap_dm
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// tokenBucket is a token-bucket rate limiter: it holds up to burst tokens
+// and refills at rate tokens per second. It is safe for concurrent use.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// take consumes a token if one is available. Otherwise it returns how long
+// to wait until the next token.
+func (b *tokenBucket) take() (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second)), false
+}
+
+// Allow reports whether a token was available and consumes it.
+func (b *tokenBucket) Allow() bool {
+	_, ok := b.take()
+	return ok
+}
+
+// Refund returns a token taken for a request that was not sent.
+func (b *tokenBucket) Refund() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = min(b.tokens+1, b.burst)
+}
+
+// Wait blocks until a token is available or ctx is done.
+func (b *tokenBucket) Wait(ctx context.Context) error {
+	for {
+		wait, ok := b.take()
+		if ok {
+			return nil
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// acquire applies the client's rate limit and in-flight cap before a request
+// is sent. The returned release func must be called when the request is done.
+func (c *Client) acquire(ctx context.Context) (release func(), err error) {
+	if c.limiter != nil {
+		if c.cfg.RateLimitFailFast {
+			if !c.limiter.Allow() {
+				return nil, ErrRateLimited
+			}
+		} else if err := c.limiter.Wait(ctx); err != nil {
+			return nil, fmt.Errorf("cybersource_soap_dm: wait for rate limit: %w", err)
+		}
+	}
+
+	if c.inFlight == nil {
+		return func() {}, nil
+	}
+	// A request refused a slot is not sent, so its rate token is refunded
+	// rather than counted against the rate budget.
+	if c.cfg.RateLimitFailFast {
+		select {
+		case c.inFlight <- struct{}{}:
+		default:
+			c.refundToken()
+			return nil, ErrRateLimited
+		}
+	} else {
+		select {
+		case c.inFlight <- struct{}{}:
+		case <-ctx.Done():
+			c.refundToken()
+			return nil, fmt.Errorf("cybersource_soap_dm: wait for in-flight slot: %w", ctx.Err())
+		}
+	}
+	return func() { <-c.inFlight }, nil
+}
+
+func (c *Client) refundToken() {
+	if c.limiter != nil {
+		c.limiter.Refund()
+	}
+}
@@ -0,0 +1,28 @@
+package cybersource_soap_dm
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestAcquireFailFastRefundsTokenWhenSlotRefused(t *testing.T) {
+	c := &Client{
+		cfg:      Config{RateLimitFailFast: true},
+		limiter:  newTokenBucket(0.001, 2),
+		inFlight: make(chan struct{}, 1),
+	}
+	release, err := c.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("first acquire: %v", err)
+	}
+
+	// The slot is taken: the call is refused but keeps the second token.
+	if _, err := c.acquire(context.Background()); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("second acquire err = %v, want ErrRateLimited", err)
+	}
+	release()
+	if _, err := c.acquire(context.Background()); err != nil {
+		t.Fatalf("acquire after release: %v (refused call consumed a token)", err)
+	}
+}
@@ -0,0 +1,108 @@
+package cybersource_soap_dm
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/beevik/etree"
+	"github.com/hugochinchilla79/cybersource_soap_dm/models"
+)
+
+// redactedValue replaces values that must never be stored or displayed.
+const redactedValue = "[REDACTED]"
+
+// redactEnvelope returns a copy of a SOAP request envelope with payment
+// account numbers masked and PII merchant-defined data fields replaced.
+// Card and gift card numbers keep the BIN and last four digits; check
+// account numbers keep the last four digits; UsernameToken passwords
+// (transaction keys) are replaced. Indentation is preserved; the output
+// no longer matches its signature.
+func redactEnvelope(envelope []byte, schema *models.MDDSchema) ([]byte, error) {
+	doc := etree.NewDocument()
+	doc.ReadSettings.PreserveCData = true
+	if err := doc.ReadFromBytes(envelope); err != nil {
+		return nil, fmt.Errorf("parse soap xml: %w", err)
+	}
+	root := doc.Root()
+	if root == nil {
+		return nil, fmt.Errorf("soap envelope missing")
+	}
+	if el := findPath(root, "Header", "Security", "UsernameToken", "Password"); el != nil {
+		el.SetText(redactedValue)
+	}
+	body := findChild(root, "Body")
+	if body == nil {
+		return nil, fmt.Errorf("soap Body not found")
+	}
+	if msg := findChild(body, "requestMessage"); msg != nil {
+		redactRequestMessage(msg, schema)
+	}
+
+	var out bytes.Buffer
+	if _, err := doc.WriteTo(&out); err != nil {
+		return nil, fmt.Errorf("serialize redacted xml: %w", err)
+	}
+	return out.Bytes(), nil
+}
+
+// RedactEnvelope returns a copy of a SOAP request envelope, such as one
+// from BuildSignedRequest, redacted as in audit records: account numbers
+// masked, transaction keys and PII merchant-defined data fields (per
+// Config.MDDSchema) replaced. The copy no longer matches its signature.
+func (c *Client) RedactEnvelope(envelope []byte) ([]byte, error) {
+	redacted, err := redactEnvelope(envelope, c.cfg.MDDSchema)
+	if err != nil {
+		return nil, fmt.Errorf("cybersource_soap_dm: redact envelope: %w", err)
+	}
+	return redacted, nil
+}
+
+func redactRequestMessage(msg *etree.Element, schema *models.MDDSchema) {
+	if el := findPath(msg, "card", "accountNumber"); el != nil {
+		el.SetText(maskPAN(el.Text()))
+	}
+	if el := findPath(msg, "giftCard", "accountNumber"); el != nil {
+		el.SetText(maskPAN(el.Text()))
+	}
+	if el := findPath(msg, "check", "accountNumber"); el != nil {
+		el.SetText(maskTail(el.Text(), 4))
+	}
+	if mdd := findChild(msg, "merchantDefinedData"); mdd != nil {
+		for _, field := range mdd.ChildElements() {
+			index, err := strconv.Atoi(strings.TrimPrefix(field.Tag, "field"))
+			if err != nil {
+				continue
+			}
+			if f, ok := schema.FieldByIndex(index); ok && f.PII {
+				field.SetText(redactedValue)
+			}
+		}
+	}
+}
+
+// maskPAN keeps the first six and last four digits of a card number.
+func maskPAN(pan string) string {
+	if len(pan) <= 10 {
+		return strings.Repeat("*", len(pan))
+	}
+	return pan[:6] + strings.Repeat("*", len(pan)-10) + pan[len(pan)-4:]
+}
+
+// maskTail keeps only the last n characters.
+func maskTail(s string, n int) string {
+	if len(s) <= n {
+		return strings.Repeat("*", len(s))
+	}
+	return strings.Repeat("*", len(s)-n) + s[len(s)-n:]
+}
+
+func findPath(el *etree.Element, names ...string) *etree.Element {
+	for _, name := range names {
+		if el = findChild(el, name); el == nil {
+			return nil
+		}
+	}
+	return el
+}
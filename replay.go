@@ -0,0 +1,453 @@
+package cybersource_soap_dm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hugochinchilla79/cybersource_soap_dm/models"
+)
+
+// ReplayFormat selects how Replay writes results.
+type ReplayFormat string
+
+const (
+	// ReplayJSONL writes one JSON ReplayResult per line.
+	ReplayJSONL ReplayFormat = "jsonl"
+
+	// ReplayCSV writes a header row and one row per ReplayResult.
+	ReplayCSV ReplayFormat = "csv"
+)
+
+// maxReplayLine is the longest input line Replay accepts.
+const maxReplayLine = 4 << 20
+
+// ReplayOptions configures Replay and ReplayFile.
+type ReplayOptions struct {
+	// Format is the output format. Zero means ReplayJSONL, or for
+	// ReplayFile the format implied by the output file extension.
+	Format ReplayFormat
+
+	// Concurrency is the maximum number of requests in flight.
+	// Zero means DefaultBatchConcurrency.
+	Concurrency int
+
+	// RatePerSecond caps how many requests are started per second.
+	// Zero means no replay-level limit.
+	RatePerSecond float64
+
+	// Burst is the number of requests that may start at once before
+	// RatePerSecond applies. Zero means 1.
+	Burst int
+
+	// Completed lists input line numbers that already have a result and
+	// are skipped. ReplayFile fills it from the existing output file.
+	Completed map[int]bool
+
+	// Progress, when set, is called with each result after it is written.
+	// Calls are serialized.
+	Progress func(ReplayResult)
+}
+
+// ReplayResult is the outcome of screening one input line.
+type ReplayResult struct {
+	// Line is the 1-based line number of the request in the input.
+	Line int `json:"line"`
+
+	MerchantReferenceCode string `json:"merchant_reference_code,omitempty"`
+	Decision              string `json:"decision,omitempty"`
+	ReasonCode            int    `json:"reason_code,omitempty"`
+	AFSReasonCode         int    `json:"afs_reason_code,omitempty"`
+
+	// Score is the AFS score (afsResult).
+	Score string `json:"score,omitempty"`
+
+	// FactorCodes are the "^"-separated AFS factor codes.
+	FactorCodes string `json:"factor_codes,omitempty"`
+
+	RequestID string `json:"request_id,omitempty"`
+	Fallback  bool   `json:"fallback,omitempty"`
+
+	// LatencyMS is how long AnalyzeRisk took, in milliseconds.
+	LatencyMS int64 `json:"latency_ms"`
+
+	// Error is set when the line could not be decoded or screened. Such
+	// lines are retried when the replay is resumed.
+	Error string `json:"error,omitempty"`
+}
+
+// ReplaySummary counts the lines processed by a replay.
+type ReplaySummary struct {
+	// Requests is the number of non-blank input lines read.
+	Requests int
+
+	// Skipped is the number of lines skipped because they were in
+	// ReplayOptions.Completed.
+	Skipped int
+
+	// Screened is the number of lines screened successfully.
+	Screened int
+
+	// Failed is the number of lines written with an Error.
+	Failed int
+
+	// Decisions counts the screened lines by decision.
+	Decisions map[string]int
+}
+
+var replayCSVHeader = []string{
+	"line", "merchant_reference_code", "decision", "reason_code", "afs_reason_code",
+	"score", "factor_codes", "request_id", "fallback", "latency_ms", "error",
+}
+
+// Replay screens the requests in in, one JSON models.RiskAnalysisRequest
+// per line (see models.RiskAnalysisRequest.UnmarshalJSON; blank lines are
+// ignored), and writes a ReplayResult per line to out as each completes,
+// so results are not in input order. Lines that cannot be decoded or
+// screened are written with an Error rather than stopping the replay.
+//
+// Replay returns when the input is exhausted, ctx is cancelled or out
+// fails. Requests cancelled in flight are not written, so a resumed replay
+// picks them up. Use ReplayFile to resume against the same output file.
+func (c *Client) Replay(ctx context.Context, in io.Reader, out io.Writer, opts ReplayOptions) (ReplaySummary, error) {
+	format, err := opts.format("")
+	if err != nil {
+		return ReplaySummary{}, err
+	}
+	return c.replay(ctx, in, newReplayWriter(out, format, true), opts)
+}
+
+// ReplayFile replays the requests in inPath and appends results to
+// outPath, creating it if needed. When outPath already holds results from
+// an interrupted run, lines with a successful result are skipped and the
+// rest, including circuit breaker fallback decisions, are screened again;
+// a line's last result in the file is the current one. A partial last
+// line left by a crash is discarded.
+func (c *Client) ReplayFile(ctx context.Context, inPath, outPath string, opts ReplayOptions) (ReplaySummary, error) {
+	format, err := opts.format(outPath)
+	if err != nil {
+		return ReplaySummary{}, err
+	}
+	in, err := os.Open(inPath)
+	if err != nil {
+		return ReplaySummary{}, fmt.Errorf("cybersource_soap_dm: replay: %w", err)
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(outPath, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return ReplaySummary{}, fmt.Errorf("cybersource_soap_dm: replay: %w", err)
+	}
+	defer out.Close()
+
+	previous, err := io.ReadAll(out)
+	if err != nil {
+		return ReplaySummary{}, fmt.Errorf("cybersource_soap_dm: replay: %w", err)
+	}
+	if complete := bytes.LastIndexByte(previous, '\n') + 1; complete < len(previous) {
+		previous = previous[:complete]
+		if err := out.Truncate(int64(complete)); err != nil {
+			return ReplaySummary{}, fmt.Errorf("cybersource_soap_dm: replay: %w", err)
+		}
+	}
+	if _, err := out.Seek(0, io.SeekEnd); err != nil {
+		return ReplaySummary{}, fmt.Errorf("cybersource_soap_dm: replay: %w", err)
+	}
+
+	results, err := ReadReplayResults(bytes.NewReader(previous), format)
+	if err != nil {
+		return ReplaySummary{}, fmt.Errorf("cybersource_soap_dm: replay: read %s: %w", outPath, err)
+	}
+	completed := make(map[int]bool, len(opts.Completed)+len(results))
+	for line, done := range opts.Completed {
+		completed[line] = done
+	}
+	for _, r := range results {
+		completed[r.Line] = r.Error == "" && !r.Fallback
+	}
+	opts.Completed = completed
+
+	return c.replay(ctx, in, newReplayWriter(out, format, len(previous) == 0), opts)
+}
+
+// ReadReplayResults reads results written by Replay in the given format.
+func ReadReplayResults(r io.Reader, format ReplayFormat) ([]ReplayResult, error) {
+	switch format {
+	case ReplayJSONL, "":
+		var results []ReplayResult
+		dec := json.NewDecoder(r)
+		for {
+			var res ReplayResult
+			if err := dec.Decode(&res); err == io.EOF {
+				return results, nil
+			} else if err != nil {
+				return results, err
+			}
+			results = append(results, res)
+		}
+	case ReplayCSV:
+		return readReplayCSV(r)
+	}
+	return nil, fmt.Errorf("cybersource_soap_dm: unknown replay format %q", format)
+}
+
+func (o ReplayOptions) format(path string) (ReplayFormat, error) {
+	switch o.Format {
+	case ReplayJSONL, ReplayCSV:
+		return o.Format, nil
+	case "":
+		if strings.EqualFold(filepath.Ext(path), ".csv") {
+			return ReplayCSV, nil
+		}
+		return ReplayJSONL, nil
+	}
+	return "", fmt.Errorf("cybersource_soap_dm: unknown replay format %q", o.Format)
+}
+
+type replayJob struct {
+	line int
+	data []byte
+}
+
+func (c *Client) replay(ctx context.Context, in io.Reader, w *replayWriter, opts ReplayOptions) (ReplaySummary, error) {
+	summary := ReplaySummary{Decisions: make(map[string]int)}
+
+	workers := opts.Concurrency
+	if workers <= 0 {
+		workers = DefaultBatchConcurrency
+	}
+	var limiter *tokenBucket
+	if opts.RatePerSecond > 0 {
+		limiter = newTokenBucket(opts.RatePerSecond, opts.Burst)
+	}
+
+	// runCtx also stops the replay when writing a result fails.
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan replayJob)
+	results := make(chan ReplayResult)
+	var readErr error
+	go func() {
+		defer close(jobs)
+		scanner := bufio.NewScanner(in)
+		scanner.Buffer(make([]byte, 0, 64<<10), maxReplayLine)
+		for line := 1; scanner.Scan(); line++ {
+			data := bytes.TrimSpace(scanner.Bytes())
+			if len(data) == 0 {
+				continue
+			}
+			summary.Requests++
+			if opts.Completed[line] {
+				summary.Skipped++
+				continue
+			}
+			select {
+			case jobs <- replayJob{line: line, data: bytes.Clone(data)}:
+			case <-runCtx.Done():
+				return
+			}
+		}
+		readErr = scanner.Err()
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				res, ok := c.replayLine(runCtx, job, limiter)
+				if !ok {
+					continue
+				}
+				results <- res
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var writeErr error
+	for res := range results {
+		if writeErr != nil {
+			continue
+		}
+		if err := w.write(res); err != nil {
+			writeErr = fmt.Errorf("cybersource_soap_dm: replay: write result: %w", err)
+			cancel()
+			continue
+		}
+		if res.Error != "" {
+			summary.Failed++
+		} else {
+			summary.Screened++
+			summary.Decisions[res.Decision]++
+		}
+		if opts.Progress != nil {
+			opts.Progress(res)
+		}
+	}
+
+	switch {
+	case writeErr != nil:
+		return summary, writeErr
+	case ctx.Err() != nil:
+		return summary, ctx.Err()
+	case readErr != nil:
+		return summary, fmt.Errorf("cybersource_soap_dm: replay: read requests: %w", readErr)
+	}
+	return summary, nil
+}
+
+// replayLine screens one input line. It reports false when the replay was
+// cancelled before the line finished, so no result should be written.
+func (c *Client) replayLine(ctx context.Context, job replayJob, limiter *tokenBucket) (ReplayResult, bool) {
+	res := ReplayResult{Line: job.line}
+	var req models.RiskAnalysisRequest
+	if err := json.Unmarshal(job.data, &req); err != nil {
+		res.Error = fmt.Sprintf("decode request: %v", err)
+		return res, true
+	}
+	res.MerchantReferenceCode = req.MerchantReferenceCode
+
+	if limiter != nil {
+		if err := limiter.Wait(ctx); err != nil {
+			return res, false
+		}
+	}
+	start := time.Now()
+	resp, err := c.AnalyzeRisk(ctx, req)
+	res.LatencyMS = time.Since(start).Milliseconds()
+	if err != nil {
+		if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+			return res, false
+		}
+		res.Error = err.Error()
+		return res, true
+	}
+
+	d := resp.Data
+	res.Decision = d.Decision
+	res.ReasonCode = d.ReasonCode
+	res.RequestID = d.RequestID
+	res.Fallback = d.Fallback
+	if d.MerchantReferenceCode != "" {
+		res.MerchantReferenceCode = d.MerchantReferenceCode
+	}
+	if a := d.AFSReply; a != nil {
+		res.AFSReasonCode = a.ReasonCode
+		res.Score = a.AFSResult
+		res.FactorCodes = a.AFSFactorCode
+	}
+	return res, true
+}
+
+// replayWriter writes results in one format, flushing each so that an
+// interrupted replay loses at most the requests in flight.
+type replayWriter struct {
+	out    io.Writer
+	format ReplayFormat
+	csv    *csv.Writer
+	header bool
+}
+
+func newReplayWriter(out io.Writer, format ReplayFormat, header bool) *replayWriter {
+	w := &replayWriter{out: out, format: format, header: header}
+	if format == ReplayCSV {
+		w.csv = csv.NewWriter(out)
+	}
+	return w
+}
+
+func (w *replayWriter) write(res ReplayResult) error {
+	if w.csv == nil {
+		data, err := json.Marshal(res)
+		if err != nil {
+			return err
+		}
+		_, err = w.out.Write(append(data, '\n'))
+		return err
+	}
+	if w.header {
+		w.header = false
+		if err := w.csv.Write(replayCSVHeader); err != nil {
+			return err
+		}
+	}
+	record := []string{
+		strconv.Itoa(res.Line),
+		res.MerchantReferenceCode,
+		res.Decision,
+		strconv.Itoa(res.ReasonCode),
+		strconv.Itoa(res.AFSReasonCode),
+		res.Score,
+		res.FactorCodes,
+		res.RequestID,
+		strconv.FormatBool(res.Fallback),
+		strconv.FormatInt(res.LatencyMS, 10),
+		res.Error,
+	}
+	if err := w.csv.Write(record); err != nil {
+		return err
+	}
+	w.csv.Flush()
+	return w.csv.Error()
+}
+
+func readReplayCSV(r io.Reader) ([]ReplayResult, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = len(replayCSVHeader)
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	if strings.Join(records[0], ",") != strings.Join(replayCSVHeader, ",") {
+		return nil, errors.New("unexpected CSV header")
+	}
+
+	results := make([]ReplayResult, 0, len(records)-1)
+	for i, rec := range records[1:] {
+		res := ReplayResult{
+			MerchantReferenceCode: rec[1],
+			Decision:              rec[2],
+			Score:                 rec[5],
+			FactorCodes:           rec[6],
+			RequestID:             rec[7],
+			Error:                 rec[10],
+		}
+		var errs []error
+		var err error
+		res.Line, err = strconv.Atoi(rec[0])
+		errs = append(errs, err)
+		res.ReasonCode, err = strconv.Atoi(rec[3])
+		errs = append(errs, err)
+		res.AFSReasonCode, err = strconv.Atoi(rec[4])
+		errs = append(errs, err)
+		res.Fallback, err = strconv.ParseBool(rec[8])
+		errs = append(errs, err)
+		res.LatencyMS, err = strconv.ParseInt(rec[9], 10, 64)
+		errs = append(errs, err)
+		if err := errors.Join(errs...); err != nil {
+			return results, fmt.Errorf("row %d: %w", i+2, err)
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
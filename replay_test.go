@@ -0,0 +1,270 @@
+package cybersource_soap_dm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var referenceCodePattern = regexp.MustCompile(`merchantReferenceCode>([^<]*)<`)
+
+// replayServer accepts every request and records the merchant reference
+// codes it was sent. block, when set, is called before replying; when it
+// returns true no reply is written.
+type replayServer struct {
+	mu    sync.Mutex
+	refs  []string
+	block func(ref string, r *http.Request) bool
+}
+
+func (s *replayServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	var ref string
+	if m := referenceCodePattern.FindSubmatch(body); m != nil {
+		ref = string(m[1])
+	}
+	s.mu.Lock()
+	s.refs = append(s.refs, ref)
+	s.mu.Unlock()
+	if s.block != nil && s.block(ref, r) {
+		return
+	}
+	io.WriteString(w, acceptReply)
+}
+
+func (s *replayServer) screened() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	refs := append([]string(nil), s.refs...)
+	sort.Strings(refs)
+	return refs
+}
+
+func newReplayClient(t *testing.T, s *replayServer) *Client {
+	t.Helper()
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	return newTestClient(t, Config{BaseURL: srv.URL, AllowInsecureHTTP: true})
+}
+
+// replayInput returns one JSON request per reference code, as Replay reads.
+func replayInput(t *testing.T, refs ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	for _, ref := range refs {
+		data, err := json.Marshal(testRequest(ref))
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+func TestReplay(t *testing.T) {
+	s := &replayServer{}
+	c := newReplayClient(t, s)
+
+	in := append(replayInput(t, "r1", "r2"), "\n{not json}\n"...)
+	var out bytes.Buffer
+	var progress []int
+	summary, err := c.Replay(context.Background(), bytes.NewReader(in), &out, ReplayOptions{
+		Concurrency: 2,
+		Progress:    func(res ReplayResult) { progress = append(progress, res.Line) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ReplaySummary{Requests: 3, Screened: 2, Failed: 1, Decisions: map[string]int{"ACCEPT": 2}}
+	if !reflect.DeepEqual(summary, want) {
+		t.Errorf("summary = %+v, want %+v", summary, want)
+	}
+	if len(progress) != 3 {
+		t.Errorf("Progress called for lines %v, want 3 calls", progress)
+	}
+
+	results, err := ReadReplayResults(&out, ReplayJSONL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byLine := map[int]ReplayResult{}
+	for _, r := range results {
+		byLine[r.Line] = r
+	}
+	if r := byLine[1]; r.Decision != "ACCEPT" || r.Error != "" {
+		t.Errorf("line 1 = %+v, want ACCEPT", r)
+	}
+	if r := byLine[4]; !strings.HasPrefix(r.Error, "decode request:") {
+		t.Errorf("line 4 = %+v, want a decode error", r)
+	}
+}
+
+func TestReplayFileResume(t *testing.T) {
+	tests := []struct {
+		name     string
+		out      string
+		format   ReplayFormat
+		previous string
+	}{
+		{
+			name:   "jsonl",
+			out:    "results.jsonl",
+			format: ReplayJSONL,
+			previous: `{"line":1,"decision":"ACCEPT","reason_code":100,"latency_ms":5}
+{"line":2,"latency_ms":5,"error":"HTTP 503"}
+{"line":3,"decision":"REVIEW","fallback":true,"latency_ms":0}
+{"line":4,"decision":"ACC`,
+		},
+		{
+			name:   "csv",
+			out:    "results.csv",
+			format: ReplayCSV,
+			previous: "line,merchant_reference_code,decision,reason_code,afs_reason_code,score,factor_codes,request_id,fallback,latency_ms,error\n" +
+				"1,r1,ACCEPT,100,0,,,,false,5,\n" +
+				"2,r2,,0,0,,,,false,5,HTTP 503\n" +
+				"3,r3,REVIEW,0,0,,,,true,0,\n" +
+				"4,r4,ACC",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &replayServer{}
+			c := newReplayClient(t, s)
+			dir := t.TempDir()
+			inPath := filepath.Join(dir, "requests.jsonl")
+			outPath := filepath.Join(dir, tt.out)
+			if err := os.WriteFile(inPath, replayInput(t, "r1", "r2", "r3", "r4"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(outPath, []byte(tt.previous), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			summary, err := c.ReplayFile(context.Background(), inPath, outPath, ReplayOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if summary.Requests != 4 || summary.Skipped != 1 || summary.Screened != 3 {
+				t.Errorf("summary = %+v, want 4 requests, 1 skipped, 3 screened", summary)
+			}
+			if got, want := s.screened(), []string{"r2", "r3", "r4"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("screened %v, want %v (completed line skipped, errored and fallback lines rescreened)", got, want)
+			}
+
+			data, err := os.ReadFile(outPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.format == ReplayCSV && strings.Count(string(data), "line,merchant_reference_code") != 1 {
+				t.Errorf("CSV header repeated on resume:\n%s", data)
+			}
+			results, err := ReadReplayResults(bytes.NewReader(data), tt.format)
+			if err != nil {
+				t.Fatalf("output unreadable after resume (partial line not truncated?): %v\n%s", err, data)
+			}
+			if len(results) != 6 {
+				t.Fatalf("got %d results, want 3 kept and 3 appended:\n%s", len(results), data)
+			}
+			last := map[int]ReplayResult{}
+			for _, r := range results {
+				last[r.Line] = r
+			}
+			for line := 1; line <= 4; line++ {
+				if r := last[line]; r.Decision != "ACCEPT" || r.Error != "" || r.Fallback {
+					t.Errorf("line %d last result = %+v, want ACCEPT", line, r)
+				}
+			}
+
+			// A second resume has nothing left to do.
+			summary, err = c.ReplayFile(context.Background(), inPath, outPath, ReplayOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if summary.Skipped != 4 || summary.Screened != 0 {
+				t.Errorf("second resume summary = %+v, want all 4 skipped", summary)
+			}
+		})
+	}
+}
+
+func TestReplayCSVRoundTrip(t *testing.T) {
+	want := []ReplayResult{
+		{Line: 1, MerchantReferenceCode: "order-1", Decision: "ACCEPT", ReasonCode: 100, AFSReasonCode: 100,
+			Score: "42", FactorCodes: "F^V", RequestID: "7000000000000000000001", LatencyMS: 120},
+		{Line: 2, MerchantReferenceCode: `quoted "ref", with comma`, Decision: "REVIEW", ReasonCode: 480, Fallback: true},
+		{Line: 3, Error: "decode request: invalid character 'x'\nsecond line"},
+	}
+	var buf bytes.Buffer
+	w := newReplayWriter(&buf, ReplayCSV, true)
+	for _, r := range want {
+		if err := w.write(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := readReplayCSV(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip =\n%+v\nwant\n%+v", got, want)
+	}
+
+	if _, err := readReplayCSV(strings.NewReader("a,b,c,d,e,f,g,h,i,j,k\n")); err == nil {
+		t.Error("unexpected header accepted")
+	}
+}
+
+func TestReplayCancelDoesNotWriteInFlight(t *testing.T) {
+	arrived := make(chan struct{})
+	s := &replayServer{block: func(ref string, r *http.Request) bool {
+		if ref != "slow" {
+			return false
+		}
+		close(arrived)
+		<-r.Context().Done()
+		return true
+	}}
+	c := newReplayClient(t, s)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	fastWritten := make(chan struct{})
+	go func() {
+		<-arrived
+		<-fastWritten
+		cancel()
+	}()
+
+	var out bytes.Buffer
+	_, err := c.Replay(ctx, bytes.NewReader(replayInput(t, "fast", "slow")), &out, ReplayOptions{
+		Concurrency: 2,
+		Progress: func(res ReplayResult) {
+			if res.Line == 1 {
+				close(fastWritten)
+			}
+		},
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("error = %v, want context.Canceled", err)
+	}
+	results, err := ReadReplayResults(&out, ReplayJSONL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Line != 1 {
+		t.Errorf("results = %+v, want only line 1 (the cancelled line is left for a resume)", results)
+	}
+}
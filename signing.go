@@ -3,12 +3,12 @@ package cybersource_soap_dm
 import (
 	"bytes"
 	"crypto"
-	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/base64"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/beevik/etree"
 	dsig "github.com/russellhaering/goxmldsig"
@@ -24,13 +24,21 @@ const (
 	algExcC14N   = "http://www.w3.org/2001/10/xml-exc-c14n#"
 	algRsaSha256 = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
 	algSha256    = "http://www.w3.org/2001/04/xmlenc#sha256"
+
+	valueTypeX509v3    = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-x509-token-profile-1.0#X509v3"
+	encodingTypeBase64 = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-soap-message-security-1.0#Base64Binary"
 )
 
 // signSOAPEnvelope injects a wsse:Security header into the SOAP envelope containing:
+//   - wsu:Timestamp (Created/Expires), when opts.TimestampTTL is set
 //   - wsse:BinarySecurityToken (X.509 leaf cert, DER base64)
-//   - ds:Signature with SignedInfo referencing "#Body" (exclusive C14N, RSA-SHA256)
-//   - ds:KeyInfo → wsse:SecurityTokenReference → wsse:Reference URI="#X509Token"
-func signSOAPEnvelope(unsignedXML []byte, tlsCert tls.Certificate) ([]byte, error) {
+//   - ds:Signature with SignedInfo referencing the Body and Timestamp
+//     (exclusive C14N; RSA-SHA256 and SHA-256 unless opts say otherwise)
+//   - ds:KeyInfo → wsse:SecurityTokenReference → wsse:Reference to the token
+//
+// It builds a fresh document per call and only reads tlsCert, so it is safe
+// to call concurrently with a shared certificate.
+func signSOAPEnvelope(unsignedXML []byte, tlsCert tls.Certificate, opts SigningOptions) ([]byte, error) {
 	doc := etree.NewDocument()
 	if err := doc.ReadFromBytes(unsignedXML); err != nil {
 		return nil, fmt.Errorf("parse soap xml: %w", err)
@@ -52,6 +60,27 @@ func signSOAPEnvelope(unsignedXML []byte, tlsCert tls.Certificate) ([]byte, erro
 		env.InsertChildAt(0, header)
 	}
 
+	leaf, err := leafCertFromTLS(tlsCert)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := tlsCert.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("private key cannot sign (got %T)", tlsCert.PrivateKey)
+	}
+	method, err := opts.signatureMethod(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	digestHash, err := opts.digestHash()
+	if err != nil {
+		return nil, err
+	}
+	ids, err := opts.newIDs()
+	if err != nil {
+		return nil, err
+	}
+
 	// Declare namespaces on Body and requestMessage so that the
 	// goxmldsig exclusive C14N canonicalizer can resolve prefixes
 	// (it cannot walk above the canonicalized subtree root).
@@ -61,31 +90,35 @@ func signSOAPEnvelope(unsignedXML []byte, tlsCert tls.Certificate) ([]byte, erro
 		ensureXMLNS(rm, "ns1", cybsNS)
 	}
 
-	// Mark Body with wsu:Id="Body"
+	// Mark Body with its wsu:Id
 	body.RemoveAttr("wsu:Id")
-	body.CreateAttr("wsu:Id", "Body")
+	body.CreateAttr("wsu:Id", ids.body)
 
 	// --- Build complete Security header (PHP-style local namespace scoping) ---
-	leaf, err := leafCertFromTLS(tlsCert)
-	if err != nil {
-		return nil, err
-	}
-	privKey, ok := tlsCert.PrivateKey.(*rsa.PrivateKey)
-	if !ok {
-		return nil, fmt.Errorf("private key is not RSA (got %T)", tlsCert.PrivateKey)
-	}
 
 	// wsse:Security (xmlns:wsse declared here, not on Envelope)
 	security := etree.NewElement("wsse:Security")
 	ensureXMLNS(security, "wsse", wsseNS)
 	header.AddChild(security)
 
+	// wsu:Timestamp comes first so receivers can reject stale messages early.
+	var timestamp *etree.Element
+	if opts.TimestampTTL > 0 {
+		created := time.Now().UTC()
+		timestamp = etree.NewElement("wsu:Timestamp")
+		ensureXMLNS(timestamp, "wsu", wsuNS)
+		timestamp.CreateAttr("wsu:Id", ids.timestamp)
+		timestamp.CreateElement("wsu:Created").SetText(created.Format(timestampLayout))
+		timestamp.CreateElement("wsu:Expires").SetText(created.Add(opts.TimestampTTL).Format(timestampLayout))
+		security.AddChild(timestamp)
+	}
+
 	// wsse:BinarySecurityToken (xmlns:wsu declared here for wsu:Id)
 	bst := etree.NewElement("wsse:BinarySecurityToken")
 	ensureXMLNS(bst, "wsu", wsuNS)
-	bst.CreateAttr("ValueType", "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-x509-token-profile-1.0#X509v3")
-	bst.CreateAttr("EncodingType", "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-soap-message-security-1.0#Base64Binary")
-	bst.CreateAttr("wsu:Id", "X509Token")
+	bst.CreateAttr("ValueType", valueTypeX509v3)
+	bst.CreateAttr("EncodingType", encodingTypeBase64)
+	bst.CreateAttr("wsu:Id", ids.token)
 	bst.SetText(base64.StdEncoding.EncodeToString(leaf.Raw))
 	security.AddChild(bst)
 
@@ -99,30 +132,19 @@ func signSOAPEnvelope(unsignedXML []byte, tlsCert tls.Certificate) ([]byte, erro
 	ensureXMLNS(signedInfo, "ds", dsNS)
 	sig.AddChild(signedInfo)
 
-	cm := etree.NewElement("ds:CanonicalizationMethod")
-	cm.CreateAttr("Algorithm", algExcC14N)
-	signedInfo.AddChild(cm)
+	signedInfo.AddChild(c14nMethodElement("ds:CanonicalizationMethod", opts.InclusivePrefixes))
 
 	sm := etree.NewElement("ds:SignatureMethod")
-	sm.CreateAttr("Algorithm", algRsaSha256)
+	sm.CreateAttr("Algorithm", string(method.uri))
 	signedInfo.AddChild(sm)
 
-	ref := etree.NewElement("ds:Reference")
-	ref.CreateAttr("URI", "#Body")
-	signedInfo.AddChild(ref)
-
-	transforms := etree.NewElement("ds:Transforms")
-	ref.AddChild(transforms)
-	tr := etree.NewElement("ds:Transform")
-	tr.CreateAttr("Algorithm", algExcC14N)
-	transforms.AddChild(tr)
-
-	dm := etree.NewElement("ds:DigestMethod")
-	dm.CreateAttr("Algorithm", algSha256)
-	ref.AddChild(dm)
-
-	dv := etree.NewElement("ds:DigestValue")
-	ref.AddChild(dv)
+	type reference struct {
+		target, digestValue *etree.Element
+	}
+	refs := []reference{{target: body, digestValue: addReference(signedInfo, ids.body, opts)}}
+	if timestamp != nil {
+		refs = append(refs, reference{target: timestamp, digestValue: addReference(signedInfo, ids.timestamp, opts)})
+	}
 
 	sv := etree.NewElement("ds:SignatureValue")
 	sig.AddChild(sv)
@@ -132,7 +154,7 @@ func signSOAPEnvelope(unsignedXML []byte, tlsCert tls.Certificate) ([]byte, erro
 	str := etree.NewElement("wsse:SecurityTokenReference")
 	ki.AddChild(str)
 	ref2 := etree.NewElement("wsse:Reference")
-	ref2.CreateAttr("URI", "#X509Token")
+	ref2.CreateAttr("URI", "#"+ids.token)
 	str.AddChild(ref2)
 
 	// Remove wsse/wsu/ds from Envelope — they're declared locally now
@@ -144,22 +166,28 @@ func signSOAPEnvelope(unsignedXML []byte, tlsCert tls.Certificate) ([]byte, erro
 	// matches the serialized output exactly.
 	doc.Indent(2)
 
-	// DigestValue = SHA-256( C14N(exclusive) of Body )
-	bodyC14N, err := exclusiveC14N(body)
-	if err != nil {
-		return nil, fmt.Errorf("c14n body: %w", err)
+	// DigestValue = digest( C14N(exclusive) of each referenced element ).
+	// Canonicalize in document context, as the receiver does: inclusive
+	// prefixes pull in namespaces declared on ancestors.
+	prefixList := opts.prefixList()
+	for _, ref := range refs {
+		c14n, err := canonicalize(withInheritedNamespaces(ref.target), prefixList)
+		if err != nil {
+			return nil, fmt.Errorf("c14n %s: %w", ref.target.Tag, err)
+		}
+		h := digestHash.New()
+		h.Write(c14n)
+		ref.digestValue.SetText(base64.StdEncoding.EncodeToString(h.Sum(nil)))
 	}
-	dv.SetText(base64.StdEncoding.EncodeToString(sha256Sum(bodyC14N)))
 
-	// SignatureValue = RSA-SHA256( C14N(exclusive) of SignedInfo )
-	signedInfoC14N, err := exclusiveC14N(signedInfo)
+	// SignatureValue = sign( C14N(exclusive) of SignedInfo )
+	signedInfoC14N, err := canonicalize(withInheritedNamespaces(signedInfo), prefixList)
 	if err != nil {
 		return nil, fmt.Errorf("c14n signedInfo: %w", err)
 	}
-	hashed := sha256Sum(signedInfoC14N)
-	signature, err := rsa.SignPKCS1v15(nil, privKey, crypto.SHA256, hashed)
+	signature, err := method.sign(signer, signedInfoC14N)
 	if err != nil {
-		return nil, fmt.Errorf("rsa sign: %w", err)
+		return nil, fmt.Errorf("sign: %w", err)
 	}
 	sv.SetText(base64.StdEncoding.EncodeToString(signature))
 
@@ -171,6 +199,42 @@ func signSOAPEnvelope(unsignedXML []byte, tlsCert tls.Certificate) ([]byte, erro
 	return out.Bytes(), nil
 }
 
+// timestampLayout is the xsd:dateTime format used for wsu:Created and wsu:Expires.
+const timestampLayout = "2006-01-02T15:04:05.000Z"
+
+// c14nMethodElement returns a CanonicalizationMethod or Transform element
+// for exclusive C14N with an optional InclusiveNamespaces prefix list.
+func c14nMethodElement(tag string, prefixes []string) *etree.Element {
+	el := etree.NewElement(tag)
+	el.CreateAttr("Algorithm", algExcC14N)
+	if len(prefixes) > 0 {
+		inc := el.CreateElement("ec:InclusiveNamespaces")
+		ensureXMLNS(inc, "ec", algExcC14N)
+		inc.CreateAttr("PrefixList", strings.Join(prefixes, " "))
+	}
+	return el
+}
+
+// addReference appends a ds:Reference to the element with the given
+// wsu:Id and returns its (empty) ds:DigestValue.
+func addReference(signedInfo *etree.Element, id string, opts SigningOptions) *etree.Element {
+	ref := etree.NewElement("ds:Reference")
+	ref.CreateAttr("URI", "#"+id)
+	signedInfo.AddChild(ref)
+
+	transforms := etree.NewElement("ds:Transforms")
+	ref.AddChild(transforms)
+	transforms.AddChild(c14nMethodElement("ds:Transform", opts.InclusivePrefixes))
+
+	dm := etree.NewElement("ds:DigestMethod")
+	dm.CreateAttr("Algorithm", string(opts.digestAlgorithm()))
+	ref.AddChild(dm)
+
+	dv := etree.NewElement("ds:DigestValue")
+	ref.AddChild(dv)
+	return dv
+}
+
 // ============================================
 // XML helpers
 // ============================================
@@ -214,13 +278,9 @@ func leafCertFromTLS(cert tls.Certificate) (*x509.Certificate, error) {
 	return leaf, nil
 }
 
-func exclusiveC14N(node *etree.Element) ([]byte, error) {
-	canon := dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+// canonicalize applies exclusive C14N with an InclusiveNamespaces prefix
+// list (space separated, may be empty).
+func canonicalize(node *etree.Element, prefixList string) ([]byte, error) {
+	canon := dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList(prefixList)
 	return canon.Canonicalize(node)
 }
-
-func sha256Sum(data []byte) []byte {
-	h := crypto.SHA256.New()
-	h.Write(data)
-	return h.Sum(nil)
-}
@@ -0,0 +1,379 @@
+package cybersource_soap_dm
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// errFastPathUnsupported is returned by signRequestMessage when the marshalled
+// request contains XML the streaming canonicalizer does not handle; callers
+// fall back to signSOAPEnvelope.
+var errFastPathUnsupported = errors.New("request not supported by streaming signer")
+
+var (
+	bufferPool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+	digestPool = sync.Pool{New: func() any { return bufio.NewWriterSize(io.Discard, 4096) }}
+)
+
+func getBuffer() *bytes.Buffer {
+	b := bufferPool.Get().(*bytes.Buffer)
+	b.Reset()
+	return b
+}
+
+func putBuffer(b *bytes.Buffer) {
+	// Don't keep unusually large buffers alive.
+	if b.Cap() <= 64<<10 {
+		bufferPool.Put(b)
+	}
+}
+
+// signRequestMessage builds and signs the SOAP envelope for msg without
+// building a DOM, for RSA keys and default SigningOptions; the client uses
+// it only when SigningOptions.Streaming is set. It produces output
+// byte-identical to marshalling the envelope with xml.MarshalIndent and
+// passing it to signSOAPEnvelope (see TestSignFastMatchesDOM): the Body is
+// written once in its serialized form while its exclusive canonical form
+// is streamed into the SHA-256 digest, and the fixed SignedInfo is
+// canonicalized from a template.
+func signRequestMessage(msg requestMessage, tlsCert tls.Certificate) ([]byte, error) {
+	leaf, err := leafCertFromTLS(tlsCert)
+	if err != nil {
+		return nil, err
+	}
+	privKey, ok := tlsCert.PrivateKey.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errFastPathUnsupported
+	}
+
+	raw := getBuffer()
+	defer putBuffer(raw)
+	enc := xml.NewEncoder(raw)
+	if err := enc.EncodeElement(msg, xml.StartElement{Name: xml.Name{Local: "ns1:requestMessage"}}); err != nil {
+		return nil, fmt.Errorf("marshal request message: %w", err)
+	}
+
+	body := getBuffer()
+	defer putBuffer(body)
+	h := sha256.New()
+	canon := digestPool.Get().(*bufio.Writer)
+	canon.Reset(h)
+	defer digestPool.Put(canon)
+
+	e := c14nEmitter{out: body, canon: canon}
+	bodyStart := `<SOAP-ENV:Body xmlns:SOAP-ENV="` + soapNS + `" xmlns:wsu="` + wsuNS + `" wsu:Id="Body">`
+	e.both(bodyStart)
+	if err := e.emit(xml.NewDecoder(bytes.NewReader(raw.Bytes()))); err != nil {
+		return nil, err
+	}
+	e.both("\n  </SOAP-ENV:Body>")
+	if err := canon.Flush(); err != nil {
+		return nil, fmt.Errorf("digest body: %w", err)
+	}
+	digest := base64.StdEncoding.EncodeToString(h.Sum(nil))
+
+	hashed := sha256.Sum256([]byte(canonicalSignedInfo(digest)))
+	signature, err := rsa.SignPKCS1v15(nil, privKey, crypto.SHA256, hashed[:])
+	if err != nil {
+		return nil, fmt.Errorf("rsa sign: %w", err)
+	}
+
+	token := base64.StdEncoding.EncodeToString(leaf.Raw)
+	sigValue := base64.StdEncoding.EncodeToString(signature)
+
+	var out bytes.Buffer
+	out.Grow(body.Len() + len(token) + len(sigValue) + 2048)
+	out.WriteString(xml.Header)
+	out.WriteString(`<SOAP-ENV:Envelope xmlns:SOAP-ENV="` + soapNS + `" xmlns:ns1="` + cybsNS + `">
+  <SOAP-ENV:Header>
+    <wsse:Security xmlns:wsse="` + wsseNS + `">
+      <wsse:BinarySecurityToken xmlns:wsu="` + wsuNS + `" ValueType="` + valueTypeX509v3 + `" EncodingType="` + encodingTypeBase64 + `" wsu:Id="X509Token">`)
+	out.WriteString(token)
+	out.WriteString(`</wsse:BinarySecurityToken>
+      <ds:Signature xmlns:ds="` + dsNS + `">
+        <ds:SignedInfo xmlns:ds="` + dsNS + `">
+          <ds:CanonicalizationMethod Algorithm="` + algExcC14N + `"/>
+          <ds:SignatureMethod Algorithm="` + algRsaSha256 + `"/>
+          <ds:Reference URI="#Body">
+            <ds:Transforms>
+              <ds:Transform Algorithm="` + algExcC14N + `"/>
+            </ds:Transforms>
+            <ds:DigestMethod Algorithm="` + algSha256 + `"/>
+            <ds:DigestValue>`)
+	out.WriteString(digest)
+	out.WriteString(`</ds:DigestValue>
+          </ds:Reference>
+        </ds:SignedInfo>
+        <ds:SignatureValue>`)
+	out.WriteString(sigValue)
+	out.WriteString(`</ds:SignatureValue>
+        <ds:KeyInfo>
+          <wsse:SecurityTokenReference>
+            <wsse:Reference URI="#X509Token"/>
+          </wsse:SecurityTokenReference>
+        </ds:KeyInfo>
+      </ds:Signature>
+    </wsse:Security>
+  </SOAP-ENV:Header>
+  `)
+	out.Write(body.Bytes())
+	out.WriteString("\n</SOAP-ENV:Envelope>\n")
+	return out.Bytes(), nil
+}
+
+// canonicalSignedInfo returns the exclusive canonical form of the
+// ds:SignedInfo written by signRequestMessage and signSOAPEnvelope.
+func canonicalSignedInfo(digest string) string {
+	return `<ds:SignedInfo xmlns:ds="` + dsNS + `">
+          <ds:CanonicalizationMethod Algorithm="` + algExcC14N + `"></ds:CanonicalizationMethod>
+          <ds:SignatureMethod Algorithm="` + algRsaSha256 + `"></ds:SignatureMethod>
+          <ds:Reference URI="#Body">
+            <ds:Transforms>
+              <ds:Transform Algorithm="` + algExcC14N + `"></ds:Transform>
+            </ds:Transforms>
+            <ds:DigestMethod Algorithm="` + algSha256 + `"></ds:DigestMethod>
+            <ds:DigestValue>` + digest + `</ds:DigestValue>
+          </ds:Reference>
+        </ds:SignedInfo>`
+}
+
+// c14nEmitter writes an element tree twice in one pass: in the indented
+// form etree produces with Indent(2), and in exclusive canonical form.
+type c14nEmitter struct {
+	out   *bytes.Buffer
+	canon *bufio.Writer
+	stack []c14nFrame
+}
+
+type c14nFrame struct {
+	name     string
+	open     bool // start tag written without its closing '>'
+	hasChild bool
+	hasText  bool
+}
+
+// bodyDepth is the indentation depth of requestMessage (Envelope > Body > requestMessage).
+const bodyDepth = 2
+
+func (e *c14nEmitter) both(s string) {
+	e.out.WriteString(s)
+	e.canon.WriteString(s)
+}
+
+func (e *c14nEmitter) indent(depth int) {
+	e.both("\n")
+	for i := 0; i < depth; i++ {
+		e.both("  ")
+	}
+}
+
+func (e *c14nEmitter) closeStartTag() {
+	if n := len(e.stack); n > 0 && e.stack[n-1].open {
+		e.both(">")
+		e.stack[n-1].open = false
+	}
+}
+
+func (e *c14nEmitter) emit(dec *xml.Decoder) error {
+	for {
+		tok, err := dec.RawToken()
+		if err == io.EOF {
+			if len(e.stack) != 0 {
+				return fmt.Errorf("unexpected end of request XML")
+			}
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("tokenize request XML: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if n := len(e.stack); n > 0 {
+				if e.stack[n-1].hasText {
+					return errFastPathUnsupported
+				}
+				e.closeStartTag()
+				e.stack[n-1].hasChild = true
+			}
+			attrs := t.Attr
+			if len(e.stack) == 0 {
+				// Same as ensureXMLNS(rm, "ns1", cybsNS) in signSOAPEnvelope.
+				attrs = append(slices.Clone(attrs), xml.Attr{Name: xml.Name{Space: "xmlns", Local: "ns1"}, Value: cybsNS})
+			}
+			if err := e.startElement(qualifiedName(t.Name), attrs, bodyDepth+len(e.stack)); err != nil {
+				return err
+			}
+
+		case xml.CharData:
+			text := string(t)
+			if isWhitespaceText(text) {
+				// etree's Indent drops whitespace-only text.
+				continue
+			}
+			n := len(e.stack)
+			if n == 0 || e.stack[n-1].hasChild {
+				return errFastPathUnsupported
+			}
+			e.closeStartTag()
+			e.stack[n-1].hasText = true
+			writeEscaped(e.out, text, escNormal)
+			writeEscaped(e.canon, text, escCanonicalText)
+
+		case xml.EndElement:
+			f := e.stack[len(e.stack)-1]
+			e.stack = e.stack[:len(e.stack)-1]
+			switch {
+			case f.open:
+				e.out.WriteString("/>")
+				e.canon.WriteString("></" + f.name + ">")
+			case f.hasChild:
+				e.indent(bodyDepth + len(e.stack))
+				e.both("</" + f.name + ">")
+			default:
+				e.both("</" + f.name + ">")
+			}
+
+		default:
+			return errFastPathUnsupported
+		}
+	}
+}
+
+func (e *c14nEmitter) startElement(name string, attrs []xml.Attr, depth int) error {
+	e.indent(depth)
+	e.both("<" + name)
+
+	// Serialized form keeps document order.
+	for _, a := range attrs {
+		e.out.WriteString(" " + qualifiedName(a.Name) + `="`)
+		writeEscaped(e.out, a.Value, escNormal)
+		e.out.WriteByte('"')
+	}
+
+	// Canonical form: namespace declarations sorted by prefix, then
+	// attributes sorted by name. Only unprefixed attributes occur in
+	// requestMessage, so namespace URIs never affect the order.
+	var nsDecls, plain []xml.Attr
+	for _, a := range attrs {
+		switch a.Name.Space {
+		case "xmlns":
+			nsDecls = append(nsDecls, a)
+		case "":
+			plain = append(plain, a)
+		default:
+			return errFastPathUnsupported
+		}
+	}
+	byLocal := func(a, b xml.Attr) int { return strings.Compare(a.Name.Local, b.Name.Local) }
+	slices.SortFunc(nsDecls, byLocal)
+	slices.SortFunc(plain, byLocal)
+	for _, a := range append(nsDecls, plain...) {
+		e.canon.WriteString(" " + qualifiedName(a.Name) + `="`)
+		writeEscaped(e.canon, a.Value, escCanonicalAttr)
+		e.canon.WriteByte('"')
+	}
+
+	e.stack = append(e.stack, c14nFrame{name: name, open: true})
+	return nil
+}
+
+func qualifiedName(n xml.Name) string {
+	if n.Space == "" {
+		return n.Local
+	}
+	return n.Space + ":" + n.Local
+}
+
+func isWhitespaceText(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+			return false
+		}
+	}
+	return true
+}
+
+type escapeMode int
+
+const (
+	escNormal escapeMode = iota
+	escCanonicalText
+	escCanonicalAttr
+)
+
+// writeEscaped escapes s the way etree serializes it: escNormal for the
+// document, escCanonicalText and escCanonicalAttr for C14N output.
+func writeEscaped(w io.StringWriter, s string, m escapeMode) {
+	last := 0
+	for i := 0; i < len(s); {
+		r, width := utf8.DecodeRuneInString(s[i:])
+		i += width
+		var esc string
+		switch r {
+		case '&':
+			esc = "&amp;"
+		case '<':
+			esc = "&lt;"
+		case '>':
+			if m == escCanonicalAttr {
+				continue
+			}
+			esc = "&gt;"
+		case '\'':
+			if m != escNormal {
+				continue
+			}
+			esc = "&apos;"
+		case '"':
+			if m == escCanonicalText {
+				continue
+			}
+			esc = "&quot;"
+		case '\t':
+			if m != escCanonicalAttr {
+				continue
+			}
+			esc = "&#x9;"
+		case '\n':
+			if m != escCanonicalAttr {
+				continue
+			}
+			esc = "&#xA;"
+		case '\r':
+			if m == escNormal {
+				continue
+			}
+			esc = "&#xD;"
+		default:
+			if isXMLChar(r) && !(r == utf8.RuneError && width == 1) {
+				continue
+			}
+			esc = "�"
+		}
+		w.WriteString(s[last : i-width])
+		w.WriteString(esc)
+		last = i
+	}
+	w.WriteString(s[last:])
+}
+
+func isXMLChar(r rune) bool {
+	return r == 0x09 || r == 0x0A || r == 0x0D ||
+		r >= 0x20 && r <= 0xD7FF ||
+		r >= 0xE000 && r <= 0xFFFD ||
+		r >= 0x10000 && r <= 0x10FFFF
+}
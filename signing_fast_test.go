@@ -0,0 +1,74 @@
+package cybersource_soap_dm
+
+import (
+	"bytes"
+	"testing"
+)
+
+// TestSignFastMatchesDOM signs the same requests with the streaming signer
+// and the DOM signer. Default options use fixed IDs, no timestamp and a
+// deterministic RSA PKCS #1 v1.5 signature, so the outputs must be equal.
+func TestSignFastMatchesDOM(t *testing.T) {
+	c := newTestClient(t, Config{})
+	for _, f := range requestFixtures() {
+		t.Run(f.name, func(t *testing.T) {
+			env := buildTestEnvelope(t, c, f.req)
+			fast, err := signRequestMessage(env.Body.RequestMessage, c.tlsCert)
+			if err != nil {
+				t.Fatal(err)
+			}
+			unsigned, err := marshalEnvelope(env)
+			if err != nil {
+				t.Fatal(err)
+			}
+			dom, err := signSOAPEnvelope(unsigned, c.tlsCert, SigningOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(fast, dom) {
+				t.Errorf("streaming and DOM signers differ:\n%s", lineDiff(string(dom), string(fast)))
+			}
+		})
+	}
+}
+
+func TestSignStreamingIsOptIn(t *testing.T) {
+	req := testRequest("streaming-1")
+	dom, err := newTestClient(t, Config{}).BuildSignedRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	streaming, err := newTestClient(t, Config{Signing: SigningOptions{Streaming: true}}).BuildSignedRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(dom, streaming) {
+		t.Errorf("Streaming changed the signed envelope:\n%s", lineDiff(string(dom), string(streaming)))
+	}
+}
+
+func benchmarkSign(b *testing.B, streaming bool) {
+	c := newTestClient(b, Config{})
+	env := buildTestEnvelope(b, c, requestFixtures()[4].req) // items
+	msg := env.Body.RequestMessage
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var err error
+		if streaming {
+			_, err = signRequestMessage(msg, c.tlsCert)
+		} else {
+			var unsigned []byte
+			if unsigned, err = marshalEnvelope(env); err == nil {
+				_, err = signSOAPEnvelope(unsigned, c.tlsCert, SigningOptions{})
+			}
+		}
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSignFast(b *testing.B) { benchmarkSign(b, true) }
+
+func BenchmarkSignDOM(b *testing.B) { benchmarkSign(b, false) }
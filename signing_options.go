@@ -0,0 +1,264 @@
+package cybersource_soap_dm
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// SignatureAlgorithm is an XML-DSig SignatureMethod algorithm URI.
+type SignatureAlgorithm string
+
+const (
+	SignatureRSASHA256    SignatureAlgorithm = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	SignatureRSASHA512    SignatureAlgorithm = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha512"
+	SignatureRSAPSSSHA256 SignatureAlgorithm = "http://www.w3.org/2007/05/xmldsig-more#sha256-rsa-MGF1"
+	SignatureRSAPSSSHA512 SignatureAlgorithm = "http://www.w3.org/2007/05/xmldsig-more#sha512-rsa-MGF1"
+	SignatureECDSASHA256  SignatureAlgorithm = "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha256"
+	SignatureECDSASHA384  SignatureAlgorithm = "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha384"
+)
+
+// DigestAlgorithm is an XML-DSig DigestMethod algorithm URI.
+type DigestAlgorithm string
+
+const (
+	DigestSHA256 DigestAlgorithm = "http://www.w3.org/2001/04/xmlenc#sha256"
+	DigestSHA512 DigestAlgorithm = "http://www.w3.org/2001/04/xmlenc#sha512"
+)
+
+// SigningOptions configures the WS-Security signature. The zero value signs
+// with exclusive C14N, SHA-256 digests, the signature algorithm matching the
+// key (RSA-SHA256 for RSA keys) and the fixed IDs "Body" and "X509Token".
+type SigningOptions struct {
+	// SignatureAlgorithm selects the signature method. Empty means
+	// RSA-SHA256 for RSA keys, ECDSA-SHA256 for P-256 keys and
+	// ECDSA-SHA384 for P-384 keys.
+	SignatureAlgorithm SignatureAlgorithm
+
+	// DigestAlgorithm selects the reference digest. Empty means DigestSHA256.
+	DigestAlgorithm DigestAlgorithm
+
+	// InclusivePrefixes is the InclusiveNamespaces PrefixList used for
+	// every exclusive C14N transform, e.g. []string{"SOAP-ENV"}.
+	InclusivePrefixes []string
+
+	// TimestampTTL adds a signed wsu:Timestamp whose Expires is Created
+	// plus TimestampTTL. Zero omits the timestamp.
+	TimestampTTL time.Duration
+
+	// RandomIDs gives the Body, BinarySecurityToken and Timestamp random
+	// wsu:Id values per request, so IDs do not collide when envelopes are
+	// aggregated into one document.
+	RandomIDs bool
+
+	// Streaming signs with the streaming signer, which canonicalizes and
+	// digests the Body in one pass instead of building a DOM. It produces
+	// the same bytes as the DOM signer and applies only to RSA keys with
+	// every other option at its default; other requests use the DOM
+	// signer. It is off by default.
+	Streaming bool
+}
+
+// isZero reports whether no option is set.
+func (o SigningOptions) isZero() bool {
+	return o.SignatureAlgorithm == "" && o.DigestAlgorithm == "" && len(o.InclusivePrefixes) == 0 &&
+		o.TimestampTTL == 0 && !o.RandomIDs && !o.Streaming
+}
+
+// isDefault reports whether the options leave every setting that affects
+// the signed bytes at the behaviour of the zero value for an RSA key.
+func (o SigningOptions) isDefault() bool {
+	return (o.SignatureAlgorithm == "" || o.SignatureAlgorithm == SignatureRSASHA256) &&
+		(o.DigestAlgorithm == "" || o.DigestAlgorithm == DigestSHA256) &&
+		len(o.InclusivePrefixes) == 0 && o.TimestampTTL == 0 && !o.RandomIDs
+}
+
+// Validate checks the options against the signing key's public key.
+func (o SigningOptions) Validate(pub crypto.PublicKey) error {
+	if _, err := o.digestHash(); err != nil {
+		return err
+	}
+	if _, err := o.signatureMethod(pub); err != nil {
+		return err
+	}
+	if o.TimestampTTL < 0 {
+		return fmt.Errorf("negative TimestampTTL")
+	}
+	for _, p := range o.InclusivePrefixes {
+		if p == "" || strings.ContainsAny(p, " \t\r\n:") {
+			return fmt.Errorf("invalid inclusive namespace prefix %q", p)
+		}
+	}
+	return nil
+}
+
+func (o SigningOptions) digestAlgorithm() DigestAlgorithm {
+	if o.DigestAlgorithm == "" {
+		return DigestSHA256
+	}
+	return o.DigestAlgorithm
+}
+
+func (o SigningOptions) digestHash() (crypto.Hash, error) {
+	switch o.digestAlgorithm() {
+	case DigestSHA256:
+		return crypto.SHA256, nil
+	case DigestSHA512:
+		return crypto.SHA512, nil
+	}
+	return 0, fmt.Errorf("unsupported digest algorithm %q", o.DigestAlgorithm)
+}
+
+func (o SigningOptions) prefixList() string {
+	return strings.Join(o.InclusivePrefixes, " ")
+}
+
+// signatureMethod resolves the signature algorithm for a public key.
+func (o SigningOptions) signatureMethod(pub crypto.PublicKey) (signatureMethod, error) {
+	alg := o.SignatureAlgorithm
+	if alg == "" {
+		alg = defaultSignatureAlgorithm(pub)
+	}
+	m, ok := signatureMethods[alg]
+	if !ok {
+		return signatureMethod{}, fmt.Errorf("unsupported signature algorithm %q", alg)
+	}
+	if err := m.checkKey(pub); err != nil {
+		return signatureMethod{}, fmt.Errorf("signature algorithm %s: %w", alg, err)
+	}
+	return m, nil
+}
+
+func defaultSignatureAlgorithm(pub crypto.PublicKey) SignatureAlgorithm {
+	if k, ok := pub.(*ecdsa.PublicKey); ok && k.Curve == elliptic.P384() {
+		return SignatureECDSASHA384
+	}
+	if _, ok := pub.(*ecdsa.PublicKey); ok {
+		return SignatureECDSASHA256
+	}
+	return SignatureRSASHA256
+}
+
+// signatureMethod describes how to produce and check a SignatureValue.
+type signatureMethod struct {
+	uri   SignatureAlgorithm
+	hash  crypto.Hash
+	pss   bool
+	curve elliptic.Curve // nil for RSA
+}
+
+var signatureMethods = map[SignatureAlgorithm]signatureMethod{
+	SignatureRSASHA256:    {uri: SignatureRSASHA256, hash: crypto.SHA256},
+	SignatureRSASHA512:    {uri: SignatureRSASHA512, hash: crypto.SHA512},
+	SignatureRSAPSSSHA256: {uri: SignatureRSAPSSSHA256, hash: crypto.SHA256, pss: true},
+	SignatureRSAPSSSHA512: {uri: SignatureRSAPSSSHA512, hash: crypto.SHA512, pss: true},
+	SignatureECDSASHA256:  {uri: SignatureECDSASHA256, hash: crypto.SHA256, curve: elliptic.P256()},
+	SignatureECDSASHA384:  {uri: SignatureECDSASHA384, hash: crypto.SHA384, curve: elliptic.P384()},
+}
+
+func (m signatureMethod) checkKey(pub crypto.PublicKey) error {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		if m.curve != nil {
+			return fmt.Errorf("requires an ECDSA key, got RSA")
+		}
+	case *ecdsa.PublicKey:
+		if m.curve == nil {
+			return fmt.Errorf("requires an RSA key, got ECDSA")
+		}
+		if k.Curve != m.curve {
+			return fmt.Errorf("requires curve %s, got %s", m.curve.Params().Name, k.Curve.Params().Name)
+		}
+	default:
+		return fmt.Errorf("unsupported key type %T", pub)
+	}
+	return nil
+}
+
+func (m signatureMethod) signerOpts() crypto.SignerOpts {
+	if m.pss {
+		return &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: m.hash}
+	}
+	return m.hash
+}
+
+// sign signs the canonical SignedInfo. ECDSA signatures are encoded as the
+// fixed-size r||s concatenation XML-DSig requires.
+func (m signatureMethod) sign(key crypto.Signer, signedInfoC14N []byte) ([]byte, error) {
+	h := m.hash.New()
+	h.Write(signedInfoC14N)
+	sig, err := key.Sign(rand.Reader, h.Sum(nil), m.signerOpts())
+	if err != nil {
+		return nil, err
+	}
+	if m.curve == nil {
+		return sig, nil
+	}
+	var rs struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(sig, &rs); err != nil {
+		return nil, fmt.Errorf("decode ECDSA signature: %w", err)
+	}
+	size := (m.curve.Params().BitSize + 7) / 8
+	out := make([]byte, 2*size)
+	rs.R.FillBytes(out[:size])
+	rs.S.FillBytes(out[size:])
+	return out, nil
+}
+
+// verify checks a SignatureValue over the canonical SignedInfo.
+func (m signatureMethod) verify(pub crypto.PublicKey, signedInfoC14N, signature []byte) error {
+	if err := m.checkKey(pub); err != nil {
+		return err
+	}
+	h := m.hash.New()
+	h.Write(signedInfoC14N)
+	hashed := h.Sum(nil)
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		if m.pss {
+			return rsa.VerifyPSS(k, m.hash, hashed, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		}
+		return rsa.VerifyPKCS1v15(k, m.hash, hashed, signature)
+	case *ecdsa.PublicKey:
+		size := (m.curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return fmt.Errorf("ECDSA signature is %d bytes, want %d", len(signature), 2*size)
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(k, hashed, r, s) {
+			return fmt.Errorf("ECDSA signature mismatch")
+		}
+	}
+	return nil
+}
+
+// wsuIDs are the wsu:Id values of the signed elements.
+type wsuIDs struct {
+	body, token, timestamp string
+}
+
+func (o SigningOptions) newIDs() (wsuIDs, error) {
+	if !o.RandomIDs {
+		return wsuIDs{body: "Body", token: "X509Token", timestamp: "Timestamp"}, nil
+	}
+	var b [3][16]byte
+	for i := range b {
+		if _, err := rand.Read(b[i][:]); err != nil {
+			return wsuIDs{}, fmt.Errorf("generate wsu:Id: %w", err)
+		}
+	}
+	return wsuIDs{
+		body:      "Body-" + hex.EncodeToString(b[0][:]),
+		token:     "X509-" + hex.EncodeToString(b[1][:]),
+		timestamp: "TS-" + hex.EncodeToString(b[2][:]),
+	}, nil
+}
@@ -23,18 +23,22 @@ type soapBody struct {
 }
 
 type requestMessage struct {
-	MerchantID            string          `xml:"ns1:merchantID"`
-	MerchantReferenceCode string          `xml:"ns1:merchantReferenceCode"`
-	ClientLibrary         string          `xml:"ns1:clientLibrary"`
-	ClientLibraryVersion  string          `xml:"ns1:clientLibraryVersion"`
-	ClientEnvironment     string          `xml:"ns1:clientEnvironment,omitempty"`
-	BillTo                *soapBillTo     `xml:"ns1:billTo,omitempty"`
-	Items                 []soapItem      `xml:"ns1:item,omitempty"`
-	PurchaseTotals        *soapPurchase   `xml:"ns1:purchaseTotals,omitempty"`
-	Card                  *soapCard       `xml:"ns1:card,omitempty"`
-	MerchantDefinedData   *soapMDD        `xml:"ns1:merchantDefinedData,omitempty"`
-	AFSService            *soapAFSService `xml:"ns1:afsService,omitempty"`
-	DeviceFingerprintID   string          `xml:"ns1:deviceFingerprintID,omitempty"`
+	MerchantID            string               `xml:"ns1:merchantID"`
+	MerchantReferenceCode string               `xml:"ns1:merchantReferenceCode"`
+	ClientLibrary         string               `xml:"ns1:clientLibrary"`
+	ClientLibraryVersion  string               `xml:"ns1:clientLibraryVersion"`
+	ClientEnvironment     string               `xml:"ns1:clientEnvironment,omitempty"`
+	BillTo                *soapBillTo          `xml:"ns1:billTo,omitempty"`
+	Items                 []soapItem           `xml:"ns1:item,omitempty"`
+	PurchaseTotals        *soapPurchase        `xml:"ns1:purchaseTotals,omitempty"`
+	Card                  *soapCard            `xml:"ns1:card,omitempty"`
+	Check                 *soapCheck           `xml:"ns1:check,omitempty"`
+	DecisionManager       *soapDecisionManager `xml:"ns1:decisionManager,omitempty"`
+	PayPal                *soapPayPal          `xml:"ns1:paypal,omitempty"`
+	MerchantDefinedData   *soapMDD             `xml:"ns1:merchantDefinedData,omitempty"`
+	AFSService            *soapAFSService      `xml:"ns1:afsService,omitempty"`
+	DeviceFingerprintID   string               `xml:"ns1:deviceFingerprintID,omitempty"`
+	GiftCard              *soapGiftCard        `xml:"ns1:giftCard,omitempty"`
 }
 
 type soapBillTo struct {
@@ -59,14 +63,50 @@ type soapCard struct {
 	Bin             string `xml:"ns1:bin,omitempty"`
 }
 
+type soapDecisionManager struct {
+	Profile string `xml:"ns1:profile,omitempty"`
+}
+
+type soapCheck struct {
+	AccountNumber     string `xml:"ns1:accountNumber"`
+	AccountType       string `xml:"ns1:accountType"`
+	BankTransitNumber string `xml:"ns1:bankTransitNumber"`
+	CheckNumber       string `xml:"ns1:checkNumber,omitempty"`
+	SecCode           string `xml:"ns1:secCode,omitempty"`
+}
+
+type soapPayPal struct {
+	PayerID     string `xml:"ns1:payerID,omitempty"`
+	PayerEmail  string `xml:"ns1:payerEmail,omitempty"`
+	PayerStatus string `xml:"ns1:payerStatus,omitempty"`
+}
+
+type soapGiftCard struct {
+	AccountNumber   string `xml:"ns1:accountNumber"`
+	ExpirationMonth string `xml:"ns1:expirationMonth,omitempty"`
+	ExpirationYear  string `xml:"ns1:expirationYear,omitempty"`
+}
+
+// soapItem fields follow the element order of the Item type in the
+// transaction-data schema.
 type soapItem struct {
-	XMLName     xml.Name `xml:"ns1:item"`
-	ID          int      `xml:"id,attr"`
-	UnitPrice   string   `xml:"ns1:unitPrice"`
-	Quantity    int      `xml:"ns1:quantity"`
-	ProductCode string   `xml:"ns1:productCode,omitempty"`
-	ProductName string   `xml:"ns1:productName"`
-	ProductSKU  string   `xml:"ns1:productSKU,omitempty"`
+	XMLName          xml.Name `xml:"ns1:item"`
+	ID               int      `xml:"id,attr"`
+	UnitPrice        string   `xml:"ns1:unitPrice"`
+	Quantity         int      `xml:"ns1:quantity"`
+	ProductCode      string   `xml:"ns1:productCode,omitempty"`
+	ProductName      string   `xml:"ns1:productName"`
+	ProductSKU       string   `xml:"ns1:productSKU,omitempty"`
+	ProductRisk      string   `xml:"ns1:productRisk,omitempty"`
+	TaxAmount        string   `xml:"ns1:taxAmount,omitempty"`
+	GiftCategory     string   `xml:"ns1:giftCategory,omitempty"`
+	TimeCategory     string   `xml:"ns1:timeCategory,omitempty"`
+	HostHedge        string   `xml:"ns1:hostHedge,omitempty"`
+	TimeHedge        string   `xml:"ns1:timeHedge,omitempty"`
+	VelocityHedge    string   `xml:"ns1:velocityHedge,omitempty"`
+	NonsensicalHedge string   `xml:"ns1:nonsensicalHedge,omitempty"`
+	TotalAmount      string   `xml:"ns1:totalAmount,omitempty"`
+	DiscountAmount   string   `xml:"ns1:discountAmount,omitempty"`
 }
 
 type soapPurchase struct {
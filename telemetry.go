@@ -0,0 +1,193 @@
+package cybersource_soap_dm
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/hugochinchilla79/cybersource_soap_dm/models"
+)
+
+// Span names used by the client.
+const (
+	SpanAnalyzeRisk = "cybersource_soap_dm.AnalyzeRisk"
+	SpanBuild       = "cybersource_soap_dm.build"
+	SpanSign        = "cybersource_soap_dm.sign"
+	SpanHTTP        = "cybersource_soap_dm.http"
+	SpanParse       = "cybersource_soap_dm.parse"
+)
+
+// Span attribute keys set by the client. Values never contain PII.
+const (
+	AttrDecision   = "cybersource.decision"
+	AttrReasonCode = "cybersource.reason_code"
+	AttrRequestID  = "cybersource.request_id"
+	AttrFaultCode  = "cybersource.fault_code"
+	AttrFallback   = "cybersource.fallback"
+	AttrEndpoint   = "cybersource.endpoint"
+	AttrHTTPStatus = "http.response.status_code"
+)
+
+// Telemetry receives traces and measurements from the client. It keeps the
+// core package free of any tracing or metrics dependency; see the cybsotel
+// and cybsprom packages for implementations. Implementations must be safe
+// for concurrent use.
+type Telemetry interface {
+	// StartSpan starts a span as a child of any span in ctx.
+	StartSpan(ctx context.Context, name string) (context.Context, Span)
+
+	// RecordCall is called once per AnalyzeRisk call when it completes.
+	RecordCall(ctx context.Context, stats CallStats)
+
+	// RecordRetry is called when a request is retried on another endpoint
+	// after a connection failure.
+	RecordRetry(ctx context.Context, endpoint string)
+}
+
+// Span is a unit of traced work.
+type Span interface {
+	// SetAttribute sets a string, int or bool attribute.
+	SetAttribute(key string, value any)
+
+	// RecordError marks the span as failed.
+	RecordError(err error)
+
+	// End completes the span.
+	End()
+}
+
+// CallStats describes a completed AnalyzeRisk call.
+type CallStats struct {
+	Duration   time.Duration
+	Decision   string
+	ReasonCode int
+	RequestID  string
+	HTTPStatus int
+	Endpoint   string
+
+	// FaultCode is set when CyberSource returned a SOAP fault.
+	FaultCode string
+
+	// Fallback is true when the decision came from the circuit breaker.
+	Fallback bool
+
+	// Err is the error returned by AnalyzeRisk, if any.
+	Err error
+}
+
+func newCallStats(resp models.RiskAnalysisAPIResponse, err error, d time.Duration) CallStats {
+	stats := CallStats{
+		Duration:   d,
+		Decision:   resp.Data.Decision,
+		ReasonCode: resp.Data.ReasonCode,
+		RequestID:  resp.Data.RequestID,
+		HTTPStatus: resp.HTTPStatus,
+		Endpoint:   resp.Endpoint,
+		Fallback:   resp.Data.Fallback,
+		Err:        err,
+	}
+	var fault *SOAPFault
+	if errors.As(err, &fault) {
+		stats.FaultCode = fault.FaultCode
+	}
+	return stats
+}
+
+func (s CallStats) annotate(span Span) {
+	if s.Decision != "" {
+		span.SetAttribute(AttrDecision, s.Decision)
+		span.SetAttribute(AttrReasonCode, s.ReasonCode)
+	}
+	if s.RequestID != "" {
+		span.SetAttribute(AttrRequestID, s.RequestID)
+	}
+	if s.HTTPStatus != 0 {
+		span.SetAttribute(AttrHTTPStatus, s.HTTPStatus)
+	}
+	if s.Endpoint != "" {
+		span.SetAttribute(AttrEndpoint, s.Endpoint)
+	}
+	if s.FaultCode != "" {
+		span.SetAttribute(AttrFaultCode, s.FaultCode)
+	}
+	if s.Fallback {
+		span.SetAttribute(AttrFallback, true)
+	}
+	if s.Err != nil {
+		span.RecordError(s.Err)
+	}
+}
+
+// endSpan records err, if any, and ends the span.
+func endSpan(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// MultiTelemetry fans traces and measurements out to several Telemetry
+// implementations, e.g. OpenTelemetry tracing plus Prometheus metrics.
+func MultiTelemetry(ts ...Telemetry) Telemetry {
+	return multiTelemetry(ts)
+}
+
+type multiTelemetry []Telemetry
+
+func (m multiTelemetry) StartSpan(ctx context.Context, name string) (context.Context, Span) {
+	spans := make(multiSpan, 0, len(m))
+	for _, t := range m {
+		var s Span
+		ctx, s = t.StartSpan(ctx, name)
+		spans = append(spans, s)
+	}
+	return ctx, spans
+}
+
+func (m multiTelemetry) RecordCall(ctx context.Context, stats CallStats) {
+	for _, t := range m {
+		t.RecordCall(ctx, stats)
+	}
+}
+
+func (m multiTelemetry) RecordRetry(ctx context.Context, endpoint string) {
+	for _, t := range m {
+		t.RecordRetry(ctx, endpoint)
+	}
+}
+
+type multiSpan []Span
+
+func (m multiSpan) SetAttribute(key string, value any) {
+	for _, s := range m {
+		s.SetAttribute(key, value)
+	}
+}
+
+func (m multiSpan) RecordError(err error) {
+	for _, s := range m {
+		s.RecordError(err)
+	}
+}
+
+func (m multiSpan) End() {
+	for _, s := range m {
+		s.End()
+	}
+}
+
+// NoopTelemetry discards all traces and measurements. Telemetry
+// implementations that only collect metrics can embed it for StartSpan.
+type NoopTelemetry struct{}
+
+func (NoopTelemetry) StartSpan(ctx context.Context, _ string) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+func (NoopTelemetry) RecordCall(context.Context, CallStats) {}
+func (NoopTelemetry) RecordRetry(context.Context, string)   {}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(string, any) {}
+func (noopSpan) RecordError(error)        {}
+func (noopSpan) End()                     {}
@@ -0,0 +1,52 @@
+package cybersource_soap_dm
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/beevik/etree"
+)
+
+const passwordTextType = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-username-token-profile-1.0#PasswordText"
+
+// addUsernameToken injects a wsse:Security header with a UsernameToken
+// carrying the merchant ID and transaction key (PasswordText), the
+// authentication CyberSource accepts instead of an X.509 signature.
+func addUsernameToken(unsignedXML []byte, merchantID, transactionKey string) ([]byte, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(unsignedXML); err != nil {
+		return nil, fmt.Errorf("parse soap xml: %w", err)
+	}
+
+	env := doc.Root()
+	if env == nil {
+		return nil, fmt.Errorf("soap envelope missing")
+	}
+	if findChild(env, "Body") == nil {
+		return nil, fmt.Errorf("soap Body not found")
+	}
+	header := findChild(env, "Header")
+	if header == nil {
+		header = etree.NewElement("SOAP-ENV:Header")
+		env.InsertChildAt(0, header)
+	}
+
+	security := etree.NewElement("wsse:Security")
+	ensureXMLNS(security, "wsse", wsseNS)
+	security.CreateAttr("SOAP-ENV:mustUnderstand", "1")
+	header.AddChild(security)
+
+	token := security.CreateElement("wsse:UsernameToken")
+	token.CreateElement("wsse:Username").SetText(merchantID)
+	password := token.CreateElement("wsse:Password")
+	password.CreateAttr("Type", passwordTextType)
+	password.SetText(transactionKey)
+
+	doc.Indent(2)
+
+	out := bytes.NewBuffer(nil)
+	if _, err := doc.WriteTo(out); err != nil {
+		return nil, fmt.Errorf("serialize soap xml: %w", err)
+	}
+	return out.Bytes(), nil
+}
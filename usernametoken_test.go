@@ -0,0 +1,75 @@
+package cybersource_soap_dm
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+func TestTransactionKeyEnvelope(t *testing.T) {
+	c := newTestClient(t, Config{MerchantID: "store_a", AuthMode: AuthTransactionKey, TransactionKey: "s3cret+key/=="})
+	signed, err := c.BuildSignedRequest(testRequest("key-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(signed); err != nil {
+		t.Fatal(err)
+	}
+	security := doc.FindElement("//Header/Security")
+	if security == nil || security.NamespaceURI() != wsseNS {
+		t.Fatalf("no wsse:Security header in\n%s", signed)
+	}
+	username := security.FindElement("UsernameToken/Username")
+	password := security.FindElement("UsernameToken/Password")
+	if username == nil || password == nil {
+		t.Fatalf("no UsernameToken with Username and Password in\n%s", signed)
+	}
+	if username.Text() != "store_a" {
+		t.Errorf("Username = %q, want the merchant ID", username.Text())
+	}
+	if password.Text() != "s3cret+key/==" {
+		t.Errorf("Password = %q, want the transaction key", password.Text())
+	}
+	if got := password.SelectAttrValue("Type", ""); got != passwordTextType {
+		t.Errorf("Password Type = %q, want PasswordText", got)
+	}
+	for _, name := range []string{"Signature", "BinarySecurityToken", "Timestamp"} {
+		if doc.FindElement("//"+name) != nil {
+			t.Errorf("transaction key envelope has a %s element", name)
+		}
+	}
+	if rm := requestMessageOf(t, signed); findChild(rm, "merchantID").Text() != "store_a" {
+		t.Error("requestMessage merchantID is not the merchant ID")
+	}
+}
+
+func TestValidateRejectsSigningWithTransactionKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		signing SigningOptions
+	}{
+		{"signature algorithm", SigningOptions{SignatureAlgorithm: SignatureRSASHA256}},
+		{"digest algorithm", SigningOptions{DigestAlgorithm: DigestSHA256}},
+		{"inclusive prefixes", SigningOptions{InclusivePrefixes: []string{"SOAP-ENV"}}},
+		{"timestamp", SigningOptions{TimestampTTL: time.Minute}},
+		{"random IDs", SigningOptions{RandomIDs: true}},
+		{"streaming", SigningOptions{Streaming: true}},
+	}
+	for _, tt := range tests {
+		cfg := Config{MerchantID: "store_a", AuthMode: AuthTransactionKey, TransactionKey: "key", Signing: tt.signing}
+		err := cfg.Validate()
+		var ce *ConfigError
+		if !errors.As(err, &ce) || !strings.Contains(err.Error(), "Signing must not be set") {
+			t.Errorf("%s: err = %v, want Signing rejected", tt.name, err)
+		}
+	}
+
+	if err := (Config{MerchantID: "store_a", AuthMode: AuthTransactionKey, TransactionKey: "key"}).Validate(); err != nil {
+		t.Errorf("zero Signing with a transaction key: %v", err)
+	}
+}
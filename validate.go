@@ -0,0 +1,80 @@
+package cybersource_soap_dm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hugochinchilla79/cybersource_soap_dm/devicefingerprint"
+	"github.com/hugochinchilla79/cybersource_soap_dm/models"
+)
+
+// validateRequest runs the client-side checks on a request before it is
+// built and signed. Failures are returned as *models.ValidationError. It
+// returns the merchant-defined data resolved against Config.MDDSchema,
+// which is what buildSOAPRequest sends.
+func (c *Client) validateRequest(req models.RiskAnalysisRequest) (map[int]string, error) {
+	merchantID, err := c.merchantIDFor(req)
+	if err != nil {
+		return nil, err
+	}
+	// A request without any payment data is still sent as-is; Decision
+	// Manager can screen on order and customer data alone.
+	paymentMethod, err := paymentMethodOf(req)
+	if err != nil {
+		return nil, err
+	}
+	if req.PaymentMethod != nil || req.Card.Number != "" {
+		if err := paymentMethod.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	for i, item := range req.Items {
+		if err := item.Validate(); err != nil {
+			var ve *models.ValidationError
+			if errors.As(err, &ve) {
+				ve.Field = fmt.Sprintf("item[%d].%s", i, ve.Field)
+			}
+			return nil, err
+		}
+	}
+	if err := req.ValidateAmounts(); err != nil {
+		return nil, err
+	}
+	mdd, err := c.cfg.MDDSchema.Resolve(req.MerchantDefinedFields, req.MerchantDefinedData)
+	if err != nil {
+		return nil, err
+	}
+	if id := req.DeviceFingerprintID; id != "" {
+		if err := devicefingerprint.ValidateSessionID(id); err != nil {
+			return nil, &models.ValidationError{Field: "deviceFingerprintID", Message: err.Error()}
+		}
+		// The merchant ID prefix belongs only in the profiling tag's
+		// session_id; sending it here means DM finds no device data. Only
+		// the exact form Profile.ProfilingSessionID builds from a
+		// NewSessionID is rejected, since a caller's own session ID may
+		// happen to start with the merchant ID characters.
+		if rest, ok := strings.CutPrefix(id, merchantID); ok && merchantID != "" && isGeneratedSessionID(rest) {
+			return nil, &models.ValidationError{Field: "deviceFingerprintID", Message: "must not include the merchant ID prefix used in the profiling tag"}
+		}
+	}
+	if c.cfg.StrictTotals {
+		if err := req.ValidateTotals(); err != nil {
+			return nil, err
+		}
+	}
+	return mdd, nil
+}
+
+// isGeneratedSessionID reports whether s has the form devicefingerprint.NewSessionID returns.
+func isGeneratedSessionID(s string) bool {
+	if len(s) != 32 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,30 @@
+package cybersource_soap_dm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/hugochinchilla79/cybersource_soap_dm/models"
+)
+
+func TestValidateDeviceFingerprintMerchantPrefix(t *testing.T) {
+	c := &Client{cfg: Config{MerchantID: "abc"}}
+	tests := []struct {
+		id      string
+		wantErr bool
+	}{
+		{"abcdef-session-1", false},
+		{"0123456789abcdef0123456789abcdef", false},
+		{"abc0123456789abcdef0123456789abcdef", true},
+	}
+	for _, tt := range tests {
+		_, err := c.validateRequest(models.RiskAnalysisRequest{
+			PurchaseTotals:      models.PurchaseTotals{Currency: "USD"},
+			DeviceFingerprintID: tt.id,
+		})
+		var ve *models.ValidationError
+		if got := errors.As(err, &ve) && ve.Field == "deviceFingerprintID"; got != tt.wantErr {
+			t.Errorf("DeviceFingerprintID %q: err = %v, want rejected %v", tt.id, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,375 @@
+package cybersource_soap_dm
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// VerificationReport is the result of checking a signed SOAP envelope.
+type VerificationReport struct {
+	// ReferenceURI is the ds:Reference URI of the signed element (e.g. "#Body").
+	ReferenceURI string
+
+	// EmbeddedDigest is the base64 ds:DigestValue found in the envelope.
+	EmbeddedDigest string
+
+	// ComputedDigest is the base64 digest of the referenced element,
+	// canonicalized in document context as signSOAPEnvelope and
+	// CyberSource do.
+	ComputedDigest string
+
+	// DigestMatch reports whether EmbeddedDigest equals ComputedDigest.
+	DigestMatch bool
+
+	// SignatureValid reports whether ds:SignatureValue verifies over the
+	// canonical SignedInfo with the BinarySecurityToken's public key.
+	SignatureValid bool
+
+	// SignatureError explains why SignatureValid is false.
+	SignatureError string
+
+	// Certificate is the X.509 certificate from the BinarySecurityToken.
+	Certificate *x509.Certificate
+
+	// CanonicalBody is the canonical form of the referenced element as a
+	// detached subtree, without namespaces inherited from its ancestors.
+	CanonicalBody string
+
+	// CanonicalBodyInContext is the canonical form of the referenced element
+	// with namespaces inherited from its ancestors, as a standalone
+	// exclusive C14N verifier computes it. ComputedDigest is taken over it.
+	CanonicalBodyInContext string
+
+	// CanonicalDiff is a line diff from CanonicalBody to
+	// CanonicalBodyInContext. It is empty when they are identical. The
+	// in-context form adds the namespace declarations the element inherits
+	// from its ancestors, so they differ when the element or a descendant
+	// uses a prefix declared only on an ancestor (such as wsu:Id on the
+	// Body), or when an inclusive prefix list names an inherited
+	// namespace. A digest over CanonicalBody, as releases before
+	// SigningOptions computed it, then differs from ComputedDigest.
+	CanonicalDiff string
+
+	// CanonicalizationError is set when the referenced element cannot be
+	// canonicalized on its own because it uses namespace prefixes declared
+	// only on its ancestors.
+	CanonicalizationError string
+
+	// CanonicalSignedInfo is the canonical form of ds:SignedInfo that the
+	// signature is computed over.
+	CanonicalSignedInfo string
+
+	// SignatureAlgorithm is the ds:SignatureMethod algorithm URI.
+	SignatureAlgorithm string
+
+	// References lists every ds:Reference in SignedInfo, including the
+	// first one described by the fields above (e.g. a signed wsu:Timestamp).
+	References []ReferenceReport
+}
+
+// ReferenceReport is the digest check of one ds:Reference.
+type ReferenceReport struct {
+	URI             string
+	DigestAlgorithm string
+	EmbeddedDigest  string
+	ComputedDigest  string
+	DigestMatch     bool
+}
+
+// Valid reports whether every digest matches and the signature verifies.
+func (r *VerificationReport) Valid() bool {
+	for _, ref := range r.References {
+		if !ref.DigestMatch {
+			return false
+		}
+	}
+	return r.DigestMatch && r.SignatureValid
+}
+
+// VerifySignedEnvelope checks a WS-Security signed SOAP envelope offline.
+// It recomputes the digest of every referenced element and the canonical
+// SignedInfo exactly as signSOAPEnvelope does, and verifies the signature
+// against the certificate in the BinarySecurityToken. An error is returned
+// only when the envelope is malformed; verification failures are reported
+// in the VerificationReport.
+func VerifySignedEnvelope(signedXML []byte) (*VerificationReport, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(signedXML); err != nil {
+		return nil, fmt.Errorf("parse soap xml: %w", err)
+	}
+	env := doc.Root()
+	if env == nil {
+		return nil, fmt.Errorf("soap envelope missing")
+	}
+	header := findChild(env, "Header")
+	if header == nil {
+		return nil, fmt.Errorf("soap Header not found")
+	}
+	security := findChild(header, "Security")
+	if security == nil {
+		return nil, fmt.Errorf("wsse:Security header not found")
+	}
+	sig := findChild(security, "Signature")
+	if sig == nil {
+		return nil, fmt.Errorf("ds:Signature not found")
+	}
+	signedInfo := findChild(sig, "SignedInfo")
+	if signedInfo == nil {
+		return nil, fmt.Errorf("ds:SignedInfo not found")
+	}
+	var refs []*etree.Element
+	for _, el := range signedInfo.ChildElements() {
+		if localName(el.Tag) == "Reference" {
+			refs = append(refs, el)
+		}
+	}
+	if len(refs) == 0 {
+		return nil, fmt.Errorf("ds:Reference not found")
+	}
+
+	report := &VerificationReport{}
+	if sm := findChild(signedInfo, "SignatureMethod"); sm != nil {
+		report.SignatureAlgorithm = sm.SelectAttrValue("Algorithm", "")
+	}
+	for i, ref := range refs {
+		rr, err := checkReference(env, ref, report, i == 0)
+		if err != nil {
+			return nil, err
+		}
+		report.References = append(report.References, rr)
+	}
+	first := report.References[0]
+	report.ReferenceURI = first.URI
+	report.EmbeddedDigest = first.EmbeddedDigest
+	report.ComputedDigest = first.ComputedDigest
+	report.DigestMatch = first.DigestMatch
+
+	signedInfoC14N, err := canonicalize(withInheritedNamespaces(signedInfo), inclusivePrefixList(findChild(signedInfo, "CanonicalizationMethod")))
+	if err != nil {
+		return nil, fmt.Errorf("c14n signedInfo: %w", err)
+	}
+	report.CanonicalSignedInfo = string(signedInfoC14N)
+
+	report.Certificate, err = securityTokenCertificate(security, sig)
+	if err != nil {
+		report.SignatureError = err.Error()
+		return report, nil
+	}
+	if err := verifySignatureValue(sig, signedInfo, signedInfoC14N, report.Certificate); err != nil {
+		report.SignatureError = err.Error()
+		return report, nil
+	}
+	report.SignatureValid = true
+	return report, nil
+}
+
+// securityTokenCertificate resolves the KeyInfo SecurityTokenReference to
+// its BinarySecurityToken and parses the certificate.
+func securityTokenCertificate(security, sig *etree.Element) (*x509.Certificate, error) {
+	tokenID := ""
+	if ref := findPath(sig, "KeyInfo", "SecurityTokenReference", "Reference"); ref != nil {
+		tokenID = strings.TrimPrefix(ref.SelectAttrValue("URI", ""), "#")
+	}
+	var bst *etree.Element
+	for _, el := range security.ChildElements() {
+		if el.Tag == "BinarySecurityToken" && (tokenID == "" || wsuID(el) == tokenID) {
+			bst = el
+			break
+		}
+	}
+	if bst == nil {
+		return nil, fmt.Errorf("BinarySecurityToken %q not found", tokenID)
+	}
+	der, err := base64.StdEncoding.DecodeString(strings.TrimSpace(bst.Text()))
+	if err != nil {
+		return nil, fmt.Errorf("decode BinarySecurityToken: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("parse BinarySecurityToken certificate: %w", err)
+	}
+	return cert, nil
+}
+
+// checkReference recomputes the digest of one ds:Reference. When detail is
+// set it also fills the canonical form fields of report.
+func checkReference(env, ref *etree.Element, report *VerificationReport, detail bool) (ReferenceReport, error) {
+	rr := ReferenceReport{URI: ref.SelectAttrValue("URI", "")}
+	if dv := findChild(ref, "DigestValue"); dv != nil {
+		rr.EmbeddedDigest = strings.TrimSpace(dv.Text())
+	}
+	if dm := findChild(ref, "DigestMethod"); dm != nil {
+		rr.DigestAlgorithm = dm.SelectAttrValue("Algorithm", "")
+	}
+	hash, err := SigningOptions{DigestAlgorithm: DigestAlgorithm(rr.DigestAlgorithm)}.digestHash()
+	if err != nil {
+		return rr, err
+	}
+	prefixList := ""
+	if tr := findPath(ref, "Transforms", "Transform"); tr != nil {
+		prefixList = inclusivePrefixList(tr)
+	}
+
+	target := findByWSUID(env, strings.TrimPrefix(rr.URI, "#"))
+	if target == nil {
+		return rr, fmt.Errorf("referenced element %q not found", rr.URI)
+	}
+
+	inContext, err := canonicalize(withInheritedNamespaces(target), prefixList)
+	if err != nil {
+		return rr, fmt.Errorf("c14n %s: %w", rr.URI, err)
+	}
+	if detail {
+		report.CanonicalBodyInContext = string(inContext)
+		if subtree, err := canonicalize(target, prefixList); err != nil {
+			report.CanonicalizationError = err.Error()
+		} else {
+			report.CanonicalBody = string(subtree)
+			if !bytes.Equal(subtree, inContext) {
+				report.CanonicalDiff = lineDiff(report.CanonicalBody, report.CanonicalBodyInContext)
+			}
+		}
+	}
+	h := hash.New()
+	h.Write(inContext)
+	rr.ComputedDigest = base64.StdEncoding.EncodeToString(h.Sum(nil))
+	rr.DigestMatch = rr.ComputedDigest == rr.EmbeddedDigest
+	return rr, nil
+}
+
+// inclusivePrefixList returns the InclusiveNamespaces PrefixList of a
+// CanonicalizationMethod or Transform element.
+func inclusivePrefixList(method *etree.Element) string {
+	if method == nil {
+		return ""
+	}
+	if inc := findChild(method, "InclusiveNamespaces"); inc != nil {
+		return inc.SelectAttrValue("PrefixList", "")
+	}
+	return ""
+}
+
+func localName(tag string) string {
+	if idx := strings.LastIndex(tag, ":"); idx >= 0 {
+		return tag[idx+1:]
+	}
+	return tag
+}
+
+func verifySignatureValue(sig, signedInfo *etree.Element, signedInfoC14N []byte, cert *x509.Certificate) error {
+	sv := findChild(sig, "SignatureValue")
+	if sv == nil {
+		return fmt.Errorf("ds:SignatureValue not found")
+	}
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(sv.Text()))
+	if err != nil {
+		return fmt.Errorf("decode SignatureValue: %w", err)
+	}
+
+	alg := ""
+	if sm := findChild(signedInfo, "SignatureMethod"); sm != nil {
+		alg = sm.SelectAttrValue("Algorithm", "")
+	}
+	method, ok := signatureMethods[SignatureAlgorithm(alg)]
+	if !ok {
+		return fmt.Errorf("unsupported signature method %q", alg)
+	}
+	if err := method.verify(cert.PublicKey, signedInfoC14N, signature); err != nil {
+		return fmt.Errorf("signature does not verify: %w", err)
+	}
+	return nil
+}
+
+func wsuID(el *etree.Element) string {
+	for _, a := range el.Attr {
+		if a.Key == "Id" && (a.Space == "wsu" || a.Space == "") {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func findByWSUID(root *etree.Element, id string) *etree.Element {
+	if wsuID(root) == id {
+		return root
+	}
+	for _, c := range root.ChildElements() {
+		if el := findByWSUID(c, id); el != nil {
+			return el
+		}
+	}
+	return nil
+}
+
+// withInheritedNamespaces returns a copy of el that declares every namespace
+// prefix in scope from its ancestors and not redeclared on el itself.
+// Exclusive C14N then keeps those that are visibly used.
+func withInheritedNamespaces(el *etree.Element) *etree.Element {
+	cp := el.Copy()
+	declared := map[string]bool{}
+	for _, a := range cp.Attr {
+		if a.Space == "xmlns" {
+			declared[a.Key] = true
+		} else if a.Space == "" && a.Key == "xmlns" {
+			declared[""] = true
+		}
+	}
+	for p := el.Parent(); p != nil; p = p.Parent() {
+		for _, a := range p.Attr {
+			switch {
+			case a.Space == "xmlns" && !declared[a.Key]:
+				declared[a.Key] = true
+				cp.CreateAttr("xmlns:"+a.Key, a.Value)
+			case a.Space == "" && a.Key == "xmlns" && !declared[""]:
+				declared[""] = true
+				cp.CreateAttr("xmlns", a.Value)
+			}
+		}
+	}
+	return cp
+}
+
+// lineDiff returns a minimal line diff of a to b, with "-" for lines only
+// in a, "+" for lines only in b and " " for common lines.
+func lineDiff(a, b string) string {
+	x := strings.Split(a, "\n")
+	y := strings.Split(b, "\n")
+
+	// lcs[i][j] is the LCS length of x[i:] and y[j:].
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var out strings.Builder
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			out.WriteString("  " + x[i] + "\n")
+			i++
+			j++
+		case j < len(y) && (i == len(x) || lcs[i][j+1] >= lcs[i+1][j]):
+			out.WriteString("+ " + y[j] + "\n")
+			j++
+		default:
+			out.WriteString("- " + x[i] + "\n")
+			i++
+		}
+	}
+	return out.String()
+}
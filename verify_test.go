@@ -0,0 +1,133 @@
+package cybersource_soap_dm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/beevik/etree"
+)
+
+func TestVerifySignedEnvelope(t *testing.T) {
+	tests := []struct {
+		name    string
+		signing SigningOptions
+		ec      bool
+	}{
+		{name: "default"},
+		{name: "rsa-sha512", signing: SigningOptions{SignatureAlgorithm: SignatureRSASHA512, DigestAlgorithm: DigestSHA512}},
+		{name: "rsa-pss", signing: SigningOptions{SignatureAlgorithm: SignatureRSAPSSSHA256}},
+		{name: "ecdsa", signing: SigningOptions{SignatureAlgorithm: SignatureECDSASHA256}, ec: true},
+		{name: "inclusive prefixes", signing: SigningOptions{InclusivePrefixes: []string{"ns1"}}},
+		{name: "timestamp", signing: SigningOptions{TimestampTTL: 300e9}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{Signing: tt.signing}
+			if tt.ec {
+				cfg.P12Path = writeTestP12(t, testECKey(t))
+				cfg.P12Password = testP12Password
+			}
+			c := newTestClient(t, cfg)
+			signed, err := c.BuildSignedRequest(testRequest("verify-1"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			report, err := VerifySignedEnvelope(signed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !report.Valid() {
+				t.Fatalf("report not valid: digest %v (embedded %s, computed %s), signature %v (%s)",
+					report.DigestMatch, report.EmbeddedDigest, report.ComputedDigest, report.SignatureValid, report.SignatureError)
+			}
+			if report.Certificate == nil || report.Certificate.Subject.CommonName != "testmerchant" {
+				t.Errorf("Certificate = %v, want CN=testmerchant", report.Certificate)
+			}
+			wantRefs := 1
+			if tt.signing.TimestampTTL > 0 {
+				wantRefs = 2
+			}
+			if len(report.References) != wantRefs {
+				t.Errorf("got %d references, want %d", len(report.References), wantRefs)
+			}
+		})
+	}
+}
+
+func TestVerifySignedEnvelopeDetectsTampering(t *testing.T) {
+	c := newTestClient(t, Config{})
+	signed, err := c.BuildSignedRequest(testRequest("verify-2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("body", func(t *testing.T) {
+		tampered := bytes.Replace(signed, []byte(">10.00<"), []byte(">1.00<"), 1)
+		if bytes.Equal(tampered, signed) {
+			t.Fatal("amount not found in the signed envelope")
+		}
+		report, err := VerifySignedEnvelope(tampered)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report.DigestMatch || report.Valid() {
+			t.Error("tampered body verified")
+		}
+		if !report.SignatureValid {
+			t.Errorf("SignedInfo is untouched, but the signature did not verify: %s", report.SignatureError)
+		}
+	})
+
+	t.Run("signature value", func(t *testing.T) {
+		start := bytes.Index(signed, []byte("SignatureValue>")) + len("SignatureValue>")
+		tampered := bytes.Clone(signed)
+		if tampered[start] == 'A' {
+			tampered[start] = 'B'
+		} else {
+			tampered[start] = 'A'
+		}
+		report, err := VerifySignedEnvelope(tampered)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !report.DigestMatch {
+			t.Error("the body is untouched, but its digest did not match")
+		}
+		if report.SignatureValid || !strings.Contains(report.SignatureError, "does not verify") {
+			t.Errorf("SignatureValid = %v, SignatureError = %q, want a verification failure", report.SignatureValid, report.SignatureError)
+		}
+	})
+}
+
+func TestWithInheritedNamespaces(t *testing.T) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(`<e:Envelope xmlns:e="urn:env" xmlns:wsu="urn:wsu" xmlns:unused="urn:unused">` +
+		`<e:Body wsu:Id="Body"><e:Item/></e:Body></e:Envelope>`); err != nil {
+		t.Fatal(err)
+	}
+	body := findChild(doc.Root(), "Body")
+
+	got, err := canonicalize(withInheritedNamespaces(body), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Exclusive C14N keeps the inherited declarations the subtree uses and
+	// drops the unused one.
+	want := `<e:Body xmlns:e="urn:env" xmlns:wsu="urn:wsu" wsu:Id="Body"><e:Item></e:Item></e:Body>`
+	if string(got) != want {
+		t.Errorf("in context:\n got %s\nwant %s", got, want)
+	}
+	if body.SelectAttr("xmlns:e") != nil {
+		t.Error("withInheritedNamespaces modified the original element")
+	}
+
+	got, err = canonicalize(withInheritedNamespaces(body), "unused")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(got), `xmlns:unused="urn:unused"`) {
+		t.Errorf("inclusive prefix list did not render the inherited namespace: %s", got)
+	}
+}
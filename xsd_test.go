@@ -0,0 +1,1197 @@
+package cybersource_soap_dm
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/beevik/etree"
+)
+
+// xsdNS is the XML Schema namespace.
+const xsdNS = "http://www.w3.org/2001/XMLSchema"
+
+// xsdValidator validates documents against the subset of XML Schema the
+// CyberSource transaction-data schemas use: global and local elements,
+// element references, sequence, choice and wildcard content models with
+// occurrence bounds, simple content, complex content extension, attributes,
+// and simple types restricting a built-in type with facets. loadXSD fails
+// on any other construct, so a schema that needs more is never validated
+// partially.
+type xsdValidator struct {
+	ns        string
+	qualified bool
+	elements  map[string]*xsdElement
+	complex   map[string]*xsdComplexType
+	simple    map[string]*xsdSimpleType
+
+	// refs are the type references to check once the schema is loaded.
+	refs []xsdTypeRef
+	// anonymous counts inline types, which are registered under
+	// generated names.
+	anonymous int
+}
+
+type xsdQName struct{ space, local string }
+
+func (q xsdQName) String() string {
+	if q.space == xsdNS {
+		return "xsd:" + q.local
+	}
+	return q.local
+}
+
+type xsdTypeRef struct {
+	name  xsdQName
+	where string
+	// simple requires a simple type, as for attributes and simple content.
+	simple bool
+}
+
+type xsdElement struct {
+	name      string
+	namespace string
+	typ       xsdQName
+	// ref names the global element a reference stands for until the
+	// schema is resolved.
+	ref *xsdQName
+}
+
+// xsdParticle is an element, wildcard, sequence or choice in a content
+// model. max is -1 when unbounded.
+type xsdParticle struct {
+	kind     string
+	element  *xsdElement
+	wildcard string
+	children []*xsdParticle
+	min, max int
+}
+
+type xsdComplexType struct {
+	name    string
+	content *xsdParticle
+	attrs   []*xsdAttribute
+	anyAttr bool
+	mixed   bool
+	// simpleBase is the type of the text of a simple content type.
+	simpleBase *xsdQName
+	// base is the type a complex content type extends.
+	base *xsdQName
+}
+
+type xsdAttribute struct {
+	name     string
+	typ      xsdQName
+	required bool
+	fixed    *string
+}
+
+type xsdSimpleType struct {
+	name     string
+	base     xsdQName
+	enum     []string
+	patterns []*regexp.Regexp
+
+	length, minLength, maxLength int
+	totalDigits, fractionDigits  int
+	minIncl, maxIncl             *big.Rat
+	minExcl, maxExcl             *big.Rat
+}
+
+// xsdBuiltins are the built-in simple types checkValue understands.
+var xsdBuiltins = map[string]func(string) error{
+	"anySimpleType":      func(string) error { return nil },
+	"string":             func(string) error { return nil },
+	"normalizedString":   func(string) error { return nil },
+	"token":              func(string) error { return nil },
+	"language":           func(string) error { return nil },
+	"Name":               func(string) error { return nil },
+	"NCName":             func(string) error { return nil },
+	"NMTOKEN":            func(string) error { return nil },
+	"ID":                 func(string) error { return nil },
+	"IDREF":              func(string) error { return nil },
+	"anyURI":             func(string) error { return nil },
+	"boolean":            xsdMatch(`true|false|1|0`),
+	"decimal":            xsdMatch(`[+-]?([0-9]+(\.[0-9]*)?|\.[0-9]+)`),
+	"float":              xsdFloat,
+	"double":             xsdFloat,
+	"date":               xsdMatch(`-?[0-9]{4,}-[0-9]{2}-[0-9]{2}(Z|[+-][0-9]{2}:[0-9]{2})?`),
+	"time":               xsdMatch(`[0-9]{2}:[0-9]{2}:[0-9]{2}(\.[0-9]+)?(Z|[+-][0-9]{2}:[0-9]{2})?`),
+	"dateTime":           xsdMatch(`-?[0-9]{4,}-[0-9]{2}-[0-9]{2}T[0-9]{2}:[0-9]{2}:[0-9]{2}(\.[0-9]+)?(Z|[+-][0-9]{2}:[0-9]{2})?`),
+	"base64Binary":       xsdBase64,
+	"hexBinary":          func(s string) error { _, err := hex.DecodeString(s); return err },
+	"integer":            xsdInteger("", ""),
+	"nonNegativeInteger": xsdInteger("0", ""),
+	"positiveInteger":    xsdInteger("1", ""),
+	"nonPositiveInteger": xsdInteger("", "0"),
+	"negativeInteger":    xsdInteger("", "-1"),
+	"long":               xsdInteger("-9223372036854775808", "9223372036854775807"),
+	"int":                xsdInteger("-2147483648", "2147483647"),
+	"short":              xsdInteger("-32768", "32767"),
+	"byte":               xsdInteger("-128", "127"),
+	"unsignedLong":       xsdInteger("0", "18446744073709551615"),
+	"unsignedInt":        xsdInteger("0", "4294967295"),
+	"unsignedShort":      xsdInteger("0", "65535"),
+	"unsignedByte":       xsdInteger("0", "255"),
+}
+
+func xsdMatch(pattern string) func(string) error {
+	re := regexp.MustCompile("^(?:" + pattern + ")$")
+	return func(s string) error {
+		if !re.MatchString(s) {
+			return fmt.Errorf("malformed")
+		}
+		return nil
+	}
+}
+
+func xsdFloat(s string) error {
+	switch s {
+	case "INF", "-INF", "NaN":
+		return nil
+	}
+	_, err := strconv.ParseFloat(s, 64)
+	return err
+}
+
+func xsdBase64(s string) error {
+	_, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+	return err
+}
+
+func xsdInteger(minValue, maxValue string) func(string) error {
+	return func(s string) error {
+		n, ok := new(big.Int).SetString(strings.TrimPrefix(s, "+"), 10)
+		if !ok {
+			return fmt.Errorf("malformed")
+		}
+		if lo, ok := new(big.Int).SetString(minValue, 10); ok && n.Cmp(lo) < 0 {
+			return fmt.Errorf("below %s", minValue)
+		}
+		if hi, ok := new(big.Int).SetString(maxValue, 10); ok && n.Cmp(hi) > 0 {
+			return fmt.Errorf("above %s", maxValue)
+		}
+		return nil
+	}
+}
+
+// loadXSD parses the schema at path.
+func loadXSD(path string) (*xsdValidator, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromFile(path); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	v, err := parseXSD(doc.Root())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return v, nil
+}
+
+func parseXSD(root *etree.Element) (*xsdValidator, error) {
+	if root == nil || root.Tag != "schema" || root.NamespaceURI() != xsdNS {
+		return nil, fmt.Errorf("root element is not xsd:schema")
+	}
+	if err := xsdAttrs(root, "targetNamespace", "elementFormDefault", "attributeFormDefault", "version", "id"); err != nil {
+		return nil, err
+	}
+	if f := root.SelectAttrValue("attributeFormDefault", "unqualified"); f != "unqualified" {
+		return nil, fmt.Errorf("unsupported attributeFormDefault %q", f)
+	}
+	v := &xsdValidator{
+		ns:        root.SelectAttrValue("targetNamespace", ""),
+		qualified: root.SelectAttrValue("elementFormDefault", "unqualified") == "qualified",
+		elements:  map[string]*xsdElement{},
+		complex:   map[string]*xsdComplexType{},
+		simple:    map[string]*xsdSimpleType{},
+	}
+
+	children, err := xsdChildren(root)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range children {
+		name := c.SelectAttrValue("name", "")
+		var err error
+		switch c.Tag {
+		case "element":
+			var p *xsdParticle
+			if p, err = v.parseElement(c, true); err == nil {
+				v.elements[name] = p.element
+			}
+		case "complexType":
+			var ct *xsdComplexType
+			if ct, err = v.parseComplexType(c, name); err == nil {
+				v.complex[name] = ct
+			}
+		case "simpleType":
+			var st *xsdSimpleType
+			if st, err = v.parseSimpleType(c, name); err == nil {
+				v.simple[name] = st
+			}
+		default:
+			err = fmt.Errorf("unsupported top-level xsd:%s", c.Tag)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := v.resolve(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// xsdChildren returns the schema components under el, skipping
+// annotations.
+func xsdChildren(el *etree.Element) ([]*etree.Element, error) {
+	var out []*etree.Element
+	for _, c := range el.ChildElements() {
+		if c.NamespaceURI() != xsdNS {
+			return nil, fmt.Errorf("%s: unexpected {%s}%s", el.Tag, c.NamespaceURI(), c.Tag)
+		}
+		if c.Tag != "annotation" {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+// xsdAttrs rejects attributes of a schema component other than allowed.
+// Namespaced attributes are extensions and are ignored.
+func xsdAttrs(el *etree.Element, allowed ...string) error {
+	for _, a := range el.Attr {
+		if a.Space == "" && a.Key != "xmlns" && !slices.Contains(allowed, a.Key) {
+			return fmt.Errorf("xsd:%s %s: unsupported attribute %s", el.Tag, el.SelectAttrValue("name", ""), a.Key)
+		}
+	}
+	return nil
+}
+
+// qname resolves a QName-valued attribute against the namespace
+// declarations in scope.
+func qname(el *etree.Element, value string) (xsdQName, error) {
+	prefix, local, ok := strings.Cut(value, ":")
+	if !ok {
+		prefix, local = "", value
+	}
+	for e := el; e != nil; e = e.Parent() {
+		for _, a := range e.Attr {
+			if (prefix == "" && a.Space == "" && a.Key == "xmlns") || (prefix != "" && a.Space == "xmlns" && a.Key == prefix) {
+				return xsdQName{a.Value, local}, nil
+			}
+		}
+	}
+	if prefix == "" {
+		return xsdQName{"", local}, nil
+	}
+	return xsdQName{}, fmt.Errorf("undeclared prefix in %q", value)
+}
+
+func parseOccurs(el *etree.Element) (minOccurs, maxOccurs int, err error) {
+	minOccurs, maxOccurs = 1, 1
+	if s := el.SelectAttr("minOccurs"); s != nil {
+		if minOccurs, err = strconv.Atoi(s.Value); err != nil || minOccurs < 0 {
+			return 0, 0, fmt.Errorf("bad minOccurs %q", s.Value)
+		}
+	}
+	if s := el.SelectAttr("maxOccurs"); s != nil {
+		if s.Value == "unbounded" {
+			return minOccurs, -1, nil
+		}
+		if maxOccurs, err = strconv.Atoi(s.Value); err != nil || maxOccurs < minOccurs {
+			return 0, 0, fmt.Errorf("bad maxOccurs %q", s.Value)
+		}
+	}
+	return minOccurs, maxOccurs, nil
+}
+
+// typeAttr resolves the type of an element or attribute, registering an
+// inline type under a generated name.
+func (v *xsdValidator) typeAttr(el *etree.Element, where string, simple bool) (xsdQName, error) {
+	children, err := xsdChildren(el)
+	if err != nil {
+		return xsdQName{}, err
+	}
+	if t := el.SelectAttr("type"); t != nil {
+		if len(children) > 0 {
+			return xsdQName{}, fmt.Errorf("%s: both a type attribute and an inline type", where)
+		}
+		q, err := qname(el, t.Value)
+		if err != nil {
+			return xsdQName{}, fmt.Errorf("%s: %w", where, err)
+		}
+		v.refs = append(v.refs, xsdTypeRef{q, where, simple})
+		return q, nil
+	}
+	switch {
+	case len(children) == 0:
+		if simple {
+			return xsdQName{xsdNS, "anySimpleType"}, nil
+		}
+		return xsdQName{xsdNS, "anyType"}, nil
+	case len(children) > 1:
+		return xsdQName{}, fmt.Errorf("%s: more than one inline type", where)
+	}
+
+	v.anonymous++
+	name := fmt.Sprintf("{anonymous %d in %s}", v.anonymous, where)
+	switch c := children[0]; {
+	case c.Tag == "simpleType":
+		st, err := v.parseSimpleType(c, name)
+		if err != nil {
+			return xsdQName{}, err
+		}
+		v.simple[name] = st
+	case c.Tag == "complexType" && !simple:
+		ct, err := v.parseComplexType(c, name)
+		if err != nil {
+			return xsdQName{}, err
+		}
+		v.complex[name] = ct
+	default:
+		return xsdQName{}, fmt.Errorf("%s: unsupported inline xsd:%s", where, c.Tag)
+	}
+	return xsdQName{v.ns, name}, nil
+}
+
+func (v *xsdValidator) parseElement(el *etree.Element, global bool) (*xsdParticle, error) {
+	allowed := []string{"name", "type", "nillable", "default", "id"}
+	if !global {
+		allowed = append(allowed, "ref", "minOccurs", "maxOccurs", "form")
+	}
+	if err := xsdAttrs(el, allowed...); err != nil {
+		return nil, err
+	}
+	p := &xsdParticle{kind: "element", min: 1, max: 1}
+	if !global {
+		var err error
+		if p.min, p.max, err = parseOccurs(el); err != nil {
+			return nil, fmt.Errorf("element %s: %w", el.SelectAttrValue("name", el.SelectAttrValue("ref", "")), err)
+		}
+	}
+
+	if r := el.SelectAttr("ref"); r != nil {
+		if el.SelectAttr("name") != nil || el.SelectAttr("type") != nil || len(el.ChildElements()) > 0 {
+			return nil, fmt.Errorf("element ref %s: unexpected name or type", r.Value)
+		}
+		q, err := qname(el, r.Value)
+		if err != nil {
+			return nil, err
+		}
+		p.element = &xsdElement{ref: &q}
+		return p, nil
+	}
+
+	name := el.SelectAttrValue("name", "")
+	if name == "" {
+		return nil, fmt.Errorf("element without a name")
+	}
+	namespace := v.ns
+	if !global {
+		form := "unqualified"
+		if v.qualified {
+			form = "qualified"
+		}
+		if el.SelectAttrValue("form", form) != "qualified" {
+			namespace = ""
+		}
+	}
+	typ, err := v.typeAttr(el, "element "+name, false)
+	if err != nil {
+		return nil, err
+	}
+	p.element = &xsdElement{name: name, namespace: namespace, typ: typ}
+	return p, nil
+}
+
+func (v *xsdValidator) parseParticle(el *etree.Element) (*xsdParticle, error) {
+	switch el.Tag {
+	case "element":
+		return v.parseElement(el, false)
+	case "any":
+		if err := xsdAttrs(el, "namespace", "processContents", "minOccurs", "maxOccurs", "id"); err != nil {
+			return nil, err
+		}
+		if pc := el.SelectAttrValue("processContents", "strict"); pc == "strict" {
+			return nil, fmt.Errorf("unsupported xsd:any with strict processContents")
+		}
+		min, max, err := parseOccurs(el)
+		if err != nil {
+			return nil, fmt.Errorf("any: %w", err)
+		}
+		return &xsdParticle{kind: "any", wildcard: el.SelectAttrValue("namespace", "##any"), min: min, max: max}, nil
+	case "sequence", "choice":
+		if err := xsdAttrs(el, "minOccurs", "maxOccurs", "id"); err != nil {
+			return nil, err
+		}
+		min, max, err := parseOccurs(el)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", el.Tag, err)
+		}
+		p := &xsdParticle{kind: el.Tag, min: min, max: max}
+		children, err := xsdChildren(el)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range children {
+			child, err := v.parseParticle(c)
+			if err != nil {
+				return nil, err
+			}
+			p.children = append(p.children, child)
+		}
+		return p, nil
+	}
+	return nil, fmt.Errorf("unsupported xsd:%s in a content model", el.Tag)
+}
+
+func (v *xsdValidator) parseAttribute(el *etree.Element, owner string) (*xsdAttribute, error) {
+	if err := xsdAttrs(el, "name", "type", "use", "default", "fixed", "id"); err != nil {
+		return nil, err
+	}
+	a := &xsdAttribute{name: el.SelectAttrValue("name", "")}
+	if a.name == "" {
+		return nil, fmt.Errorf("%s: unsupported attribute without a name", owner)
+	}
+	switch use := el.SelectAttrValue("use", "optional"); use {
+	case "required":
+		a.required = true
+	case "optional":
+	default:
+		return nil, fmt.Errorf("%s: unsupported attribute use %q", owner, use)
+	}
+	if f := el.SelectAttr("fixed"); f != nil {
+		a.fixed = &f.Value
+	}
+	var err error
+	a.typ, err = v.typeAttr(el, owner+" attribute "+a.name, true)
+	return a, err
+}
+
+// parseAttributes reads the attribute declarations among children and
+// returns the remaining children.
+func (v *xsdValidator) parseAttributes(ct *xsdComplexType, children []*etree.Element) ([]*etree.Element, error) {
+	var rest []*etree.Element
+	for _, c := range children {
+		switch c.Tag {
+		case "attribute":
+			a, err := v.parseAttribute(c, "type "+ct.name)
+			if err != nil {
+				return nil, err
+			}
+			ct.attrs = append(ct.attrs, a)
+		case "anyAttribute":
+			ct.anyAttr = true
+		default:
+			rest = append(rest, c)
+		}
+	}
+	return rest, nil
+}
+
+func (v *xsdValidator) parseComplexType(el *etree.Element, name string) (*xsdComplexType, error) {
+	if err := xsdAttrs(el, "name", "mixed", "id"); err != nil {
+		return nil, err
+	}
+	ct := &xsdComplexType{name: name, mixed: el.SelectAttrValue("mixed", "false") == "true"}
+	children, err := xsdChildren(el)
+	if err != nil {
+		return nil, err
+	}
+	if children, err = v.parseAttributes(ct, children); err != nil {
+		return nil, err
+	}
+	if len(children) > 1 {
+		return nil, fmt.Errorf("type %s: unsupported content", name)
+	}
+	if len(children) == 0 {
+		return ct, nil
+	}
+
+	switch c := children[0]; c.Tag {
+	case "sequence", "choice":
+		ct.content, err = v.parseParticle(c)
+		return ct, err
+	case "simpleContent", "complexContent":
+		if err := xsdAttrs(c, "mixed", "id"); err != nil {
+			return nil, err
+		}
+		if c.SelectAttrValue("mixed", "false") == "true" {
+			ct.mixed = true
+		}
+		ext, err := xsdChildren(c)
+		if err != nil {
+			return nil, err
+		}
+		if len(ext) != 1 || ext[0].Tag != "extension" {
+			return nil, fmt.Errorf("type %s: unsupported %s derivation", name, c.Tag)
+		}
+		if err := xsdAttrs(ext[0], "base", "id"); err != nil {
+			return nil, err
+		}
+		base, err := qname(ext[0], ext[0].SelectAttrValue("base", ""))
+		if err != nil {
+			return nil, fmt.Errorf("type %s: %w", name, err)
+		}
+		v.refs = append(v.refs, xsdTypeRef{base, "type " + name, c.Tag == "simpleContent"})
+		rest, err := xsdChildren(ext[0])
+		if err != nil {
+			return nil, err
+		}
+		if rest, err = v.parseAttributes(ct, rest); err != nil {
+			return nil, err
+		}
+		if c.Tag == "simpleContent" {
+			if len(rest) > 0 {
+				return nil, fmt.Errorf("type %s: unexpected xsd:%s in simple content", name, rest[0].Tag)
+			}
+			ct.simpleBase = &base
+			return ct, nil
+		}
+		ct.base = &base
+		switch {
+		case len(rest) == 1:
+			ct.content, err = v.parseParticle(rest[0])
+			return ct, err
+		case len(rest) > 1:
+			return nil, fmt.Errorf("type %s: unsupported extension content", name)
+		}
+		return ct, nil
+	}
+	return nil, fmt.Errorf("type %s: unsupported xsd:%s", name, children[0].Tag)
+}
+
+func (v *xsdValidator) parseSimpleType(el *etree.Element, name string) (*xsdSimpleType, error) {
+	if err := xsdAttrs(el, "name", "final", "id"); err != nil {
+		return nil, err
+	}
+	children, err := xsdChildren(el)
+	if err != nil {
+		return nil, err
+	}
+	if len(children) != 1 || children[0].Tag != "restriction" {
+		return nil, fmt.Errorf("simple type %s: only restriction is supported", name)
+	}
+	r := children[0]
+	if err := xsdAttrs(r, "base", "id"); err != nil {
+		return nil, err
+	}
+	base, err := qname(r, r.SelectAttrValue("base", ""))
+	if err != nil || base.local == "" {
+		return nil, fmt.Errorf("simple type %s: restriction needs a base", name)
+	}
+	v.refs = append(v.refs, xsdTypeRef{base, "simple type " + name, true})
+
+	st := &xsdSimpleType{name: name, base: base, length: -1, minLength: -1, maxLength: -1, totalDigits: -1, fractionDigits: -1}
+	facets, err := xsdChildren(r)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range facets {
+		value := f.SelectAttrValue("value", "")
+		var err error
+		switch f.Tag {
+		case "enumeration":
+			st.enum = append(st.enum, value)
+		case "pattern":
+			var re *regexp.Regexp
+			if re, err = regexp.Compile("^(?:" + value + ")$"); err == nil {
+				st.patterns = append(st.patterns, re)
+			}
+		case "length":
+			st.length, err = strconv.Atoi(value)
+		case "minLength":
+			st.minLength, err = strconv.Atoi(value)
+		case "maxLength":
+			st.maxLength, err = strconv.Atoi(value)
+		case "totalDigits":
+			st.totalDigits, err = strconv.Atoi(value)
+		case "fractionDigits":
+			st.fractionDigits, err = strconv.Atoi(value)
+		case "minInclusive":
+			st.minIncl, err = parseRat(value)
+		case "maxInclusive":
+			st.maxIncl, err = parseRat(value)
+		case "minExclusive":
+			st.minExcl, err = parseRat(value)
+		case "maxExclusive":
+			st.maxExcl, err = parseRat(value)
+		case "whiteSpace":
+		default:
+			err = fmt.Errorf("unsupported facet")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("simple type %s: xsd:%s %q: %w", name, f.Tag, value, err)
+		}
+	}
+	return st, nil
+}
+
+func parseRat(s string) (*big.Rat, error) {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, fmt.Errorf("not a number")
+	}
+	return r, nil
+}
+
+// resolve replaces element references with the global elements and checks
+// that every type reference names a known type.
+func (v *xsdValidator) resolve() error {
+	var walk func(p *xsdParticle) error
+	walk = func(p *xsdParticle) error {
+		if p == nil {
+			return nil
+		}
+		if p.kind == "element" && p.element.ref != nil {
+			ref := *p.element.ref
+			global := v.elements[ref.local]
+			if ref.space != v.ns || global == nil {
+				return fmt.Errorf("element ref %s is not a global element", ref.local)
+			}
+			p.element = global
+		}
+		for _, c := range p.children {
+			if err := walk(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, ct := range v.complex {
+		if err := walk(ct.content); err != nil {
+			return err
+		}
+	}
+
+	for _, ref := range v.refs {
+		switch {
+		case ref.name.space == xsdNS && ref.name.local == "anyType" && !ref.simple:
+		case ref.name.space == xsdNS && xsdBuiltins[ref.name.local] != nil:
+		case ref.name.space == v.ns && v.simple[ref.name.local] != nil:
+		case ref.name.space == v.ns && v.complex[ref.name.local] != nil && !ref.simple:
+		default:
+			return fmt.Errorf("%s: unknown or unsupported type {%s}%s", ref.where, ref.name.space, ref.name.local)
+		}
+	}
+	return nil
+}
+
+// Validate checks el, an instance of a global element of the schema, and
+// returns every problem found.
+func (v *xsdValidator) Validate(el *etree.Element) []string {
+	decl, ok := v.elements[el.Tag]
+	if !ok || el.NamespaceURI() != v.ns {
+		return []string{fmt.Sprintf("{%s}%s is not a global element of the schema", el.NamespaceURI(), el.Tag)}
+	}
+	var problems []string
+	v.validateElement(el, decl, "/"+el.Tag, &problems)
+	return problems
+}
+
+func (v *xsdValidator) validateElement(el *etree.Element, decl *xsdElement, path string, problems *[]string) {
+	addf := func(format string, args ...any) {
+		*problems = append(*problems, path+": "+fmt.Sprintf(format, args...))
+	}
+	typ := decl.typ
+	if typ.space == xsdNS && typ.local == "anyType" {
+		return
+	}
+	ct := v.complex[typ.local]
+	if typ.space == xsdNS || ct == nil {
+		if len(el.ChildElements()) > 0 {
+			addf("simple type %s has child elements", typ)
+		}
+		for _, a := range el.Attr {
+			if !isNamespaceDecl(a) {
+				addf("unexpected attribute %s", a.FullKey())
+			}
+		}
+		if err := v.checkValue(typ, el.Text()); err != nil {
+			addf("%v", err)
+		}
+		return
+	}
+
+	content, attrs, anyAttr, simpleBase := v.effective(ct)
+	v.validateAttributes(el, attrs, anyAttr, addf)
+	if simpleBase != nil {
+		if len(el.ChildElements()) > 0 {
+			addf("simple content type %s has child elements", typ)
+		}
+		if err := v.checkValue(*simpleBase, el.Text()); err != nil {
+			addf("%v", err)
+		}
+		return
+	}
+	if !ct.mixed && hasText(el) {
+		addf("complex type %s has text content", typ)
+	}
+
+	children := el.ChildElements()
+	m := &xsdMatcher{v: v, children: children, attempted: map[int][]string{}}
+	ends := []int{0}
+	if content != nil {
+		ends = m.match(content, 0)
+	}
+	if !slices.Contains(ends, len(children)) {
+		addf("%s", m.problem(content))
+	}
+
+	decls := map[xsdQName]*xsdElement{}
+	collectElements(content, decls)
+	counts := map[string]int{}
+	for _, c := range children {
+		if d := decls[xsdQName{c.NamespaceURI(), c.Tag}]; d != nil {
+			counts[c.Tag]++
+			v.validateElement(c, d, fmt.Sprintf("%s/%s[%d]", path, c.Tag, counts[c.Tag]), problems)
+		}
+	}
+}
+
+// effective returns the content model and attributes of ct, including
+// those of the types it extends.
+func (v *xsdValidator) effective(ct *xsdComplexType) (content *xsdParticle, attrs []*xsdAttribute, anyAttr bool, simpleBase *xsdQName) {
+	content, attrs, anyAttr, simpleBase = ct.content, ct.attrs, ct.anyAttr, ct.simpleBase
+	if simpleBase != nil || ct.base == nil || ct.base.space == xsdNS {
+		return content, attrs, anyAttr, simpleBase
+	}
+	baseContent, baseAttrs, baseAny, _ := v.effective(v.complex[ct.base.local])
+	switch {
+	case baseContent == nil:
+	case content == nil:
+		content = baseContent
+	default:
+		content = &xsdParticle{kind: "sequence", min: 1, max: 1, children: []*xsdParticle{baseContent, content}}
+	}
+	return content, append(slices.Clone(baseAttrs), attrs...), anyAttr || baseAny, nil
+}
+
+func collectElements(p *xsdParticle, into map[xsdQName]*xsdElement) {
+	if p == nil {
+		return
+	}
+	if p.kind == "element" {
+		q := xsdQName{p.element.namespace, p.element.name}
+		if into[q] == nil {
+			into[q] = p.element
+		}
+	}
+	for _, c := range p.children {
+		collectElements(c, into)
+	}
+}
+
+func hasText(el *etree.Element) bool {
+	for _, tok := range el.Child {
+		if cd, ok := tok.(*etree.CharData); ok && strings.TrimSpace(cd.Data) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// xsdMatcher matches child elements against a content model. It follows
+// every way the model can consume the children, so optional particles,
+// choices and repetitions need no lookahead, and remembers how far it got
+// for the error message.
+type xsdMatcher struct {
+	v        *xsdValidator
+	children []*etree.Element
+
+	furthest  int
+	attempted map[int][]string
+}
+
+// match returns every position at which p, started at position i, can end.
+func (m *xsdMatcher) match(p *xsdParticle, i int) []int {
+	var out []int
+	if p.min == 0 {
+		out = []int{i}
+	}
+	// Beyond min, only repetitions that consume a child can lead further.
+	limit := p.min + len(m.children) - i + 1
+	if p.max >= 0 && p.max < limit {
+		limit = p.max
+	}
+	cur := []int{i}
+	for n := 1; n <= limit && len(cur) > 0; n++ {
+		var next []int
+		for _, s := range cur {
+			next = union(next, m.matchOnce(p, s))
+		}
+		if n >= p.min {
+			out = union(out, next)
+		}
+		cur = next
+	}
+	return out
+}
+
+func (m *xsdMatcher) matchOnce(p *xsdParticle, i int) []int {
+	switch p.kind {
+	case "element":
+		if !slices.Contains(m.attempted[i], p.element.name) {
+			m.attempted[i] = append(m.attempted[i], p.element.name)
+		}
+		if i < len(m.children) && m.children[i].Tag == p.element.name && m.children[i].NamespaceURI() == p.element.namespace {
+			m.furthest = max(m.furthest, i+1)
+			return []int{i + 1}
+		}
+	case "any":
+		if i < len(m.children) && m.v.wildcardAllows(p.wildcard, m.children[i].NamespaceURI()) {
+			m.furthest = max(m.furthest, i+1)
+			return []int{i + 1}
+		}
+	case "sequence":
+		cur := []int{i}
+		for _, c := range p.children {
+			var next []int
+			for _, s := range cur {
+				next = union(next, m.match(c, s))
+			}
+			if cur = next; len(cur) == 0 {
+				return nil
+			}
+		}
+		return cur
+	case "choice":
+		var out []int
+		for _, c := range p.children {
+			out = union(out, m.match(c, i))
+		}
+		return out
+	}
+	return nil
+}
+
+// problem describes why the children did not match content.
+func (m *xsdMatcher) problem(content *xsdParticle) string {
+	expected := ""
+	if want := m.attempted[m.furthest]; len(want) == 1 {
+		expected = "; expected " + want[0]
+	} else if len(want) > 1 && len(want) <= 5 {
+		expected = "; expected one of " + strings.Join(want, ", ")
+	}
+	if m.furthest == len(m.children) {
+		return "missing required element" + expected
+	}
+
+	c := m.children[m.furthest]
+	decls := map[xsdQName]*xsdElement{}
+	collectElements(content, decls)
+	if c.NamespaceURI() != m.v.ns {
+		return fmt.Sprintf("unexpected element %s in namespace %q%s", c.Tag, c.NamespaceURI(), expected)
+	}
+	if decls[xsdQName{c.NamespaceURI(), c.Tag}] != nil {
+		return fmt.Sprintf("element %s is out of schema order or repeated%s", c.Tag, expected)
+	}
+	return fmt.Sprintf("unexpected element %s%s", c.Tag, expected)
+}
+
+func (v *xsdValidator) wildcardAllows(wildcard, ns string) bool {
+	for _, w := range strings.Fields(wildcard) {
+		switch {
+		case w == "##any",
+			w == "##other" && ns != v.ns && ns != "",
+			w == "##targetNamespace" && ns == v.ns,
+			w == "##local" && ns == "",
+			w == ns:
+			return true
+		}
+	}
+	return false
+}
+
+// union merges two sorted position sets.
+func union(a, b []int) []int {
+	out := append(slices.Clone(a), b...)
+	slices.Sort(out)
+	return slices.Compact(out)
+}
+
+func (v *xsdValidator) validateAttributes(el *etree.Element, attrs []*xsdAttribute, anyAttr bool, addf func(string, ...any)) {
+	for _, a := range el.Attr {
+		if isNamespaceDecl(a) {
+			continue
+		}
+		i := slices.IndexFunc(attrs, func(d *xsdAttribute) bool { return d.name == a.Key && a.Space == "" })
+		if i < 0 {
+			if !anyAttr {
+				addf("unexpected attribute %s", a.FullKey())
+			}
+			continue
+		}
+		if err := v.checkValue(attrs[i].typ, a.Value); err != nil {
+			addf("attribute %s: %v", a.Key, err)
+		}
+		if f := attrs[i].fixed; f != nil && a.Value != *f {
+			addf("attribute %s is %q, fixed to %q", a.Key, a.Value, *f)
+		}
+	}
+	for _, d := range attrs {
+		if d.required && el.SelectAttr(d.name) == nil {
+			addf("missing required attribute %s", d.name)
+		}
+	}
+}
+
+// checkValue checks a value against a built-in or named simple type.
+func (v *xsdValidator) checkValue(typ xsdQName, value string) error {
+	if typ.space == xsdNS {
+		if !v.preservesSpace(typ) {
+			value = strings.TrimSpace(value)
+		}
+		if err := xsdBuiltins[typ.local](value); err != nil {
+			return fmt.Errorf("%q is not a valid %s: %v", value, typ, err)
+		}
+		return nil
+	}
+
+	st := v.simple[typ.local]
+	if err := v.checkValue(st.base, value); err != nil {
+		return err
+	}
+	if !v.preservesSpace(typ) {
+		value = strings.TrimSpace(value)
+	}
+	if len(st.enum) > 0 && !slices.Contains(st.enum, value) {
+		return fmt.Errorf("%q is not an allowed %s value", value, typ)
+	}
+	for _, re := range st.patterns {
+		if !re.MatchString(value) {
+			return fmt.Errorf("%q does not match the %s pattern", value, typ)
+		}
+	}
+	n := utf8.RuneCountInString(value)
+	switch {
+	case st.length >= 0 && n != st.length:
+		return fmt.Errorf("%q is not %d characters long", value, st.length)
+	case st.minLength >= 0 && n < st.minLength:
+		return fmt.Errorf("%q is shorter than %d characters", value, st.minLength)
+	case st.maxLength >= 0 && n > st.maxLength:
+		return fmt.Errorf("%q is longer than %d characters", value, st.maxLength)
+	}
+
+	if st.minIncl == nil && st.maxIncl == nil && st.minExcl == nil && st.maxExcl == nil && st.totalDigits < 0 && st.fractionDigits < 0 {
+		return nil
+	}
+	num, ok := new(big.Rat).SetString(strings.TrimPrefix(value, "+"))
+	if !ok {
+		return fmt.Errorf("%q is not a number", value)
+	}
+	switch {
+	case st.minIncl != nil && num.Cmp(st.minIncl) < 0,
+		st.maxIncl != nil && num.Cmp(st.maxIncl) > 0,
+		st.minExcl != nil && num.Cmp(st.minExcl) <= 0,
+		st.maxExcl != nil && num.Cmp(st.maxExcl) >= 0:
+		return fmt.Errorf("%q is out of the %s range", value, typ)
+	}
+	intPart, frac, _ := strings.Cut(strings.TrimLeft(value, "+-"), ".")
+	frac = strings.TrimRight(frac, "0")
+	digits := len(strings.TrimLeft(intPart, "0")) + len(frac)
+	if st.totalDigits >= 0 && digits > st.totalDigits || st.fractionDigits >= 0 && len(frac) > st.fractionDigits {
+		return fmt.Errorf("%q has too many digits for %s", value, typ)
+	}
+	return nil
+}
+
+// preservesSpace reports whether typ is derived from xsd:string, whose
+// values keep their white space.
+func (v *xsdValidator) preservesSpace(typ xsdQName) bool {
+	for typ.space != xsdNS {
+		typ = v.simple[typ.local].base
+	}
+	return typ.local == "string" || typ.local == "anySimpleType"
+}
+
+func isNamespaceDecl(a etree.Attr) bool {
+	return a.Space == "xmlns" || (a.Space == "" && a.Key == "xmlns")
+}
+
+// testSchema is a small schema using each construct the validator
+// supports.
+const testSchema = `<?xml version="1.0" encoding="utf-8"?>
+<xsd:schema xmlns:xsd="http://www.w3.org/2001/XMLSchema" xmlns:tns="urn:test"
+  targetNamespace="urn:test" elementFormDefault="qualified">
+  <xsd:annotation><xsd:documentation>Test schema.</xsd:documentation></xsd:annotation>
+  <xsd:simpleType name="boolean">
+    <xsd:restriction base="xsd:string"><xsd:pattern value="(0|1|true|false)"/></xsd:restriction>
+  </xsd:simpleType>
+  <xsd:simpleType name="code">
+    <xsd:restriction base="xsd:string">
+      <xsd:enumeration value="a"/>
+      <xsd:enumeration value="b"/>
+    </xsd:restriction>
+  </xsd:simpleType>
+  <xsd:simpleType name="money">
+    <xsd:restriction base="xsd:decimal">
+      <xsd:minInclusive value="0"/>
+      <xsd:fractionDigits value="2"/>
+    </xsd:restriction>
+  </xsd:simpleType>
+  <xsd:element name="order" type="tns:Order"/>
+  <xsd:element name="note" type="xsd:string"/>
+  <xsd:complexType name="Order">
+    <xsd:sequence>
+      <xsd:element name="id" type="xsd:string"/>
+      <xsd:choice minOccurs="0">
+        <xsd:element name="card" type="tns:Card"/>
+        <xsd:element name="check" type="tns:Check"/>
+      </xsd:choice>
+      <xsd:sequence minOccurs="0" maxOccurs="unbounded">
+        <xsd:element name="sku" type="xsd:string"/>
+        <xsd:element name="qty" type="xsd:positiveInteger" minOccurs="0"/>
+      </xsd:sequence>
+      <xsd:element name="total" type="tns:Total" minOccurs="0"/>
+      <xsd:element name="service" minOccurs="0">
+        <xsd:complexType>
+          <xsd:attribute name="run" type="tns:boolean" use="required"/>
+        </xsd:complexType>
+      </xsd:element>
+      <xsd:element ref="tns:note" minOccurs="0" maxOccurs="2"/>
+      <xsd:any namespace="##other" processContents="lax" minOccurs="0"/>
+    </xsd:sequence>
+  </xsd:complexType>
+  <xsd:complexType name="Card">
+    <xsd:sequence>
+      <xsd:element name="number">
+        <xsd:simpleType>
+          <xsd:restriction base="xsd:string">
+            <xsd:maxLength value="19"/>
+            <xsd:pattern value="[0-9]+"/>
+          </xsd:restriction>
+        </xsd:simpleType>
+      </xsd:element>
+      <xsd:element name="type" type="tns:code" minOccurs="0"/>
+    </xsd:sequence>
+  </xsd:complexType>
+  <xsd:complexType name="Payment">
+    <xsd:sequence>
+      <xsd:element name="amount" type="tns:money"/>
+    </xsd:sequence>
+    <xsd:attribute name="id" type="xsd:int"/>
+  </xsd:complexType>
+  <xsd:complexType name="Check">
+    <xsd:complexContent>
+      <xsd:extension base="tns:Payment">
+        <xsd:sequence>
+          <xsd:element name="routing" type="xsd:string"/>
+        </xsd:sequence>
+      </xsd:extension>
+    </xsd:complexContent>
+  </xsd:complexType>
+  <xsd:complexType name="Total">
+    <xsd:simpleContent>
+      <xsd:extension base="tns:money">
+        <xsd:attribute name="currency" type="xsd:string" use="required"/>
+      </xsd:extension>
+    </xsd:simpleContent>
+  </xsd:complexType>
+</xsd:schema>
+`
+
+func writeSchema(t *testing.T, schema string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.xsd")
+	if err := os.WriteFile(path, []byte(schema), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestXSDValidator(t *testing.T) {
+	v, err := loadXSD(writeSchema(t, testSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		doc  string
+		want string // a substring of the problems; empty means valid
+	}{
+		{"minimal", `<id>1</id>`, ""},
+		{"card", `<id>1</id><card><number>4111</number><type>a</type></card>`, ""},
+		{"extension", `<id>1</id><check id="7"><amount>1.50</amount><routing>011000015</routing></check>`, ""},
+		{"repeated group", `<id>1</id><sku>a</sku><qty>2</qty><sku>b</sku><sku>c</sku><qty>1</qty>`, ""},
+		{"everything", `<id>1</id><card><number>4111</number></card><sku>a</sku>` +
+			`<total currency="USD">9.99</total><service run="true"/><note>x</note><note>y</note><x:ext xmlns:x="urn:other"><x:any/></x:ext>`, ""},
+
+		{"missing required", `<sku>a</sku>`, "expected id"},
+		{"missing at end", `<id>1</id><check><amount>1</amount></check>`, "/check[1]: missing required element; expected routing"},
+		{"out of order", `<id>1</id><sku>a</sku><card><number>1</number></card>`, "element card is out of schema order"},
+		{"both choices", `<id>1</id><card><number>1</number></card><check><amount>1</amount><routing>1</routing></check>`, "element check is out of schema order"},
+		{"too many", `<id>1</id><note>1</note><note>2</note><note>3</note>`, "element note is out of schema order or repeated"},
+		{"unknown element", `<id>1</id><colour>blue</colour>`, "unexpected element colour"},
+		{"wrong namespace", `<id xmlns="">1</id>`, `unexpected element id in namespace ""`},
+		{"target namespace wildcard", `<id>1</id><extra/>`, "unexpected element extra"},
+		{"text in complex type", `hello<id>1</id>`, "has text content"},
+		{"children in simple type", `<id><b>1</b></id>`, "has child elements"},
+		{"enumeration", `<id>1</id><card><number>1</number><type>c</type></card>`, `"c" is not an allowed code value`},
+		{"pattern", `<id>1</id><card><number>41a1</number></card>`, "does not match"},
+		{"max length", `<id>1</id><card><number>12345678901234567890</number></card>`, "longer than 19 characters"},
+		{"built-in type", `<id>1</id><sku>a</sku><qty>0</qty>`, "is not a valid xsd:positiveInteger"},
+		{"min inclusive", `<id>1</id><check><amount>-1</amount><routing>1</routing></check>`, "out of the money range"},
+		{"fraction digits", `<id>1</id><total currency="USD">1.005</total>`, "too many digits"},
+		{"missing attribute", `<id>1</id><service/>`, "missing required attribute run"},
+		{"bad attribute", `<id>1</id><service run="yes"/>`, "does not match the boolean pattern"},
+		{"unknown attribute", `<id>1</id><service run="1" debug="1"/>`, "unexpected attribute debug"},
+		{"inherited attribute", `<id>1</id><check id="x"><amount>1</amount><routing>1</routing></check>`, "is not a valid xsd:int"},
+		{"simple content attribute", `<id>1</id><total>1.00</total>`, "missing required attribute currency"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := etree.NewDocument()
+			if err := doc.ReadFromString(`<order xmlns="urn:test">` + tt.doc + `</order>`); err != nil {
+				t.Fatal(err)
+			}
+			problems := strings.Join(v.Validate(doc.Root()), "\n")
+			switch {
+			case tt.want == "" && problems != "":
+				t.Errorf("problems:\n%s", problems)
+			case tt.want != "" && !strings.Contains(problems, tt.want):
+				t.Errorf("problems = %q, want one containing %q", problems, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadXSDRejectsUnsupportedConstructs(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		want   string
+	}{
+		{"all", `<xsd:complexType name="T"><xsd:all><xsd:element name="a"/></xsd:all></xsd:complexType>`, "unsupported xsd:all"},
+		{"group", `<xsd:complexType name="T"><xsd:sequence><xsd:group ref="tns:G"/></xsd:sequence></xsd:complexType>`, "unsupported xsd:group"},
+		{"import", `<xsd:import namespace="urn:other"/>`, "unsupported top-level xsd:import"},
+		{"list", `<xsd:simpleType name="T"><xsd:list itemType="xsd:string"/></xsd:simpleType>`, "only restriction is supported"},
+		{"unknown type", `<xsd:element name="e" type="tns:Missing"/>`, "unknown or unsupported type"},
+		{"unknown built-in", `<xsd:element name="e" type="xsd:duration"/>`, "unknown or unsupported type"},
+		{"restriction of complex content", `<xsd:complexType name="T"><xsd:complexContent><xsd:restriction base="xsd:anyType"/></xsd:complexContent></xsd:complexType>`, "unsupported complexContent derivation"},
+		{"substitution group", `<xsd:element name="e" substitutionGroup="tns:f"/>`, "unsupported attribute substitutionGroup"},
+		{"strict wildcard", `<xsd:complexType name="T"><xsd:sequence><xsd:any/></xsd:sequence></xsd:complexType>`, "strict processContents"},
+		{"unknown facet", `<xsd:simpleType name="T"><xsd:restriction base="xsd:string"><xsd:assertion test="true()"/></xsd:restriction></xsd:simpleType>`, "unsupported facet"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema := `<xsd:schema xmlns:xsd="http://www.w3.org/2001/XMLSchema" xmlns:tns="urn:test" targetNamespace="urn:test">` +
+				tt.schema + `</xsd:schema>`
+			_, err := loadXSD(writeSchema(t, schema))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("loadXSD() error = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}